@@ -16,26 +16,62 @@
 package onens
 
 import (
+	"context"
 	"fmt"
 	"math/big"
+	"time"
 
+	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/jw-1ns/go-1ns/contracts/baseregistrar"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
 )
 
+// defaultRegistrarConcurrency is the default maximum number of concurrent
+// calls made when enumerating names.
+const defaultRegistrarConcurrency = 8
+
+// labelQueryBatch is the number of labelhashes looked up in a single log query.
+const labelQueryBatch = 100
+
 // BaseRegistrar is the structure for the registrar
 type BaseRegistrar struct {
 	backend      bind.ContractBackend
 	domain       string
 	Contract     *baseregistrar.Contract
 	ContractAddr common.Address
+	// Concurrency is the maximum number of concurrent calls made when
+	// enumerating names
+	Concurrency int
+	// LogRange is the range of blocks searched for the registration events
+	// that hold the labels of names
+	LogRange
+}
+
+// RegisteredName is a name held as a token by the registrar.
+type RegisteredName struct {
+	TokenID   *big.Int
+	LabelHash [32]byte
+	// Label is the plain-text label, or its encoded labelhash if the
+	// label is not known
+	Label string
+	// Name is the fully-qualified name
+	Name   string
+	Owner  common.Address
+	Expiry time.Time
 }
 
 // NewBaseRegistrar obtains the registrar contract for a given domain
 func NewBaseRegistrar(backend bind.ContractBackend, domain string) (*BaseRegistrar, error) {
-	address, err := RegistrarContractAddress(backend, domain)
+	return NewBaseRegistrarCtx(context.Background(), backend, domain)
+}
+
+// NewBaseRegistrarCtx is as per NewBaseRegistrar, with a context.
+func NewBaseRegistrarCtx(ctx context.Context, backend bind.ContractBackend, domain string) (*BaseRegistrar, error) {
+	address, err := RegistrarContractAddressCtx(ctx, backend, domain)
 	if err != nil {
 		return nil, err
 	}
@@ -50,7 +86,7 @@ func NewBaseRegistrar(backend bind.ContractBackend, domain string) (*BaseRegistr
 		return nil, err
 	}
 
-	supported, err := contract.SupportsInterface(nil, [4]byte{0x28, 0xed, 0x4f, 0x6c})
+	supported, err := contract.SupportsInterface(&bind.CallOpts{Context: ctx}, [4]byte{0x28, 0xed, 0x4f, 0x6c})
 	if err != nil {
 		return nil, err
 	}
@@ -63,18 +99,24 @@ func NewBaseRegistrar(backend bind.ContractBackend, domain string) (*BaseRegistr
 		domain:       domain,
 		Contract:     contract,
 		ContractAddr: address,
+		Concurrency:  defaultRegistrarConcurrency,
 	}, nil
 }
 
 // RegisteredWith returns "permanent" or "none" for the
 // registrar on which this name is registered
 func (r *BaseRegistrar) RegisteredWith(domain string) (string, error) {
+	return r.RegisteredWithCtx(context.Background(), domain)
+}
+
+// RegisteredWithCtx is as per RegisteredWith, with a context.
+func (r *BaseRegistrar) RegisteredWithCtx(ctx context.Context, domain string) (string, error) {
 	// See if we're registered - fetch the owner to find out
 	registry, err := NewRegistry(r.backend)
 	if err != nil {
 		return "", err
 	}
-	owner, err := registry.Owner(domain)
+	owner, err := registry.OwnerCtx(ctx, domain)
 	if err != nil {
 		return "", err
 	}
@@ -88,6 +130,11 @@ func (r *BaseRegistrar) RegisteredWith(domain string) (string, error) {
 
 // Owner obtains the owner of the underlying token that represents the name.
 func (r *BaseRegistrar) Owner(domain string) (common.Address, error) {
+	return r.OwnerCtx(context.Background(), domain)
+}
+
+// OwnerCtx is as per Owner, with a context.
+func (r *BaseRegistrar) OwnerCtx(ctx context.Context, domain string) (common.Address, error) {
 	name, err := UnqualifiedName(domain, r.domain)
 	if err != nil {
 		return UnknownAddress, err
@@ -96,21 +143,56 @@ func (r *BaseRegistrar) Owner(domain string) (common.Address, error) {
 	if err != nil {
 		return UnknownAddress, err
 	}
-	owner, err := r.Contract.OwnerOf(nil, new(big.Int).SetBytes(labelHash[:]))
+	owner, err := r.Contract.OwnerOf(&bind.CallOpts{Context: ctx}, new(big.Int).SetBytes(labelHash[:]))
 	// Registrar reverts rather than provide a 0 owner, so...
-	if err != nil && err.Error() == "execution reverted" {
+	if isReverted(err) {
 		return UnknownAddress, nil
 	}
 	return owner, err
 }
 
+// IsApproved returns true if the operator is approved to transfer the token
+// holding the name, either for this token alone or for all tokens of its
+// owner.
+func (r *BaseRegistrar) IsApproved(domain string, operator common.Address) (bool, error) {
+	return r.IsApprovedCtx(context.Background(), domain, operator)
+}
+
+// IsApprovedCtx is as per IsApproved, with a context.
+func (r *BaseRegistrar) IsApprovedCtx(ctx context.Context, domain string, operator common.Address) (bool, error) {
+	name, err := UnqualifiedName(domain, r.domain)
+	if err != nil {
+		return false, err
+	}
+	owner, err := r.OwnerCtx(ctx, name)
+	if err != nil {
+		return false, err
+	}
+	if owner == UnknownAddress {
+		return false, nil
+	}
+	approved, err := r.Contract.IsApprovedForAll(&bind.CallOpts{Context: ctx}, owner, operator)
+	if err != nil || approved {
+		return approved, err
+	}
+	labelHash, err := LabelHash(name)
+	if err != nil {
+		return false, err
+	}
+	tokenApproved, err := r.Contract.GetApproved(&bind.CallOpts{Context: ctx}, new(big.Int).SetBytes(labelHash[:]))
+	if err != nil {
+		return false, err
+	}
+	return tokenApproved == operator, nil
+}
+
 // SetOwner sets the owner of the token holding the name
 func (r *BaseRegistrar) SetOwner(opts *bind.TransactOpts, domain string, newOwner common.Address) (*types.Transaction, error) {
 	name, err := UnqualifiedName(domain, r.domain)
 	if err != nil {
 		return nil, err
 	}
-	owner, err := r.Owner(name)
+	owner, err := r.OwnerCtx(optsContext(opts), name)
 	if err != nil {
 		return nil, err
 	}
@@ -124,6 +206,11 @@ func (r *BaseRegistrar) SetOwner(opts *bind.TransactOpts, domain string, newOwne
 
 // Expiry obtains the unix timestamp at which the registration expires.
 func (r *BaseRegistrar) Expiry(domain string) (*big.Int, error) {
+	return r.ExpiryCtx(context.Background(), domain)
+}
+
+// ExpiryCtx is as per Expiry, with a context.
+func (r *BaseRegistrar) ExpiryCtx(ctx context.Context, domain string) (*big.Int, error) {
 	name, err := UnqualifiedName(domain, r.domain)
 	if err != nil {
 		return nil, err
@@ -133,7 +220,22 @@ func (r *BaseRegistrar) Expiry(domain string) (*big.Int, error) {
 		return nil, err
 	}
 	id := new(big.Int).SetBytes(labelHash[:])
-	return r.Contract.NameExpires(nil, id)
+	return r.Contract.NameExpires(&bind.CallOpts{Context: ctx}, id)
+}
+
+// GracePeriod obtains the period after expiry during which a name can be
+// renewed but not registered by anyone else.
+func (r *BaseRegistrar) GracePeriod() (time.Duration, error) {
+	return r.GracePeriodCtx(context.Background())
+}
+
+// GracePeriodCtx is as per GracePeriod, with a context.
+func (r *BaseRegistrar) GracePeriodCtx(ctx context.Context) (time.Duration, error) {
+	period, err := r.Contract.GRACEPERIOD(&bind.CallOpts{Context: ctx})
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(period.Int64()) * time.Second, nil
 }
 
 // Reclaim reclaims a domain by the owner
@@ -149,3 +251,187 @@ func (r *BaseRegistrar) Reclaim(opts *bind.TransactOpts, domain string, newOwner
 	id := new(big.Int).SetBytes(labelHash[:])
 	return r.Contract.Reclaim(opts, id, newOwner)
 }
+
+// NamesOf returns the names owned by an address, along with their expiries.
+// Labels are obtained from DefaultLabelStore or registration events where
+// available.
+func (r *BaseRegistrar) NamesOf(ctx context.Context, owner common.Address) ([]*RegisteredName, error) {
+	balance, err := r.Contract.BalanceOf(&bind.CallOpts{Context: ctx}, owner)
+	if err != nil {
+		return nil, err
+	}
+	if !balance.IsInt64() {
+		return nil, fmt.Errorf("invalid balance %v", balance)
+	}
+
+	names := make([]*RegisteredName, balance.Int64())
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(r.concurrency())
+	for i := range names {
+		i := i
+		group.Go(func() error {
+			opts := &bind.CallOpts{Context: groupCtx}
+			id, err := r.Contract.TokenOfOwnerByIndex(opts, owner, big.NewInt(int64(i)))
+			if err != nil {
+				return err
+			}
+			name, err := r.registeredName(opts, id)
+			if err != nil {
+				return err
+			}
+			name.Owner = owner
+			names[i] = name
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	if err := r.addLabels(ctx, names); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// NameIterator pages through all of the names held by the registrar.
+type NameIterator struct {
+	registrar *BaseRegistrar
+	pageSize  int64
+	index     int64
+	total     int64
+}
+
+// Names returns an iterator over all of the names held by the registrar,
+// returning up to pageSize names at a time.
+func (r *BaseRegistrar) Names(pageSize int) *NameIterator {
+	if pageSize <= 0 {
+		pageSize = 100
+	}
+	return &NameIterator{
+		registrar: r,
+		pageSize:  int64(pageSize),
+		total:     -1,
+	}
+}
+
+// Done returns true if there are no more names to obtain.
+func (it *NameIterator) Done() bool {
+	return it.total >= 0 && it.index >= it.total
+}
+
+// Next returns the next page of names.  It returns an empty page when all
+// names have been returned.
+func (it *NameIterator) Next(ctx context.Context) ([]*RegisteredName, error) {
+	r := it.registrar
+	if it.total < 0 {
+		total, err := r.Contract.TotalSupply(&bind.CallOpts{Context: ctx})
+		if err != nil {
+			return nil, err
+		}
+		if !total.IsInt64() {
+			return nil, fmt.Errorf("invalid total supply %v", total)
+		}
+		it.total = total.Int64()
+	}
+
+	count := it.total - it.index
+	if count > it.pageSize {
+		count = it.pageSize
+	}
+	if count <= 0 {
+		return []*RegisteredName{}, nil
+	}
+
+	names := make([]*RegisteredName, count)
+	group, groupCtx := errgroup.WithContext(ctx)
+	group.SetLimit(r.concurrency())
+	for i := range names {
+		i := i
+		index := big.NewInt(it.index + int64(i))
+		group.Go(func() error {
+			opts := &bind.CallOpts{Context: groupCtx}
+			id, err := r.Contract.TokenByIndex(opts, index)
+			if err != nil {
+				return err
+			}
+			name, err := r.registeredName(opts, id)
+			if err != nil {
+				return err
+			}
+			owner, err := r.Contract.OwnerOf(opts, id)
+			switch {
+			case err == nil:
+				name.Owner = owner
+			case isReverted(err):
+				// Registrar reverts for expired names rather than provide a 0 owner
+			default:
+				return err
+			}
+			names[i] = name
+			return nil
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+	it.index += count
+
+	if err := r.addLabels(ctx, names); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
+
+// registeredName obtains the basic information about a registrar token.
+func (r *BaseRegistrar) registeredName(opts *bind.CallOpts, id *big.Int) (*RegisteredName, error) {
+	expiry, err := r.Contract.NameExpires(opts, id)
+	if err != nil {
+		return nil, err
+	}
+	return &RegisteredName{
+		TokenID:   id,
+		LabelHash: common.BigToHash(id),
+		Expiry:    time.Unix(expiry.Int64(), 0),
+	}, nil
+}
+
+// addLabels fills in the labels of names, looking up registration events
+// for any labels not already in DefaultLabelStore.  Names whose
+// registration events are not found keep their encoded labelhash.
+func (r *BaseRegistrar) addLabels(ctx context.Context, names []*RegisteredName) error {
+	unknown := make([]common.Hash, 0)
+	for _, name := range names {
+		if _, exists := DefaultLabelStore.Label(name.LabelHash); !exists {
+			unknown = append(unknown, name.LabelHash)
+		}
+	}
+	for start := 0; start < len(unknown); start += labelQueryBatch {
+		end := start + labelQueryBatch
+		if end > len(unknown) {
+			end = len(unknown)
+		}
+		logs, err := r.LogRange.filterLogs(ctx, r.backend, ethereum.FilterQuery{
+			Topics: [][]common.Hash{{controllerEventID("NameRegistered")}, unknown[start:end]},
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to obtain registration logs")
+		}
+		for _, log := range logs {
+			DefaultLabelStore.LearnFromLog(log)
+		}
+	}
+
+	for _, name := range names {
+		name.Label = DefaultLabelStore.Decode(name.LabelHash)
+		name.Name = fmt.Sprintf("%s.%s", name.Label, r.domain)
+	}
+	return nil
+}
+
+func (r *BaseRegistrar) concurrency() int {
+	if r.Concurrency <= 0 {
+		return defaultRegistrarConcurrency
+	}
+	return r.Concurrency
+}
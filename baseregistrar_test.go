@@ -0,0 +1,159 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jw-1ns/go-1ns/contracts/baseregistrar"
+	"github.com/jw-1ns/go-1ns/contracts/registrarcontroller"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var registrarTestAddress = common.HexToAddress("0x2000000000000000000000000000000000000001")
+
+// newStubBaseRegistrar creates a registrar for country whose tokens are the
+// given labels, all owned by owner.
+func newStubBaseRegistrar(t *testing.T, backend *stubBackend, owner common.Address, labels ...string) *BaseRegistrar {
+	ids := make([]*big.Int, len(labels))
+	for i, label := range labels {
+		// Hashed directly so that the label is not learned
+		labelHash := keccakLabel(label)
+		ids[i] = new(big.Int).SetBytes(labelHash[:])
+	}
+	byIndex := func(args []interface{}) ([]interface{}, error) {
+		return []interface{}{ids[args[len(args)-1].(*big.Int).Int64()]}, nil
+	}
+	backend.handle(registrarTestAddress, baseregistrar.ContractMetaData, "balanceOf", returns(big.NewInt(int64(len(ids)))))
+	backend.handle(registrarTestAddress, baseregistrar.ContractMetaData, "totalSupply", returns(big.NewInt(int64(len(ids)))))
+	backend.handle(registrarTestAddress, baseregistrar.ContractMetaData, "tokenOfOwnerByIndex", byIndex)
+	backend.handle(registrarTestAddress, baseregistrar.ContractMetaData, "tokenByIndex", byIndex)
+	backend.handle(registrarTestAddress, baseregistrar.ContractMetaData, "ownerOf", returns(owner))
+	backend.handle(registrarTestAddress, baseregistrar.ContractMetaData, "nameExpires", func(args []interface{}) ([]interface{}, error) {
+		// Expiry is derived from the token so that results can be matched.
+		return []interface{}{new(big.Int).Mod(args[0].(*big.Int), big.NewInt(1000000))}, nil
+	})
+
+	contract, err := baseregistrar.NewContract(registrarTestAddress, backend)
+	require.Nil(t, err, "Failed to create contract")
+	return &BaseRegistrar{
+		backend:      backend,
+		domain:       "country",
+		Contract:     contract,
+		ContractAddr: registrarTestAddress,
+		Concurrency:  2,
+	}
+}
+
+func TestBaseRegistrarNamesOf(t *testing.T) {
+	backend := newStubBackend()
+	owner := tconfig.testAccounts.aliceAddress
+	registrar := newStubBaseRegistrar(t, backend, owner, "namesofunknown", "namesofknown", "testb")
+
+	// Only one of the labels has a registration event
+	knownLabel := keccakLabel("namesofknown")
+	backend.logs = append(backend.logs, indexerTestLog(t, registrarcontroller.ContractMetaData, common.HexToAddress("0x03"), 1, 0, "NameRegistered", "namesofknown", knownLabel, owner, big.NewInt(1), big.NewInt(0), big.NewInt(1)))
+
+	names, err := registrar.NamesOf(context.Background(), owner)
+	require.Nil(t, err, "Failed to obtain names")
+	require.Len(t, names, 3)
+	for _, name := range names {
+		assert.Equal(t, owner, name.Owner)
+		assert.Equal(t, new(big.Int).Mod(name.TokenID, big.NewInt(1000000)).Int64(), name.Expiry.Unix())
+	}
+	assert.Equal(t, EncodeLabelHash(names[0].LabelHash), names[0].Label)
+	assert.Equal(t, EncodeLabelHash(names[0].LabelHash)+".country", names[0].Name)
+	assert.Equal(t, "namesofknown", names[1].Label)
+	assert.Equal(t, "namesofknown.country", names[1].Name)
+	assert.Equal(t, common.Hash(knownLabel), common.Hash(names[1].LabelHash))
+}
+
+func TestBaseRegistrarNames(t *testing.T) {
+	backend := newStubBackend()
+	owner := tconfig.testAccounts.bobAddress
+	registrar := newStubBaseRegistrar(t, backend, owner, "a1", "a2", "a3", "a4", "a5")
+
+	it := registrar.Names(2)
+	pages := make([]int, 0)
+	for !it.Done() {
+		names, err := it.Next(context.Background())
+		require.Nil(t, err, "Failed to obtain names")
+		pages = append(pages, len(names))
+		for _, name := range names {
+			assert.Equal(t, owner, name.Owner)
+		}
+	}
+	assert.Equal(t, []int{2, 2, 1}, pages)
+
+	names, err := it.Next(context.Background())
+	require.Nil(t, err, "Failed to obtain names after completion")
+	assert.Len(t, names, 0)
+}
+
+func TestBaseRegistrarNamesOwnerErrors(t *testing.T) {
+	backend := newStubBackend()
+	registrar := newStubBaseRegistrar(t, backend, tconfig.testAccounts.bobAddress, "b1", "b2")
+
+	// Expired names revert, and are returned without an owner
+	backend.handle(registrarTestAddress, baseregistrar.ContractMetaData, "ownerOf", func([]interface{}) ([]interface{}, error) {
+		return nil, errors.New("execution reverted")
+	})
+	names, err := registrar.Names(2).Next(context.Background())
+	require.Nil(t, err, "Failed to obtain names")
+	require.Len(t, names, 2)
+	for _, name := range names {
+		assert.Equal(t, UnknownAddress, name.Owner)
+	}
+
+	// Other failures fail the page
+	backend.handle(registrarTestAddress, baseregistrar.ContractMetaData, "ownerOf", func([]interface{}) ([]interface{}, error) {
+		return nil, errors.New("connection refused")
+	})
+	_, err = registrar.Names(2).Next(context.Background())
+	assert.EqualError(t, err, "connection refused")
+}
+
+func TestBaseRegistrarLabelRange(t *testing.T) {
+	backend := newStubBackend()
+	owner := tconfig.testAccounts.aliceAddress
+	registrar := newStubBaseRegistrar(t, backend, owner, "rangeearly", "rangelate", "rangebefore")
+	registrar.StartBlock = 10
+	registrar.BlockRange = 40
+	for i, label := range []string{"rangeearly", "rangelate", "rangebefore"} {
+		block := []uint64{10, 100, 9}[i]
+		backend.logs = append(backend.logs, indexerTestLog(t, registrarcontroller.ContractMetaData, common.HexToAddress("0x03"), block, 0, "NameRegistered", label, keccakLabel(label), owner, big.NewInt(1), big.NewInt(0), big.NewInt(1)))
+	}
+
+	// Logs are requested a block range at a time from the start block
+	names, err := registrar.NamesOf(context.Background(), owner)
+	require.Nil(t, err, "Failed to obtain names")
+	require.Len(t, backend.filters, 3)
+	assert.Equal(t, big.NewInt(10), backend.filters[0].FromBlock)
+	assert.Equal(t, big.NewInt(49), backend.filters[0].ToBlock)
+	assert.Equal(t, big.NewInt(100), backend.filters[2].ToBlock)
+	assert.Equal(t, "rangeearly", names[0].Label)
+	assert.Equal(t, "rangelate", names[1].Label)
+	assert.Equal(t, EncodeLabelHash(keccakLabel("rangebefore")), names[2].Label)
+
+	// Failure to obtain logs is returned rather than leaving labels unknown
+	backend.filterErr = errors.New("query returned more than 10000 results")
+	_, err = registrar.NamesOf(context.Background(), owner)
+	assert.EqualError(t, err, "failed to obtain registration logs: query returned more than 10000 results")
+}
@@ -0,0 +1,456 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jw-1ns/go-1ns/contracts/publicresolver"
+	"github.com/jw-1ns/go-1ns/contracts/registry"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultMulticall3 is the address of the Multicall3 contract, which is
+// deployed at the same address on most chains.
+var DefaultMulticall3 = common.HexToAddress("0xcA11bde05977b3631167028862bE2a173976CA11")
+
+// defaultBulkBatchSize is the default number of calls in each multicall.
+const defaultBulkBatchSize = 500
+
+// multicall3ABI contains the parts of the Multicall3 contract used here.
+const multicall3ABI = `[
+	{"inputs":[{"components":[{"name":"target","type":"address"},{"name":"allowFailure","type":"bool"},{"name":"callData","type":"bytes"}],"name":"calls","type":"tuple[]"}],"name":"aggregate3","outputs":[{"components":[{"name":"success","type":"bool"},{"name":"returnData","type":"bytes"}],"name":"returnData","type":"tuple[]"}],"stateMutability":"payable","type":"function"}
+]`
+
+// ResolveResult is the result of resolving a single name.
+type ResolveResult struct {
+	Address common.Address
+	Err     error
+}
+
+// ReverseResolveResult is the result of reverse resolving a single address.
+type ReverseResolveResult struct {
+	Name string
+	Err  error
+}
+
+// BulkResolver resolves and reverse resolves large numbers of names and
+// addresses.  Calls are batched through Multicall3 where it is deployed, and
+// otherwise made individually; either way up to Concurrency requests are in
+// flight at a time.
+type BulkResolver struct {
+	backend  bind.ContractBackend
+	registry common.Address
+	// Multicall3 is the address of the Multicall3 contract
+	Multicall3 common.Address
+	// BatchSize is the maximum number of calls in each multicall
+	BatchSize int
+	// Concurrency is the maximum number of concurrent requests
+	Concurrency int
+
+	registryABI  *abi.ABI
+	resolverABI  *abi.ABI
+	multicallABI abi.ABI
+}
+
+// bulkCall is a single call made by the bulk resolver, along with its result.
+type bulkCall struct {
+	to   common.Address
+	data []byte
+	res  []byte
+	err  error
+}
+
+// NewBulkResolver creates a bulk resolver.
+func NewBulkResolver(backend bind.ContractBackend) (*BulkResolver, error) {
+	registryABI, err := registry.ContractMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	resolverABI, err := publicresolver.ContractMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	multicallABI, err := abi.JSON(strings.NewReader(multicall3ABI))
+	if err != nil {
+		return nil, err
+	}
+	return &BulkResolver{
+		backend:      backend,
+		registry:     config.Registry,
+		Multicall3:   DefaultMulticall3,
+		BatchSize:    defaultBulkBatchSize,
+		Concurrency:  defaultRegistrarConcurrency,
+		registryABI:  registryABI,
+		resolverABI:  resolverABI,
+		multicallABI: multicallABI,
+	}, nil
+}
+
+// ResolveMany resolves names as per Resolve() using a bulk resolver with
+// the default settings.
+func ResolveMany(ctx context.Context, backend bind.ContractBackend, inputs []string) ([]*ResolveResult, error) {
+	resolver, err := NewBulkResolver(backend)
+	if err != nil {
+		return nil, err
+	}
+	return resolver.ResolveMany(ctx, inputs)
+}
+
+// ReverseResolveMany reverse resolves addresses using a bulk resolver with
+// the default settings.
+func ReverseResolveMany(ctx context.Context, backend bind.ContractBackend, addresses []common.Address) ([]*ReverseResolveResult, error) {
+	resolver, err := NewBulkResolver(backend)
+	if err != nil {
+		return nil, err
+	}
+	return resolver.ReverseResolveMany(ctx, addresses)
+}
+
+// ResolveMany resolves names in to addresses as per Resolve(), returning a
+// result for each input in the same order.  Failures to resolve individual
+// names are returned in their results; the error is only set if the
+// context is done.
+func (r *BulkResolver) ResolveMany(ctx context.Context, inputs []string) ([]*ResolveResult, error) {
+	results := make([]*ResolveResult, len(inputs))
+	// Each name is only resolved once, however many times it appears
+	nodes := make([]common.Hash, 0)
+	indices := make(map[common.Hash][]int)
+	for i, input := range inputs {
+		results[i] = &ResolveResult{}
+		if !strings.Contains(input, ".") {
+			results[i].Address, results[i].Err = ResolveCtx(ctx, r.backend, input)
+			continue
+		}
+		node, err := NameHash(input)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		if node == (common.Hash{}) {
+			results[i].Err = errors.New("bad name")
+			continue
+		}
+		if _, exists := indices[node]; !exists {
+			nodes = append(nodes, node)
+		}
+		indices[node] = append(indices[node], i)
+	}
+
+	addresses, errs, err := r.resolveNodes(ctx, nodes)
+	if err != nil {
+		return nil, err
+	}
+	for i, node := range nodes {
+		for _, index := range indices[node] {
+			results[index].Address = addresses[i]
+			results[index].Err = errs[i]
+		}
+	}
+	return results, nil
+}
+
+// ReverseResolveMany resolves addresses in to their primary names,
+// returning a result for each address in the same order.  Names are only
+// returned if they resolve back to their address.  Failures to resolve
+// individual addresses are returned in their results; the error is only
+// set if the context is done.
+func (r *BulkResolver) ReverseResolveMany(ctx context.Context, addresses []common.Address) ([]*ReverseResolveResult, error) {
+	results := make([]*ReverseResolveResult, len(addresses))
+	nodes := make([]common.Hash, len(addresses))
+	for i, address := range addresses {
+		results[i] = &ReverseResolveResult{}
+		node, err := NameHash(fmt.Sprintf("%x.addr.reverse", address.Bytes()))
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = node
+	}
+
+	resolvers, errs, err := r.resolversOf(ctx, nodes)
+	if err != nil {
+		return nil, err
+	}
+	calls := make([]*bulkCall, 0)
+	pending := make([]int, 0)
+	for i := range addresses {
+		if errs[i] != nil {
+			results[i].Err = errs[i]
+			continue
+		}
+		data, err := r.resolverABI.Pack("name", nodes[i])
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls, &bulkCall{to: resolvers[i], data: data})
+		pending = append(pending, i)
+	}
+	if err := r.call(ctx, calls); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0)
+	verify := make([]int, 0)
+	for j, call := range calls {
+		i := pending[j]
+		name, err := r.unpackResolverCall(call, "name")
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		if name.(string) == "" {
+			results[i].Err = errors.New("no name")
+			continue
+		}
+		results[i].Name = name.(string)
+		names = append(names, name.(string))
+		verify = append(verify, i)
+	}
+
+	// Confirm that the names resolve back to their addresses
+	resolved, err := r.ResolveMany(ctx, names)
+	if err != nil {
+		return nil, err
+	}
+	for j, res := range resolved {
+		i := verify[j]
+		switch {
+		case res.Err != nil:
+			results[i].Err = errors.Wrap(res.Err, "failed to resolve name")
+		case res.Address != addresses[i]:
+			results[i].Err = errors.New("name does not resolve to address")
+		}
+		if results[i].Err != nil {
+			results[i].Name = ""
+		}
+	}
+	return results, nil
+}
+
+// resolveNodes obtains the addresses of the given nodes.
+func (r *BulkResolver) resolveNodes(ctx context.Context, nodes []common.Hash) ([]common.Address, []error, error) {
+	addresses := make([]common.Address, len(nodes))
+	resolvers, errs, err := r.resolversOf(ctx, nodes)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Calls are grouped by resolver, so that each batch touches as few
+	// contracts as possible
+	pending := make([]int, 0)
+	for i := range nodes {
+		if errs[i] == nil {
+			pending = append(pending, i)
+		}
+	}
+	sort.SliceStable(pending, func(a, b int) bool {
+		return bytes.Compare(resolvers[pending[a]].Bytes(), resolvers[pending[b]].Bytes()) < 0
+	})
+	calls := make([]*bulkCall, len(pending))
+	for j, i := range pending {
+		data, err := r.resolverABI.Pack("addr", nodes[i])
+		if err != nil {
+			return nil, nil, err
+		}
+		calls[j] = &bulkCall{to: resolvers[i], data: data}
+	}
+	if err := r.call(ctx, calls); err != nil {
+		return nil, nil, err
+	}
+
+	for j, call := range calls {
+		i := pending[j]
+		address, err := r.unpackResolverCall(call, "addr")
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		addresses[i] = address.(common.Address)
+		if addresses[i] == UnknownAddress {
+			errs[i] = errors.New("no address")
+		}
+	}
+	return addresses, errs, nil
+}
+
+// resolversOf obtains the resolvers of the given nodes, along with an error
+// for each node that is unregistered or has no resolver.
+func (r *BulkResolver) resolversOf(ctx context.Context, nodes []common.Hash) ([]common.Address, []error, error) {
+	calls := make([]*bulkCall, 0, len(nodes)*2)
+	for _, node := range nodes {
+		ownerData, err := r.registryABI.Pack("owner", node)
+		if err != nil {
+			return nil, nil, err
+		}
+		resolverData, err := r.registryABI.Pack("resolver", node)
+		if err != nil {
+			return nil, nil, err
+		}
+		calls = append(calls, &bulkCall{to: r.registry, data: ownerData}, &bulkCall{to: r.registry, data: resolverData})
+	}
+	if err := r.call(ctx, calls); err != nil {
+		return nil, nil, err
+	}
+
+	resolvers := make([]common.Address, len(nodes))
+	errs := make([]error, len(nodes))
+	for i := range nodes {
+		owner, err := r.unpack(r.registryABI, "owner", calls[i*2])
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		if owner.(common.Address) == UnknownAddress {
+			errs[i] = withReason(ErrNotRegistered, "unregistered name")
+			continue
+		}
+		resolver, err := r.unpack(r.registryABI, "resolver", calls[i*2+1])
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		resolvers[i] = resolver.(common.Address)
+		if resolvers[i] == UnknownAddress {
+			errs[i] = ErrNoResolver
+		}
+	}
+	return resolvers, errs, nil
+}
+
+// unpackResolverCall unpacks the result of a call to a resolver.  Calls to
+// addresses without code succeed with no data, so are reported as having
+// no resolver.
+func (r *BulkResolver) unpackResolverCall(call *bulkCall, method string) (interface{}, error) {
+	if call.err == nil && len(call.res) == 0 {
+		return nil, ErrNoResolver
+	}
+	return r.unpack(r.resolverABI, method, call)
+}
+
+// unpack unpacks the single value returned by a call.
+func (r *BulkResolver) unpack(contractABI *abi.ABI, method string, call *bulkCall) (interface{}, error) {
+	if call.err != nil {
+		return nil, call.err
+	}
+	values, err := contractABI.Unpack(method, call.res)
+	if err != nil {
+		return nil, err
+	}
+	return values[0], nil
+}
+
+// call makes the given calls, setting their results.  The error is only set
+// if the context is done; failures of individual calls are set in the calls.
+func (r *BulkResolver) call(ctx context.Context, calls []*bulkCall) error {
+	if len(calls) == 0 {
+		return nil
+	}
+	code, err := r.backend.CodeAt(ctx, r.Multicall3, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to obtain multicall contract")
+	}
+
+	concurrency := r.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultRegistrarConcurrency
+	}
+	group := new(errgroup.Group)
+	group.SetLimit(concurrency)
+	if len(code) == 0 {
+		for _, call := range calls {
+			call := call
+			group.Go(func() error {
+				call.res, call.err = r.backend.CallContract(ctx, ethereum.CallMsg{To: &call.to, Data: call.data}, nil)
+				return nil
+			})
+		}
+	} else {
+		batchSize := r.BatchSize
+		if batchSize <= 0 {
+			batchSize = defaultBulkBatchSize
+		}
+		for start := 0; start < len(calls); start += batchSize {
+			end := start + batchSize
+			if end > len(calls) {
+				end = len(calls)
+			}
+			batch := calls[start:end]
+			group.Go(func() error {
+				r.multicall(ctx, batch)
+				return nil
+			})
+		}
+	}
+	group.Wait()
+	return ctx.Err()
+}
+
+// multicall makes a batch of calls through Multicall3.
+func (r *BulkResolver) multicall(ctx context.Context, batch []*bulkCall) {
+	type multicall3Call struct {
+		Target       common.Address
+		AllowFailure bool
+		CallData     []byte
+	}
+	type multicall3Result struct {
+		Success    bool
+		ReturnData []byte
+	}
+
+	fail := func(err error) {
+		for _, call := range batch {
+			call.err = err
+		}
+	}
+	args := make([]multicall3Call, len(batch))
+	for i, call := range batch {
+		args[i] = multicall3Call{Target: call.to, AllowFailure: true, CallData: call.data}
+	}
+	data, err := r.multicallABI.Pack("aggregate3", args)
+	if err != nil {
+		fail(err)
+		return
+	}
+	res, err := r.backend.CallContract(ctx, ethereum.CallMsg{To: &r.Multicall3, Data: data}, nil)
+	if err != nil {
+		fail(errors.Wrap(err, "multicall failed"))
+		return
+	}
+	var results []multicall3Result
+	if err := r.multicallABI.UnpackIntoInterface(&results, "aggregate3", res); err != nil {
+		fail(errors.Wrap(err, "failed to unpack multicall"))
+		return
+	}
+	if len(results) != len(batch) {
+		fail(errors.New("multicall returned incorrect number of results"))
+		return
+	}
+	for i, result := range results {
+		if result.Success {
+			batch[i].res = result.ReturnData
+		} else {
+			batch[i].err = errors.New("execution reverted")
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bulkResolverTest creates a stub backend with forward and reverse records
+// for alice and bob, optionally with a Multicall3 contract.  It returns the
+// backend and a count of the calls made from within multicalls.
+func bulkResolverTest(t testing.TB, multicall bool) (*stubBackend, *int32) {
+	alice := tconfig.testAccounts.aliceAddress
+	bob := tconfig.testAccounts.bobAddress
+	reverse := func(address common.Address) string {
+		return fmt.Sprintf("%x.addr.reverse", address.Bytes())
+	}
+	// Bob's reverse record claims a name that does not resolve to bob
+	backend := newStubRegistry(t, map[string]*stubRegistryRecord{
+		"alice.country":      {owner: alice, resolver: stubResolver, addr: alice},
+		"bob.country":        {owner: bob, resolver: stubResolver, addr: bob},
+		"noresolver.country": {owner: alice},
+		"noaddr.country":     {owner: alice, resolver: stubResolver},
+		reverse(alice):       {owner: alice, resolver: stubResolver, name: "alice.country"},
+		reverse(bob):         {owner: bob, resolver: stubResolver, name: "alice.country"},
+	})
+
+	inner := new(int32)
+	if multicall {
+		parsed, err := abi.JSON(strings.NewReader(multicall3ABI))
+		require.Nil(t, err, "Failed to parse multicall ABI")
+		backend.handle(DefaultMulticall3, &bind.MetaData{ABI: multicall3ABI}, "aggregate3", func(args []interface{}) ([]interface{}, error) {
+			var calls []struct {
+				Target       common.Address
+				AllowFailure bool
+				CallData     []byte
+			}
+			if err := parsed.Methods["aggregate3"].Inputs.Copy(&calls, args); err != nil {
+				return nil, err
+			}
+			results := make([]struct {
+				Success    bool
+				ReturnData []byte
+			}, len(calls))
+			for i, call := range calls {
+				atomic.AddInt32(inner, 1)
+				res, err := backend.CallContract(context.Background(), ethereum.CallMsg{To: &call.Target, Data: call.CallData}, nil)
+				results[i].Success = err == nil
+				results[i].ReturnData = res
+			}
+			return []interface{}{results}, nil
+		})
+	}
+	return backend, inner
+}
+
+func TestBulkResolverResolveMany(t *testing.T) {
+	inputs := []string{
+		"alice.country",
+		"bob.country",
+		"unregistered.country",
+		"Alice.country",
+		"noresolver.country",
+		"noaddr.country",
+		tconfig.testAccounts.carolAddress.Hex(),
+		"0x" + strings.Repeat("1", 41),
+	}
+	requests := make(map[bool]int)
+	for _, multicall := range []bool{true, false} {
+		backend, inner := bulkResolverTest(t, multicall)
+		results, err := ResolveMany(context.Background(), backend, inputs)
+		require.Nil(t, err, "Failed to resolve names")
+		require.Len(t, results, len(inputs))
+
+		assert.Equal(t, tconfig.testAccounts.aliceAddress, results[0].Address)
+		assert.Nil(t, results[0].Err)
+		assert.Equal(t, tconfig.testAccounts.bobAddress, results[1].Address)
+		assert.Nil(t, results[1].Err)
+		assert.ErrorIs(t, results[2].Err, ErrNotRegistered)
+		assert.Equal(t, tconfig.testAccounts.aliceAddress, results[3].Address)
+		assert.Nil(t, results[3].Err)
+		assert.ErrorIs(t, results[4].Err, ErrNoResolver)
+		assert.EqualError(t, results[5].Err, "no address")
+		assert.Equal(t, tconfig.testAccounts.carolAddress, results[6].Address)
+		assert.Nil(t, results[6].Err)
+		assert.EqualError(t, results[7].Err, "address too long")
+
+		requests[multicall] = backend.calls - int(atomic.LoadInt32(inner))
+	}
+	// Registry and resolver calls are each made in a single multicall,
+	// rather than two registry calls per unique name plus a resolver call
+	// per name with a resolver
+	assert.Equal(t, 2, requests[true])
+	assert.Equal(t, 13, requests[false])
+}
+
+// BenchmarkBulkResolver compares resolving names with ResolveMany against
+// resolving them one at a time, reporting the requests made to the backend.
+func BenchmarkBulkResolver(b *testing.B) {
+	inputs := []string{"alice.country", "bob.country", "noresolver.country", "noaddr.country"}
+	for i := len(inputs); i < 100; i++ {
+		inputs = append(inputs, fmt.Sprintf("unregistered%d.country", i))
+	}
+	benchmarks := []struct {
+		name      string
+		multicall bool
+		resolve   func(backend *stubBackend)
+	}{
+		{
+			name:      "ResolveMany",
+			multicall: true,
+			resolve: func(backend *stubBackend) {
+				_, err := ResolveMany(context.Background(), backend, inputs)
+				require.Nil(b, err, "Failed to resolve names")
+			},
+		},
+		{
+			name: "ResolveManyNoMulticall",
+			resolve: func(backend *stubBackend) {
+				_, err := ResolveMany(context.Background(), backend, inputs)
+				require.Nil(b, err, "Failed to resolve names")
+			},
+		},
+		{
+			name: "Resolve",
+			resolve: func(backend *stubBackend) {
+				for _, input := range inputs {
+					// Unregistered names fail, as they do in ResolveMany
+					_, _ = ResolveCtx(context.Background(), backend, input)
+				}
+			},
+		},
+	}
+	for _, benchmark := range benchmarks {
+		b.Run(benchmark.name, func(b *testing.B) {
+			backend, inner := bulkResolverTest(b, benchmark.multicall)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				benchmark.resolve(backend)
+			}
+			b.StopTimer()
+			requests := backend.calls - int(atomic.LoadInt32(inner))
+			b.ReportMetric(float64(requests)/float64(b.N), "requests/op")
+		})
+	}
+}
+
+func TestBulkResolverReverseResolveMany(t *testing.T) {
+	for _, multicall := range []bool{true, false} {
+		backend, _ := bulkResolverTest(t, multicall)
+		results, err := ReverseResolveMany(context.Background(), backend, []common.Address{
+			tconfig.testAccounts.aliceAddress,
+			tconfig.testAccounts.bobAddress,
+			tconfig.testAccounts.carolAddress,
+		})
+		require.Nil(t, err, "Failed to reverse resolve addresses")
+		require.Len(t, results, 3)
+
+		assert.Equal(t, "alice.country", results[0].Name)
+		assert.Nil(t, results[0].Err)
+		assert.Equal(t, "", results[1].Name)
+		assert.EqualError(t, results[1].Err, "name does not resolve to address")
+		assert.Equal(t, "", results[2].Name)
+		assert.ErrorIs(t, results[2].Err, ErrNotRegistered)
+	}
+}
+
+func TestBulkResolverBatches(t *testing.T) {
+	backend, inner := bulkResolverTest(t, true)
+	resolver, err := NewBulkResolver(backend)
+	require.Nil(t, err, "Failed to create bulk resolver")
+	resolver.BatchSize = 3
+
+	inputs := make([]string, 0)
+	for i := 0; i < 5; i++ {
+		inputs = append(inputs, "alice.country", "bob.country")
+	}
+	results, err := resolver.ResolveMany(context.Background(), inputs)
+	require.Nil(t, err, "Failed to resolve names")
+	for i, result := range results {
+		require.Nil(t, result.Err)
+		if i%2 == 0 {
+			assert.Equal(t, tconfig.testAccounts.aliceAddress, result.Address)
+		} else {
+			assert.Equal(t, tconfig.testAccounts.bobAddress, result.Address)
+		}
+	}
+	// Two unique names need four registry calls in two batches, then two
+	// resolver calls in one batch
+	assert.Equal(t, int32(6), atomic.LoadInt32(inner))
+	assert.Equal(t, 3, backend.calls-int(atomic.LoadInt32(inner)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = resolver.ResolveMany(ctx, inputs)
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,414 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jw-1ns/go-1ns/contracts/publicresolver"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/singleflight"
+)
+
+// ethereumCoinType is the coin type of the address returned by Resolve.
+const ethereumCoinType = 60
+
+// cacheKey identifies a cached record of a name.
+type cacheKey struct {
+	node   common.Hash
+	record string
+}
+
+// cacheEntry is a cached record along with the resolver from which it was
+// obtained and the time at which it expires.
+type cacheEntry struct {
+	key      cacheKey
+	value    interface{}
+	resolver common.Address
+	expires  time.Time
+}
+
+// nodeLookups tracks the lookups in flight for a node.  The generation
+// changes each time the node is invalidated, so that lookups in flight do
+// not cache values that may have been invalidated.
+type nodeLookups struct {
+	count      int
+	generation uint64
+}
+
+// CachingResolver resolves names and their records, caching the results in
+// a bounded least-recently-used cache.  Each entry is cached for the
+// registry TTL of its name, capped at MaxTTL, or for DefaultTTL if the name
+// has no TTL.  Concurrent lookups of the same uncached record are combined
+// in to a single set of calls.
+//
+// Entries are only expired by time unless a watcher is running, in which
+// case they are also invalidated as soon as the records change; see Watch().
+type CachingResolver struct {
+	backend  bind.ContractBackend
+	registry *Registry
+	resolver *publicresolver.ContractFilterer
+	size     int
+	// DefaultTTL is the time for which records of names without a registry
+	// TTL are cached
+	DefaultTTL time.Duration
+	// MaxTTL is the longest time for which any record is cached, or 0 for
+	// no limit beyond the registry TTL
+	MaxTTL time.Duration
+	// FetchTimeout is the longest time for which a lookup is made, or 0 for
+	// no limit.  Lookups are shared between concurrent callers, so are not
+	// cancelled along with the context of any one of them.
+	FetchTimeout time.Duration
+
+	mu      sync.Mutex
+	entries map[cacheKey]*list.Element
+	order   *list.List
+	lookups map[common.Hash]*nodeLookups
+	group   singleflight.Group
+	now     func() time.Time
+}
+
+// NewCachingResolver creates a caching resolver holding up to size records.
+func NewCachingResolver(backend bind.ContractBackend, size int) (*CachingResolver, error) {
+	if size <= 0 {
+		return nil, errors.New("cache size must be positive")
+	}
+	registry, err := NewRegistry(backend)
+	if err != nil {
+		return nil, err
+	}
+	// The filterer is only used to parse logs, so needs no backend.
+	resolver, err := publicresolver.NewContractFilterer(common.Address{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &CachingResolver{
+		backend:      backend,
+		registry:     registry,
+		resolver:     resolver,
+		size:         size,
+		DefaultTTL:   time.Minute,
+		MaxTTL:       time.Hour,
+		FetchTimeout: 30 * time.Second,
+		entries:      make(map[cacheKey]*list.Element),
+		order:        list.New(),
+		lookups:      make(map[common.Hash]*nodeLookups),
+		now:          time.Now,
+	}, nil
+}
+
+// Resolve resolves a name in to an address as per the package-level
+// Resolve().  Inputs that are addresses are not cached.
+func (c *CachingResolver) Resolve(ctx context.Context, input string) (common.Address, error) {
+	if !strings.Contains(input, ".") {
+		return ResolveCtx(ctx, c.backend, input)
+	}
+	value, err := c.lookup(ctx, input, addressRecord(ethereumCoinType), func(ctx context.Context) (interface{}, error) {
+		return ResolveCtx(ctx, c.backend, input)
+	})
+	if err != nil {
+		return UnknownAddress, err
+	}
+	return value.(common.Address), nil
+}
+
+// MultiAddress obtains the address of a name for a given coin type.
+func (c *CachingResolver) MultiAddress(ctx context.Context, name string, coinType uint64) ([]byte, error) {
+	value, err := c.lookup(ctx, name, addressRecord(coinType), func(ctx context.Context) (interface{}, error) {
+		resolver, err := NewResolverCtx(ctx, c.backend, name)
+		if err != nil {
+			return nil, err
+		}
+		return resolver.MultiAddressCtx(ctx, coinType)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]byte), nil
+}
+
+// Text obtains a text record of a name.
+func (c *CachingResolver) Text(ctx context.Context, name string, key string) (string, error) {
+	value, err := c.lookup(ctx, name, "text/"+key, func(ctx context.Context) (interface{}, error) {
+		resolver, err := NewResolverCtx(ctx, c.backend, name)
+		if err != nil {
+			return nil, err
+		}
+		return resolver.TextCtx(ctx, key)
+	})
+	if err != nil {
+		return "", err
+	}
+	return value.(string), nil
+}
+
+// Contenthash obtains the content hash of a name.
+func (c *CachingResolver) Contenthash(ctx context.Context, name string) ([]byte, error) {
+	value, err := c.lookup(ctx, name, "contenthash", func(ctx context.Context) (interface{}, error) {
+		resolver, err := NewResolverCtx(ctx, c.backend, name)
+		if err != nil {
+			return nil, err
+		}
+		return resolver.ContenthashCtx(ctx)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value.([]byte), nil
+}
+
+// Purge removes all entries from the cache.
+func (c *CachingResolver) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = make(map[cacheKey]*list.Element)
+	c.order.Init()
+	for _, lookups := range c.lookups {
+		lookups.generation++
+	}
+}
+
+// Watch invalidates cached records as they change on-chain, until the
+// context is cancelled or the subscription fails.  It requires a backend
+// that supports log subscriptions, such as a websocket connection.
+func (c *CachingResolver) Watch(ctx context.Context) error {
+	logs := make(chan types.Log)
+	sub, err := c.backend.SubscribeFilterLogs(ctx, ethereum.FilterQuery{
+		Topics: [][]common.Hash{{
+			registryEventID("NewResolver"),
+			registryEventID("Transfer"),
+			resolverEventID("AddrChanged"),
+			resolverEventID("AddressChanged"),
+			resolverEventID("TextChanged"),
+			resolverEventID("ContenthashChanged"),
+		}},
+	}, logs)
+	if err != nil {
+		return errors.Wrap(err, "failed to subscribe to logs")
+	}
+	defer sub.Unsubscribe()
+	for {
+		select {
+		case log := <-logs:
+			c.ApplyLog(&log)
+		case err := <-sub.Err():
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// ApplyLog invalidates the cached records changed by an event, for use
+// where logs are obtained by other means than Watch().  Logs removed by
+// reorganisations also invalidate, as the records revert.  Resolver events
+// only invalidate records obtained from the resolver that emitted them.
+func (c *CachingResolver) ApplyLog(log *types.Log) {
+	if len(log.Topics) < 2 {
+		return
+	}
+	node := log.Topics[1]
+	switch log.Topics[0] {
+	case registryEventID("NewResolver"), registryEventID("Transfer"):
+		if log.Address == c.registry.ContractAddr {
+			c.invalidateNode(node)
+		}
+		return
+	}
+
+	event, err := decodeResolverLog(c.resolver, log)
+	if err != nil || event == nil {
+		return
+	}
+	switch event.Kind {
+	case "AddrChanged":
+		c.invalidateRecord(node, addressRecord(ethereumCoinType), log.Address)
+	case "AddressChanged":
+		c.invalidateRecord(node, "addr/"+event.Key, log.Address)
+	case "TextChanged":
+		c.invalidateRecord(node, "text/"+event.Key, log.Address)
+	case "ContenthashChanged":
+		c.invalidateRecord(node, "contenthash", log.Address)
+	}
+}
+
+// lookup returns a record from the cache, or fetches and caches it.
+func (c *CachingResolver) lookup(ctx context.Context, name string, record string, fetch func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	node, err := NameHash(name)
+	if err != nil {
+		return nil, err
+	}
+	key := cacheKey{node: node, record: record}
+	c.mu.Lock()
+	if value, exists := c.get(key); exists {
+		c.mu.Unlock()
+		return value, nil
+	}
+	c.mu.Unlock()
+
+	ch := c.group.DoChan(fmt.Sprintf("%x/%s", node, record), func() (interface{}, error) {
+		lookups, generation := c.startLookup(node)
+		defer c.endLookup(node, lookups)
+
+		ctx := context.Context(detachedContext{parent: ctx})
+		if c.FetchTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, c.FetchTimeout)
+			defer cancel()
+		}
+		value, err := fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		resolver, err := c.registry.ResolverAddressCtx(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		ttl, err := c.registry.TTLCtx(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if lookups.generation == generation {
+			c.put(key, value, resolver, c.ttl(ttl))
+		}
+		return value, nil
+	})
+	select {
+	case res := <-ch:
+		return res.Val, res.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// startLookup records a lookup in flight for a node, returning the lookups
+// of the node and their current generation.
+func (c *CachingResolver) startLookup(node common.Hash) (*nodeLookups, uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	lookups, exists := c.lookups[node]
+	if !exists {
+		lookups = &nodeLookups{}
+		c.lookups[node] = lookups
+	}
+	lookups.count++
+	return lookups, lookups.generation
+}
+
+// endLookup records the end of a lookup for a node.
+func (c *CachingResolver) endLookup(node common.Hash, lookups *nodeLookups) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	lookups.count--
+	if lookups.count == 0 {
+		delete(c.lookups, node)
+	}
+}
+
+// ttl returns the time for which to cache a record given its registry TTL.
+func (c *CachingResolver) ttl(registryTTL time.Duration) time.Duration {
+	ttl := registryTTL
+	if ttl == 0 {
+		ttl = c.DefaultTTL
+	}
+	if c.MaxTTL > 0 && ttl > c.MaxTTL {
+		ttl = c.MaxTTL
+	}
+	return ttl
+}
+
+// get returns an unexpired entry, marking it as recently used.  It must be
+// called with the lock held.
+func (c *CachingResolver) get(key cacheKey) (interface{}, bool) {
+	element, exists := c.entries[key]
+	if !exists {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if !c.now().Before(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return entry.value, true
+}
+
+// put adds an entry, evicting the least recently used entry if the cache is
+// full.  It must be called with the lock held.
+func (c *CachingResolver) put(key cacheKey, value interface{}, resolver common.Address, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	entry := &cacheEntry{key: key, value: value, resolver: resolver, expires: c.now().Add(ttl)}
+	if element, exists := c.entries[key]; exists {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// invalidateNode removes all records of a node from the cache.
+func (c *CachingResolver) invalidateNode(node common.Hash) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if lookups, exists := c.lookups[node]; exists {
+		lookups.generation++
+	}
+	for key, element := range c.entries {
+		if key.node == node {
+			c.order.Remove(element)
+			delete(c.entries, key)
+		}
+	}
+}
+
+// invalidateRecord removes a record of a node from the cache if it was
+// obtained from the given resolver.  The resolver of a node being looked up
+// is not yet known, so lookups in flight are invalidated regardless.
+func (c *CachingResolver) invalidateRecord(node common.Hash, record string, resolver common.Address) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if lookups, exists := c.lookups[node]; exists {
+		lookups.generation++
+	}
+	key := cacheKey{node: node, record: record}
+	if element, exists := c.entries[key]; exists && element.Value.(*cacheEntry).resolver == resolver {
+		c.order.Remove(element)
+		delete(c.entries, key)
+	}
+}
+
+// addressRecord is the cache record of an address for a coin type.
+func addressRecord(coinType uint64) string {
+	return fmt.Sprintf("addr/%d", coinType)
+}
@@ -0,0 +1,282 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jw-1ns/go-1ns/contracts/publicresolver"
+	"github.com/jw-1ns/go-1ns/contracts/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cachingResolverProbe reports if an address call is the check made by
+// NewResolverAt(), rather than a lookup of a name.
+func cachingResolverProbe(args []interface{}) bool {
+	probe, _ := NameHash("test.country")
+	return args[0].([32]byte) == probe
+}
+
+// cachingResolverTest creates a caching resolver over a stub backend with
+// names resolving to alice, counting the address lookups made.
+func cachingResolverTest(t *testing.T, size int, names ...string) (*CachingResolver, *stubBackend, *int32) {
+	alice := tconfig.testAccounts.aliceAddress
+	records := make(map[string]*stubRegistryRecord)
+	for _, name := range names {
+		records[name] = &stubRegistryRecord{owner: alice, resolver: stubResolver, text: map[string]string{"url": "https://" + name}}
+	}
+	backend := newStubRegistry(t, records)
+	lookups := new(int32)
+	backend.handle(stubResolver, publicresolver.ContractMetaData, "addr", func(args []interface{}) ([]interface{}, error) {
+		if !cachingResolverProbe(args) {
+			atomic.AddInt32(lookups, 1)
+		}
+		return []interface{}{alice}, nil
+	})
+	resolver, err := NewCachingResolver(backend, size)
+	require.Nil(t, err, "Failed to create caching resolver")
+	return resolver, backend, lookups
+}
+
+func TestCachingResolverTTL(t *testing.T) {
+	resolver, backend, lookups := cachingResolverTest(t, 10, "cache.country")
+	now := time.Unix(1700000000, 0)
+	resolver.now = func() time.Time { return now }
+
+	address, err := resolver.Resolve(context.Background(), "cache.country")
+	require.Nil(t, err, "Failed to resolve name")
+	assert.Equal(t, tconfig.testAccounts.aliceAddress, address)
+	address, err = resolver.Resolve(context.Background(), "Cache.country")
+	require.Nil(t, err, "Failed to resolve name")
+	assert.Equal(t, tconfig.testAccounts.aliceAddress, address)
+	assert.Equal(t, int32(1), atomic.LoadInt32(lookups))
+
+	// Names without a registry TTL are cached for the default TTL
+	now = now.Add(resolver.DefaultTTL)
+	_, err = resolver.Resolve(context.Background(), "cache.country")
+	require.Nil(t, err, "Failed to resolve name")
+	assert.Equal(t, int32(2), atomic.LoadInt32(lookups))
+
+	// Registry TTLs are capped at the maximum TTL
+	backend.handle(config.Registry, registry.ContractMetaData, "ttl", returns(uint64(86400)))
+	resolver.Purge()
+	_, err = resolver.Resolve(context.Background(), "cache.country")
+	require.Nil(t, err, "Failed to resolve name")
+	now = now.Add(resolver.MaxTTL - time.Second)
+	_, err = resolver.Resolve(context.Background(), "cache.country")
+	require.Nil(t, err, "Failed to resolve name")
+	assert.Equal(t, int32(3), atomic.LoadInt32(lookups))
+	now = now.Add(time.Second)
+	_, err = resolver.Resolve(context.Background(), "cache.country")
+	require.Nil(t, err, "Failed to resolve name")
+	assert.Equal(t, int32(4), atomic.LoadInt32(lookups))
+
+	// Addresses are passed through
+	address, err = resolver.Resolve(context.Background(), tconfig.testAccounts.bobAddress.Hex())
+	require.Nil(t, err, "Failed to resolve address")
+	assert.Equal(t, tconfig.testAccounts.bobAddress, address)
+}
+
+func TestCachingResolverEviction(t *testing.T) {
+	resolver, _, lookups := cachingResolverTest(t, 2, "one.country", "two.country", "three.country")
+	for _, name := range []string{"one.country", "two.country", "one.country", "three.country", "one.country"} {
+		_, err := resolver.Resolve(context.Background(), name)
+		require.Nil(t, err, "Failed to resolve name")
+	}
+	// two.country was least recently used, so was evicted by three.country
+	assert.Equal(t, int32(3), atomic.LoadInt32(lookups))
+	_, err := resolver.Resolve(context.Background(), "two.country")
+	require.Nil(t, err, "Failed to resolve name")
+	assert.Equal(t, int32(4), atomic.LoadInt32(lookups))
+
+	_, err = NewCachingResolver(newStubBackend(), 0)
+	assert.EqualError(t, err, "cache size must be positive")
+}
+
+func TestCachingResolverInvalidation(t *testing.T) {
+	resolver, backend, lookups := cachingResolverTest(t, 10, "cache.country")
+	node, err := NameHash("cache.country")
+	require.Nil(t, err, "Failed to hash name")
+	resolve := func() {
+		_, err := resolver.Resolve(context.Background(), "cache.country")
+		require.Nil(t, err, "Failed to resolve name")
+		text, err := resolver.Text(context.Background(), "cache.country", "url")
+		require.Nil(t, err, "Failed to obtain text")
+		assert.Equal(t, "https://cache.country", text)
+	}
+	resolve()
+	calls := backend.calls
+
+	// Changes to other records leave the address cached
+	log := indexerTestLog(t, publicresolver.ContractMetaData, stubResolver, 100, 0, "TextChanged", node, "email", "email", "a@example.com")
+	resolver.ApplyLog(&log)
+	log = indexerTestLog(t, publicresolver.ContractMetaData, stubResolver, 100, 1, "AddressChanged", node, big.NewInt(0), []byte{0x01})
+	resolver.ApplyLog(&log)
+	resolve()
+	assert.Equal(t, calls, backend.calls)
+
+	// Resolver events are only accepted from the resolver of the name
+	log = indexerTestLog(t, publicresolver.ContractMetaData, common.HexToAddress("0x99"), 100, 2, "AddrChanged", node, tconfig.testAccounts.bobAddress)
+	resolver.ApplyLog(&log)
+	resolve()
+	assert.Equal(t, calls, backend.calls)
+
+	log = indexerTestLog(t, publicresolver.ContractMetaData, stubResolver, 100, 2, "AddrChanged", node, tconfig.testAccounts.bobAddress)
+	resolver.ApplyLog(&log)
+	resolve()
+	assert.Equal(t, int32(2), atomic.LoadInt32(lookups))
+	assert.Greater(t, backend.calls, calls)
+	calls = backend.calls
+
+	// Registry events are only accepted from the registry
+	log = indexerTestLog(t, registry.ContractMetaData, stubResolver, 100, 3, "NewResolver", node, stubResolver)
+	resolver.ApplyLog(&log)
+	resolve()
+	assert.Equal(t, calls, backend.calls)
+
+	// A new resolver invalidates all records of the name
+	log = indexerTestLog(t, registry.ContractMetaData, config.Registry, 100, 4, "NewResolver", node, stubResolver)
+	resolver.ApplyLog(&log)
+	resolve()
+	assert.Equal(t, int32(3), atomic.LoadInt32(lookups))
+	assert.Greater(t, backend.calls, calls)
+}
+
+func TestCachingResolverConcurrent(t *testing.T) {
+	resolver, backend, lookups := cachingResolverTest(t, 10, "cache.country")
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	backend.handle(stubResolver, publicresolver.ContractMetaData, "addr", func(args []interface{}) ([]interface{}, error) {
+		if cachingResolverProbe(args) {
+			return []interface{}{common.Address{}}, nil
+		}
+		atomic.AddInt32(lookups, 1)
+		started <- struct{}{}
+		<-release
+		return []interface{}{tconfig.testAccounts.aliceAddress}, nil
+	})
+
+	var wg sync.WaitGroup
+	results := make([]common.Address, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			address, err := resolver.Resolve(context.Background(), "cache.country")
+			assert.Nil(t, err, "Failed to resolve name")
+			results[i] = address
+		}(i)
+	}
+	<-started
+	// Give the other lookups time to join the one in flight
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(lookups))
+	for _, address := range results {
+		assert.Equal(t, tconfig.testAccounts.aliceAddress, address)
+	}
+}
+
+func TestCachingResolverCancel(t *testing.T) {
+	resolver, backend, lookups := cachingResolverTest(t, 10, "cache.country")
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	backend.handle(stubResolver, publicresolver.ContractMetaData, "addr", func(args []interface{}) ([]interface{}, error) {
+		if cachingResolverProbe(args) {
+			return []interface{}{common.Address{}}, nil
+		}
+		atomic.AddInt32(lookups, 1)
+		started <- struct{}{}
+		<-release
+		return []interface{}{tconfig.testAccounts.aliceAddress}, nil
+	})
+
+	// The first caller starts the lookup, then gives up on it
+	ctx, cancel := context.WithCancel(context.Background())
+	leader := make(chan error, 1)
+	go func() {
+		_, err := resolver.Resolve(ctx, "cache.country")
+		leader <- err
+	}()
+	<-started
+	follower := make(chan common.Address, 1)
+	go func() {
+		address, err := resolver.Resolve(context.Background(), "cache.country")
+		assert.Nil(t, err, "Failed to resolve name")
+		follower <- address
+	}()
+	// Give the second lookup time to join the one in flight
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-leader, context.Canceled)
+
+	// The second caller still obtains the address from the shared lookup
+	close(release)
+	assert.Equal(t, tconfig.testAccounts.aliceAddress, <-follower)
+	assert.Equal(t, int32(1), atomic.LoadInt32(lookups))
+}
+
+func TestCachingResolverInFlight(t *testing.T) {
+	resolver, backend, lookups := cachingResolverTest(t, 10, "cache.country")
+	node, err := NameHash("cache.country")
+	require.Nil(t, err, "Failed to hash name")
+	other, err := NameHash("other.country")
+	require.Nil(t, err, "Failed to hash name")
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	backend.handle(stubResolver, publicresolver.ContractMetaData, "addr", func(args []interface{}) ([]interface{}, error) {
+		if cachingResolverProbe(args) {
+			return []interface{}{common.Address{}}, nil
+		}
+		atomic.AddInt32(lookups, 1)
+		started <- struct{}{}
+		<-release
+		return []interface{}{tconfig.testAccounts.aliceAddress}, nil
+	})
+	resolveWhile := func(change common.Hash) {
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, err := resolver.Resolve(context.Background(), "cache.country")
+			assert.Nil(t, err, "Failed to resolve name")
+		}()
+		<-started
+		log := indexerTestLog(t, publicresolver.ContractMetaData, stubResolver, 100, 0, "AddrChanged", change, tconfig.testAccounts.bobAddress)
+		resolver.ApplyLog(&log)
+		release <- struct{}{}
+		<-done
+	}
+
+	// A change to the name while it is being looked up stops the result
+	// being cached
+	resolveWhile(node)
+	resolveWhile(other)
+	assert.Equal(t, int32(2), atomic.LoadInt32(lookups))
+
+	// A change to another name does not
+	_, err = resolver.Resolve(context.Background(), "cache.country")
+	require.Nil(t, err, "Failed to resolve name")
+	assert.Equal(t, int32(2), atomic.LoadInt32(lookups))
+	assert.Empty(t, resolver.lookups)
+}
@@ -0,0 +1,168 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/params"
+	onens "github.com/jw-1ns/go-1ns"
+	"github.com/jw-1ns/go-1ns/util"
+)
+
+// provision creates and updates subdomains from a manifest.
+func provision(args []string) error {
+	flags := flag.NewFlagSet("provision", flag.ExitOnError)
+	rpc := flags.String("rpc", os.Getenv("ONENS_RPC"), "URL of the RPC endpoint (or set ONENS_RPC)")
+	manifestPath := flags.String("manifest", "", "path to the manifest, in CSV or JSON format")
+	parent := flags.String("parent", "", "name under which the subdomains sit (required for CSV manifests)")
+	keyHex := flags.String("key", os.Getenv("ONENS_PRIVATE_KEY"), "hex private key of the controller of the parent (or set ONENS_PRIVATE_KEY)")
+	keystorePath := flags.String("keystore", "", "path to the encrypted keystore of the controller of the parent, unlocked with ONENS_KEYSTORE_PASSPHRASE")
+	clefURL := flags.String("clef", "", "URL of a Clef-compatible external signer, signing for the address given by -from")
+	fromHex := flags.String("from", "", "address of the controller of the parent, when signing with -clef")
+	progressPath := flags.String("progress", "", "path of the progress file (defaults to the manifest path with .progress appended)")
+	dryRun := flags.Bool("dry-run", false, "show the transactions that would be sent without sending them")
+	maxFee := flags.Uint64("max-fee", 0, "maximum fee per gas in gwei (defaults to no maximum)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *rpc == "" {
+		return errors.New("no RPC endpoint supplied")
+	}
+	if *manifestPath == "" {
+		return errors.New("no manifest supplied")
+	}
+	if *progressPath == "" {
+		*progressPath = *manifestPath + ".progress"
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	signer, err := newSigner(ctx, *keyHex, *keystorePath, *clefURL, *fromHex)
+	if err != nil {
+		return err
+	}
+	from := signer.Address()
+
+	client, err := ethclient.DialContext(ctx, *rpc)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	chainID, err := client.ChainID(ctx)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := onens.LoadManifest(*manifestPath, *parent)
+	if err != nil {
+		return err
+	}
+	provisioner, err := onens.NewProvisioner(client, manifest)
+	if err != nil {
+		return err
+	}
+	plan, err := provisioner.Plan(ctx, from)
+	if err != nil {
+		return err
+	}
+	if len(plan.Steps) == 0 {
+		fmt.Printf("%d subdomains of %s up to date\n", len(manifest.Subdomains), manifest.Parent)
+		return nil
+	}
+	for _, step := range plan.Steps {
+		fmt.Printf("%s: %s\n", step.Name, step.Description)
+	}
+	if *dryRun {
+		fmt.Printf("%d transactions required\n", len(plan.Steps))
+		return nil
+	}
+
+	progress, err := onens.LoadProvisionProgress(*progressPath)
+	if err != nil {
+		return err
+	}
+	// Steps sent by an earlier run are not sent again
+	unsent := 0
+	for _, step := range plan.Steps {
+		if progress.Steps[step.ID] == nil {
+			unsent++
+		}
+	}
+	if provisioner.Policy, err = txPolicy(ctx, client, *maxFee); err != nil {
+		return err
+	}
+	if err := provisioner.Execute(ctx, util.NewTransactOpts(ctx, signer, chainID), plan, progress); err != nil {
+		return fmt.Errorf("%v (progress saved to %s; run again to resume)", err, *progressPath)
+	}
+	fmt.Printf("%d transactions sent\n", unsent)
+	// The run is complete, so the progress is no longer needed
+	if err := os.Remove(*progressPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// newSigner creates the signer given by the flags.
+func newSigner(ctx context.Context, keyHex string, keystorePath string, clefURL string, fromHex string) (util.Signer, error) {
+	switch {
+	case keystorePath != "":
+		return util.NewKeystoreSigner(keystorePath, os.Getenv("ONENS_KEYSTORE_PASSPHRASE"))
+	case clefURL != "":
+		if !common.IsHexAddress(fromHex) {
+			return nil, errors.New("no valid -from address supplied for the external signer")
+		}
+		return util.NewRemoteSigner(ctx, clefURL, common.HexToAddress(fromHex))
+	case keyHex != "":
+		key, err := crypto.HexToECDSA(strings.TrimPrefix(keyHex, "0x"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid private key: %v", err)
+		}
+		return util.NewPrivateKeySigner(key), nil
+	default:
+		return nil, errors.New("no private key, keystore or external signer supplied")
+	}
+}
+
+// txPolicy creates a policy that applies fees suited to the chain to each
+// transaction, capped at the maximum fee in gwei if it is not 0.
+func txPolicy(ctx context.Context, client *ethclient.Client, maxFee uint64) (*onens.TxPolicy, error) {
+	var maxFeeCap *big.Int
+	if maxFee != 0 {
+		maxFeeCap = new(big.Int).Mul(new(big.Int).SetUint64(maxFee), big.NewInt(params.GWei))
+	}
+	head, err := client.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	policy := &onens.TxPolicy{}
+	if head.BaseFee == nil {
+		policy.Fees = util.NewLegacyFeeStrategy(client, maxFeeCap)
+	} else {
+		policy.Fees = util.NewDynamicFeeStrategy(client, maxFeeCap)
+	}
+	return policy, nil
+}
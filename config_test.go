@@ -16,15 +16,131 @@
 package onens
 
 import (
+	"crypto/ecdsa"
+	"fmt"
+	"log"
 	"math/big"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/jw-1ns/go-1ns/contracts/baseregistrar"
 	"github.com/jw-1ns/go-1ns/contracts/registry"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
 )
 
+// Configuration
+type testAccounts struct {
+	deployerAddress     common.Address
+	deployerPrivateKey  *ecdsa.PrivateKey
+	operatorAAddress    common.Address
+	operatorAPrivateKey *ecdsa.PrivateKey
+	operatorBAddress    common.Address
+	operatorBPrivateKey *ecdsa.PrivateKey
+	operatorCAddress    common.Address
+	operatorCPrivateKey *ecdsa.PrivateKey
+	aliceAddress        common.Address
+	alicePrivateKey     *ecdsa.PrivateKey
+	bobAddress          common.Address
+	bobPrivateKey       *ecdsa.PrivateKey
+	carolAddress        common.Address
+	carolPrivateKey     *ecdsa.PrivateKey
+	doraAddress         common.Address
+	doraPrivateKey      *ecdsa.PrivateKey
+	ernieAddress        common.Address
+	erniePrivateKey     *ecdsa.PrivateKey
+	fredAddress         common.Address
+	fredPrivateKey      *ecdsa.PrivateKey
+}
+
+// Test configuration Structure
+type tconfigStruct struct {
+	testAccounts
+	PriceOracle          common.Address
+	USDOracle            common.Address
+	Registry             common.Address
+	FIFSRegistrar        common.Address
+	ReverseRegistrar     common.Address
+	BaseRegistrar        common.Address
+	MetadataService      common.Address
+	NameWrapper          common.Address
+	RegistrarController  common.Address
+	PublicResolver       common.Address
+	UniversalResolver    common.Address
+	Registrant           common.Address
+	Expiry               time.Time
+	RegistrationInterval time.Duration
+	clientURL            string
+	chainID              int64
+	client               *ethclient.Client
+	TLD                  string
+	duration             *big.Int
+}
+
+var tconfig *tconfigStruct = getTConfig()
+var tclient *ethclient.Client = tconfig.client
+
+// Get Test Configuration
+func getTConfig() *tconfigStruct {
+	tconfig := &tconfigStruct{}
+	// Read test config from environment file
+	viper.SetConfigFile(".env")
+	viper.ReadInConfig()
+	// set test accounts
+	tconfig.testAccounts.deployerAddress = common.HexToAddress(viper.GetString("TEST_ADDRESS_DEPLOYER"))
+	tconfig.testAccounts.deployerPrivateKey, _ = crypto.HexToECDSA(viper.GetString("TEST_PRIVATE_KEY_DEPLOYER"))
+	tconfig.testAccounts.operatorAAddress = common.HexToAddress(viper.GetString("TEST_ADDRESS_OPEATORA"))
+	tconfig.testAccounts.operatorAPrivateKey, _ = crypto.HexToECDSA(viper.GetString("TEST_PRIVATE_KEY_OPERATORA"))
+	tconfig.testAccounts.operatorBAddress = common.HexToAddress(viper.GetString("TEST_ADDRESS_OPERATORB"))
+	tconfig.testAccounts.operatorBPrivateKey, _ = crypto.HexToECDSA(viper.GetString("TEST_PRIVATE_KEY_OPERATORB"))
+	tconfig.testAccounts.operatorCAddress = common.HexToAddress(viper.GetString("TEST_ADDRESS_OPERATORC"))
+	tconfig.testAccounts.operatorCPrivateKey, _ = crypto.HexToECDSA(viper.GetString("TEST_PRIVATE_KEY_OPERATORC"))
+	tconfig.testAccounts.aliceAddress = common.HexToAddress(viper.GetString("TEST_ADDRESS_ALICE"))
+	tconfig.testAccounts.alicePrivateKey, _ = crypto.HexToECDSA(viper.GetString("TEST_PRIVATE_KEY_ALICE"))
+	tconfig.testAccounts.bobAddress = common.HexToAddress(viper.GetString("TEST_ADDRESS_BOB"))
+	tconfig.testAccounts.bobPrivateKey, _ = crypto.HexToECDSA(viper.GetString("TEST_PRIVATE_KEY_BOB"))
+	tconfig.testAccounts.carolAddress = common.HexToAddress(viper.GetString("TEST_ADDRESS_CAROL"))
+	tconfig.testAccounts.carolPrivateKey, _ = crypto.HexToECDSA(viper.GetString("TEST_PRIVATE_KEY_CAROL"))
+	tconfig.testAccounts.doraAddress = common.HexToAddress(viper.GetString("TEST_ADDRESS_DORA"))
+	tconfig.testAccounts.doraPrivateKey, _ = crypto.HexToECDSA(viper.GetString("TEST_PRIVATE_KEY_DORA"))
+	tconfig.testAccounts.ernieAddress = common.HexToAddress(viper.GetString("TEST_ADDRESS_ERNIE"))
+	tconfig.testAccounts.erniePrivateKey, _ = crypto.HexToECDSA(viper.GetString("TEST_PRIVATE_KEY_FRANK"))
+	tconfig.testAccounts.fredAddress = common.HexToAddress(viper.GetString("TEST_ADDRESS_FRED"))
+	tconfig.testAccounts.fredPrivateKey, _ = crypto.HexToECDSA(viper.GetString("TEST_PRIVATE_KEY_ERNIE"))
+	// set additional test configuration
+	tconfig.PriceOracle = common.HexToAddress(viper.GetString("TEST_PRICE_ORACLE"))
+	tconfig.USDOracle = common.HexToAddress(viper.GetString("TEST_USD_ORACLE"))
+	tconfig.Registry = common.HexToAddress(viper.GetString("TEST_ENS_REGISTRY"))
+	tconfig.FIFSRegistrar = common.HexToAddress(viper.GetString("TEST_FIFS_REGISTRAR"))
+	tconfig.ReverseRegistrar = common.HexToAddress(viper.GetString("TEST_REVERSE_REGISTRAR"))
+	tconfig.BaseRegistrar = common.HexToAddress(viper.GetString("TEST_BASE_REGISTRAR"))
+	tconfig.MetadataService = common.HexToAddress(viper.GetString("TEST_METADATA_SERVICE"))
+	tconfig.NameWrapper = common.HexToAddress(viper.GetString("TEST_NAME_WRAPPER"))
+	tconfig.RegistrarController = common.HexToAddress(viper.GetString("TEST_REGISTRAR_CONTROLLER"))
+	tconfig.PublicResolver = common.HexToAddress(viper.GetString("TEST_PUBLIC_RESOLVER"))
+	tconfig.UniversalResolver = common.HexToAddress(viper.GetString("TEST_UNIVERSAL_RESOLVER"))
+	tconfig.Expiry = time.Unix(viper.GetInt64("TEST_EXPIRY"), 0)
+	tconfig.RegistrationInterval = viper.GetDuration("TEST_REGISTRATION_INTERVAL") * time.Second
+	tconfig.clientURL = viper.GetString("TEST_CLIENT_URL")
+	tconfig.chainID = viper.GetInt64("TEST_CHAIN_ID")
+	client, err := ethclient.Dial(tconfig.clientURL)
+	if err != nil {
+		fmt.Println(err)
+		fmt.Println("Unable to connect to Ethereum Client")
+		fmt.Println(tconfig.clientURL)
+		os.Exit(1)
+		log.Fatal(err)
+	}
+	tconfig.client = client
+	tconfig.TLD = viper.GetString("TLD")
+	tconfig.duration = big.NewInt(viper.GetInt64("TEST_DURATION"))
+	return tconfig
+}
+
 func TestConfig(t *testing.T) {
 	// config := getConfig()
 	// Test we can connect to the client
@@ -15,8 +15,13 @@
 package onens
 
 import (
+	"context"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"math"
 	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
@@ -35,27 +40,37 @@ type DNSResolver struct {
 
 // NewDNSResolver creates a new DNS resolver for a given domain
 func NewDNSResolver(backend bind.ContractBackend, domain string) (*DNSResolver, error) {
+	return NewDNSResolverCtx(context.Background(), backend, domain)
+}
+
+// NewDNSResolverCtx is as per NewDNSResolver, with a context.
+func NewDNSResolverCtx(ctx context.Context, backend bind.ContractBackend, domain string) (*DNSResolver, error) {
 	registry, err := NewRegistry(backend)
 	if err != nil {
 		return nil, err
 	}
-	address, err := registry.ResolverAddress(domain)
+	address, err := registry.ResolverAddressCtx(ctx, domain)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewDNSResolverAt(backend, domain, address)
+	return NewDNSResolverAtCtx(ctx, backend, domain, address)
 }
 
 // NewDNSResolverAt creates a new DNS resolver for a given domain at a given address
 func NewDNSResolverAt(backend bind.ContractBackend, domain string, address common.Address) (*DNSResolver, error) {
+	return NewDNSResolverAtCtx(context.Background(), backend, domain, address)
+}
+
+// NewDNSResolverAtCtx is as per NewDNSResolverAt, with a context.
+func NewDNSResolverAtCtx(ctx context.Context, backend bind.ContractBackend, domain string, address common.Address) (*DNSResolver, error) {
 	contract, err := publicresolver.NewContract(address, backend)
 	if err != nil {
 		return nil, err
 	}
 
 	// Ensure that this is a DNS resolver
-	supported, err := contract.SupportsInterface(nil, [4]byte{0xa8, 0xfa, 0x56, 0x82})
+	supported, err := contract.SupportsInterface(&bind.CallOpts{Context: ctx}, [4]byte{0xa8, 0xfa, 0x56, 0x82})
 	if err != nil {
 		return nil, err
 	}
@@ -71,22 +86,100 @@ func NewDNSResolverAt(backend bind.ContractBackend, domain string, address commo
 	}, nil
 }
 
-// Record obtains an RRSet for a name
+// Record obtains an RRSet for a name.  The TTLs of the records are capped at
+// the registry TTL of the domain, if one is set.
 func (r *DNSResolver) Record(name string, rrType uint16) ([]byte, error) {
+	return r.RecordCtx(context.Background(), name, rrType)
+}
+
+// RecordCtx is as per Record, with a context.
+func (r *DNSResolver) RecordCtx(ctx context.Context, name string, rrType uint16) ([]byte, error) {
 	nameHash, err := NameHash(r.domain)
 	if err != nil {
 		return nil, err
 	}
-	return r.Contract.DnsRecord(nil, nameHash, DNSWireFormatDomainHash(name), rrType)
+	data, err := r.Contract.DnsRecord(&bind.CallOpts{Context: ctx}, nameHash, DNSWireFormatDomainHash(name), rrType)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := r.TTLCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if ttl == 0 {
+		return data, nil
+	}
+	// Record TTLs cannot exceed that of the largest uint32
+	seconds := uint64(ttl / time.Second)
+	if seconds > math.MaxUint32 {
+		seconds = math.MaxUint32
+	}
+	return capRRTTLs(data, uint32(seconds))
+}
+
+// TTL returns the registry TTL of the domain, which is the longest time for
+// which its records may be cached.
+func (r *DNSResolver) TTL() (time.Duration, error) {
+	return r.TTLCtx(context.Background())
+}
+
+// TTLCtx is as per TTL, with a context.
+func (r *DNSResolver) TTLCtx(ctx context.Context) (time.Duration, error) {
+	registry, err := NewRegistry(r.backend)
+	if err != nil {
+		return 0, err
+	}
+	return registry.TTLCtx(ctx, r.domain)
+}
+
+// capRRTTLs caps the TTL of each resource record in wire-format data.
+func capRRTTLs(data []byte, ttl uint32) ([]byte, error) {
+	res := make([]byte, len(data))
+	copy(res, data)
+	for offset := 0; offset < len(res); {
+		// Skip the owner name
+		for {
+			if offset >= len(res) {
+				return nil, errors.New("truncated resource record name")
+			}
+			length := int(res[offset])
+			if length == 0 {
+				offset++
+				break
+			}
+			if length&0xc0 == 0xc0 {
+				offset += 2
+				break
+			}
+			offset += 1 + length
+		}
+		// Type and class precede the TTL, which is followed by the data length
+		if offset+10 > len(res) {
+			return nil, errors.New("truncated resource record header")
+		}
+		if binary.BigEndian.Uint32(res[offset+4:offset+8]) > ttl {
+			binary.BigEndian.PutUint32(res[offset+4:offset+8], ttl)
+		}
+		offset += 10 + int(binary.BigEndian.Uint16(res[offset+8:offset+10]))
+		if offset > len(res) {
+			return nil, errors.New("truncated resource record data")
+		}
+	}
+	return res, nil
 }
 
 // HasRecords returns true if the given name has any RRsets
 func (r *DNSResolver) HasRecords(name string) (bool, error) {
+	return r.HasRecordsCtx(context.Background(), name)
+}
+
+// HasRecordsCtx is as per HasRecords, with a context.
+func (r *DNSResolver) HasRecordsCtx(ctx context.Context, name string) (bool, error) {
 	nameHash, err := NameHash(r.domain)
 	if err != nil {
 		return false, err
 	}
-	return r.Contract.HasDNSRecords(nil, nameHash, DNSWireFormatDomainHash(name))
+	return r.Contract.HasDNSRecords(&bind.CallOpts{Context: ctx}, nameHash, DNSWireFormatDomainHash(name))
 }
 
 // SetRecords sets one or more RRSets
@@ -109,11 +202,16 @@ func (r *DNSResolver) ClearRecords(opts *bind.TransactOpts) (*types.Transaction,
 
 // Zonehash returns the zone hash of the domain
 func (r *DNSResolver) Zonehash() ([]byte, error) {
+	return r.ZonehashCtx(context.Background())
+}
+
+// ZonehashCtx is as per Zonehash, with a context.
+func (r *DNSResolver) ZonehashCtx(ctx context.Context) ([]byte, error) {
 	nameHash, err := NameHash(r.domain)
 	if err != nil {
 		return nil, err
 	}
-	return r.Contract.Zonehash(nil, nameHash)
+	return r.Contract.Zonehash(&bind.CallOpts{Context: ctx}, nameHash)
 }
 
 // SetZonehash sets the zone hash of the domain
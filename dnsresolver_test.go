@@ -1,5 +1,13 @@
 package onens
 
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
 // import (
 // 	"encoding/hex"
 // 	"testing"
@@ -137,3 +145,21 @@ package onens
 // 	assert.Equal(t, existingRec, arecTestBytes, "Failed to clear existing records")
 
 // }
+
+func TestDNSRecordTTLCap(t *testing.T) {
+	// Two A records for a.country, the second using a compressed name
+	data := []byte{
+		0x01, 'a', 0x07, 'c', 'o', 'u', 'n', 't', 'r', 'y', 0x00,
+		0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x0e, 0x10, 0x00, 0x04, 0x01, 0x02, 0x03, 0x04,
+		0xc0, 0x00,
+		0x00, 0x01, 0x00, 0x01, 0x00, 0x00, 0x00, 0x1e, 0x00, 0x04, 0x05, 0x06, 0x07, 0x08,
+	}
+	capped, err := capRRTTLs(data, 300)
+	require.Nil(t, err, "Failed to cap TTLs")
+	assert.Equal(t, uint32(300), binary.BigEndian.Uint32(capped[15:19]), "TTL above the cap should be lowered")
+	assert.Equal(t, uint32(30), binary.BigEndian.Uint32(capped[31:35]), "TTL below the cap should be unchanged")
+	assert.Equal(t, uint32(3600), binary.BigEndian.Uint32(data[15:19]), "Original data should be unchanged")
+
+	_, err = capRRTTLs(data[:23], 300)
+	assert.EqualError(t, err, "truncated resource record data")
+}
@@ -0,0 +1,319 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/jw-1ns/go-1ns/contracts/baseregistrar"
+	"github.com/jw-1ns/go-1ns/contracts/namewrapper"
+	"github.com/jw-1ns/go-1ns/contracts/publicresolver"
+	"github.com/jw-1ns/go-1ns/contracts/registrarcontroller"
+	"github.com/jw-1ns/go-1ns/contracts/registry"
+)
+
+var (
+	// ErrNotRegistered is returned when a name is not registered.
+	ErrNotRegistered = errors.New("not registered")
+	// ErrNotAuthorised is returned when the sender of a transaction is not
+	// allowed to carry it out.
+	ErrNotAuthorised = errors.New("not authorised")
+	// ErrNoResolver is returned when a name has no resolver.
+	ErrNoResolver = errors.New("no resolver")
+)
+
+// reasonError is an error with its own message that matches a sentinel error
+// with errors.Is.
+type reasonError struct {
+	err    error
+	reason string
+}
+
+func (e *reasonError) Error() string { return e.reason }
+func (e *reasonError) Unwrap() error { return e.err }
+
+// withReason returns an error with the given message that matches err.
+func withReason(err error, reason string) error {
+	return &reasonError{err: err, reason: reason}
+}
+
+// CommitmentTooNewError is returned by the registrar controller when a
+// registration is revealed before its commitment has matured.
+type CommitmentTooNewError struct {
+	Commitment [32]byte
+}
+
+func (e *CommitmentTooNewError) Error() string {
+	return fmt.Sprintf("commitment %#x is too new", e.Commitment)
+}
+
+// CommitmentTooOldError is returned by the registrar controller when a
+// registration is revealed after its commitment has expired.
+type CommitmentTooOldError struct {
+	Commitment [32]byte
+}
+
+func (e *CommitmentTooOldError) Error() string {
+	return fmt.Sprintf("commitment %#x is too old", e.Commitment)
+}
+
+// UnexpiredCommitmentExistsError is returned by the registrar controller
+// when a commitment is made that duplicates one still in force.
+type UnexpiredCommitmentExistsError struct {
+	Commitment [32]byte
+}
+
+func (e *UnexpiredCommitmentExistsError) Error() string {
+	return fmt.Sprintf("unexpired commitment %#x exists", e.Commitment)
+}
+
+// DurationTooShortError is returned by the registrar controller when a
+// registration is for less than the minimum duration, in seconds.
+type DurationTooShortError struct {
+	Duration *big.Int
+}
+
+func (e *DurationTooShortError) Error() string {
+	return fmt.Sprintf("duration of %v seconds is too short", e.Duration)
+}
+
+// InsufficientValueError is returned by the registrar controller when the
+// value sent does not cover the cost of registration or renewal.
+type InsufficientValueError struct{}
+
+func (e *InsufficientValueError) Error() string {
+	return "insufficient value supplied"
+}
+
+// NameNotAvailableError is returned by the registrar controller when a name
+// cannot be registered.
+type NameNotAvailableError struct {
+	Name string
+}
+
+func (e *NameNotAvailableError) Error() string {
+	return fmt.Sprintf("%s is not available", e.Name)
+}
+
+// UnauthorisedError is returned by the registrar controller and name wrapper
+// when the sender cannot manage a node.  Address is only supplied by the
+// name wrapper.  It matches ErrNotAuthorised.
+type UnauthorisedError struct {
+	Node    [32]byte
+	Address common.Address
+}
+
+func (e *UnauthorisedError) Error() string {
+	if e.Address == UnknownAddress {
+		return fmt.Sprintf("not authorised for node %#x", e.Node)
+	}
+	return fmt.Sprintf("%s not authorised for node %#x", e.Address.Hex(), e.Node)
+}
+
+// Is allows UnauthorisedError to match ErrNotAuthorised.
+func (e *UnauthorisedError) Is(target error) bool {
+	return target == ErrNotAuthorised
+}
+
+// OperationProhibitedError is returned by the name wrapper when a burned fuse
+// prevents an operation on a node.
+type OperationProhibitedError struct {
+	Node [32]byte
+}
+
+func (e *OperationProhibitedError) Error() string {
+	return fmt.Sprintf("operation prohibited by fuses of node %#x", e.Node)
+}
+
+// RevertError is a revert with a reason string.
+type RevertError struct {
+	Reason string
+}
+
+func (e *RevertError) Error() string {
+	return "execution reverted: " + e.Reason
+}
+
+// ContractError is a custom error from a contract that has no specific type.
+type ContractError struct {
+	Name string
+	Args []interface{}
+}
+
+func (e *ContractError) Error() string {
+	if len(e.Args) == 0 {
+		return e.Name
+	}
+	args := make([]string, len(e.Args))
+	for i, arg := range e.Args {
+		args[i] = fmt.Sprintf("%v", arg)
+	}
+	return fmt.Sprintf("%s(%s)", e.Name, strings.Join(args, ", "))
+}
+
+// TxFailedError is a transaction that was mined but failed.  Reason is the
+// decoded reason for the failure, if it could be obtained by replaying the
+// transaction.
+type TxFailedError struct {
+	Receipt *types.Receipt
+	Reason  error
+}
+
+func (e *TxFailedError) Error() string {
+	if e.Reason == nil {
+		return fmt.Sprintf("transaction %s failed", e.Receipt.TxHash.Hex())
+	}
+	return fmt.Sprintf("transaction %s failed: %v", e.Receipt.TxHash.Hex(), e.Reason)
+}
+
+func (e *TxFailedError) Unwrap() error {
+	return e.Reason
+}
+
+// contractMetadata returns the metadata of the 1ns contracts.
+func contractMetadata() []*bind.MetaData {
+	return []*bind.MetaData{
+		registry.ContractMetaData,
+		baseregistrar.ContractMetaData,
+		registrarcontroller.ContractMetaData,
+		namewrapper.ContractMetaData,
+		publicresolver.ContractMetaData,
+	}
+}
+
+var (
+	contractErrorsOnce sync.Once
+	contractErrors     map[[4]byte]abi.Error
+)
+
+// knownContractErrors returns the custom errors of all contracts, by selector.
+func knownContractErrors() map[[4]byte]abi.Error {
+	contractErrorsOnce.Do(func() {
+		contractErrors = make(map[[4]byte]abi.Error)
+		for _, metadata := range contractMetadata() {
+			parsed, err := metadata.GetAbi()
+			if err != nil {
+				continue
+			}
+			for _, contractError := range parsed.Errors {
+				var selector [4]byte
+				copy(selector[:], contractError.ID[:4])
+				contractErrors[selector] = contractError
+			}
+		}
+	})
+	return contractErrors
+}
+
+// DecodeError decodes the revert data of a failed call or transaction into a
+// typed error, using the custom errors of the 1ns contracts and standard
+// revert reasons.  Errors without
+// revert data, or with revert data that cannot be decoded, are returned
+// unchanged.
+func DecodeError(err error) error {
+	if err == nil {
+		return nil
+	}
+	data := revertData(err)
+	if len(data) < 4 {
+		return err
+	}
+	if reason, unpackErr := abi.UnpackRevert(data); unpackErr == nil {
+		return &RevertError{Reason: reason}
+	}
+	var selector [4]byte
+	copy(selector[:], data[:4])
+	contractError, exists := knownContractErrors()[selector]
+	if !exists {
+		return err
+	}
+	unpacked, unpackErr := contractError.Unpack(data)
+	if unpackErr != nil {
+		return err
+	}
+	args, _ := unpacked.([]interface{})
+	return typedContractError(contractError.Name, args)
+}
+
+// typedContractError creates the typed error for a decoded custom error.
+func typedContractError(name string, args []interface{}) error {
+	switch name {
+	case "CommitmentTooNew":
+		return &CommitmentTooNewError{Commitment: args[0].([32]byte)}
+	case "CommitmentTooOld":
+		return &CommitmentTooOldError{Commitment: args[0].([32]byte)}
+	case "UnexpiredCommitmentExists":
+		return &UnexpiredCommitmentExistsError{Commitment: args[0].([32]byte)}
+	case "DurationTooShort":
+		return &DurationTooShortError{Duration: args[0].(*big.Int)}
+	case "InsufficientValue":
+		return &InsufficientValueError{}
+	case "NameNotAvailable":
+		return &NameNotAvailableError{Name: args[0].(string)}
+	case "Unauthorised":
+		res := &UnauthorisedError{Node: args[0].([32]byte)}
+		if len(args) > 1 {
+			res.Address = args[1].(common.Address)
+		}
+		return res
+	case "OperationProhibited":
+		return &OperationProhibitedError{Node: args[0].([32]byte)}
+	default:
+		return &ContractError{Name: name, Args: args}
+	}
+}
+
+// revertData obtains the revert data carried by an error, if any.
+func revertData(err error) []byte {
+	var dataErr rpc.DataError
+	if !errors.As(err, &dataErr) {
+		return nil
+	}
+	switch data := dataErr.ErrorData().(type) {
+	case []byte:
+		return data
+	case string:
+		decoded, err := hexutil.Decode(data)
+		if err != nil {
+			return nil
+		}
+		return decoded
+	default:
+		return nil
+	}
+}
+
+// isReverted returns true if the error is the result of a call reverting.
+func isReverted(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, vm.ErrExecutionReverted) || revertData(err) != nil {
+		return true
+	}
+	// Remote nodes return reverts without data as plain messages
+	return strings.HasPrefix(err.Error(), vm.ErrExecutionReverted.Error())
+}
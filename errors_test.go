@@ -0,0 +1,105 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/jw-1ns/go-1ns/contracts/namewrapper"
+	"github.com/jw-1ns/go-1ns/contracts/registrarcontroller"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// errorsTestDataError is an RPC error carrying revert data, as returned by
+// nodes for reverted calls.
+type errorsTestDataError struct {
+	data string
+}
+
+func (e *errorsTestDataError) Error() string          { return "execution reverted" }
+func (e *errorsTestDataError) ErrorData() interface{} { return e.data }
+
+// errorsTestRevert creates a revert error for a custom contract error.
+func errorsTestRevert(t *testing.T, metadata *bind.MetaData, name string, args ...interface{}) error {
+	parsed, err := metadata.GetAbi()
+	require.Nil(t, err, "Failed to parse ABI")
+	contractError, exists := parsed.Errors[name]
+	require.True(t, exists, "Unknown error")
+	packed, err := contractError.Inputs.Pack(args...)
+	require.Nil(t, err, "Failed to pack error")
+	return &errorsTestDataError{data: hexutil.Encode(append(contractError.ID[:4], packed...))}
+}
+
+func TestErrorsDecode(t *testing.T) {
+	commitment := [32]byte{0x01}
+	err := DecodeError(fmt.Errorf("failed: %w", errorsTestRevert(t, registrarcontroller.ContractMetaData, "CommitmentTooNew", commitment)))
+	var tooNew *CommitmentTooNewError
+	require.True(t, errors.As(err, &tooNew), "Failed to decode error")
+	assert.Equal(t, commitment, tooNew.Commitment)
+
+	err = DecodeError(errorsTestRevert(t, registrarcontroller.ContractMetaData, "DurationTooShort", big.NewInt(60)))
+	assert.EqualError(t, err, "duration of 60 seconds is too short")
+	err = DecodeError(errorsTestRevert(t, registrarcontroller.ContractMetaData, "NameNotAvailable", "taken"))
+	assert.EqualError(t, err, "taken is not available")
+	err = DecodeError(errorsTestRevert(t, registrarcontroller.ContractMetaData, "InsufficientValue"))
+	assert.IsType(t, &InsufficientValueError{}, err)
+
+	// Unauthorised is defined differently by the controller and wrapper
+	err = DecodeError(errorsTestRevert(t, namewrapper.ContractMetaData, "Unauthorised", commitment, tconfig.testAccounts.aliceAddress))
+	var unauthorised *UnauthorisedError
+	require.True(t, errors.As(err, &unauthorised), "Failed to decode error")
+	assert.Equal(t, tconfig.testAccounts.aliceAddress, unauthorised.Address)
+	assert.True(t, errors.Is(err, ErrNotAuthorised))
+	err = DecodeError(errorsTestRevert(t, registrarcontroller.ContractMetaData, "Unauthorised", commitment))
+	assert.True(t, errors.Is(err, ErrNotAuthorised))
+
+	err = DecodeError(errorsTestRevert(t, namewrapper.ContractMetaData, "LabelTooLong", "long"))
+	assert.EqualError(t, err, "LabelTooLong(long)")
+
+	// Standard revert reasons are encoded as Error(string)
+	selector := []byte{0x08, 0xc3, 0x79, 0xa0}
+	parsed, err := abi.NewType("string", "", nil)
+	require.Nil(t, err, "Failed to create type")
+	packed, err := abi.Arguments{{Type: parsed}}.Pack("too short")
+	require.Nil(t, err, "Failed to pack reason")
+	err = DecodeError(&errorsTestDataError{data: hexutil.Encode(append(selector, packed...))})
+	assert.EqualError(t, err, "execution reverted: too short")
+
+	// Errors that cannot be decoded are returned unchanged
+	plain := errors.New("VM Exception while processing transaction: revert")
+	assert.Equal(t, plain, DecodeError(plain))
+	unknown := &errorsTestDataError{data: "0x01020304"}
+	assert.Equal(t, unknown, DecodeError(unknown))
+	assert.Nil(t, DecodeError(nil))
+}
+
+func TestErrorsSentinels(t *testing.T) {
+	err := withReason(ErrNotRegistered, "unregistered name")
+	assert.EqualError(t, err, "unregistered name")
+	assert.True(t, errors.Is(err, ErrNotRegistered))
+	assert.False(t, errors.Is(err, ErrNotAuthorised))
+
+	assert.True(t, isReverted(errors.New("execution reverted")))
+	assert.True(t, isReverted(&errorsTestDataError{data: "0x"}))
+	assert.False(t, isReverted(errors.New("connection refused")))
+	assert.False(t, isReverted(nil))
+}
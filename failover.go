@@ -0,0 +1,524 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+)
+
+// FailoverClient is an endpoint of a failover backend, such as
+// ethclient.Client.
+type FailoverClient interface {
+	bind.ContractBackend
+	ethereum.TransactionReader
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+	FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error)
+	HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error)
+	CallContractAtHash(ctx context.Context, call ethereum.CallMsg, blockHash common.Hash) ([]byte, error)
+}
+
+// FailoverBackend is a contract backend over several endpoints, which can be
+// used anywhere a client is accepted.  Reads go to the first endpoint that
+// is neither cooling down after a failure nor behind the highest head seen,
+// moving on to the others on transient errors such as rate limiting, and
+// backing off once all of them have failed.
+//
+// The heads of endpoints are obtained by health checks, and otherwise only
+// when the latest header is requested, so Monitor() must be running for
+// endpoints that fall behind to be avoided.
+//
+// Sending transactions, and the calls whose answers depend on the pending
+// state of a node such as nonces, are sticky: they go to a single endpoint
+// until it fails, so that transactions are seen by the node that assigned
+// their nonces.
+type FailoverBackend struct {
+	// MaxRetries is the number of times a request is retried after
+	// transient errors, on the same or other endpoints
+	MaxRetries int
+	// Backoff is the delay before retrying once all endpoints have failed,
+	// doubling each time they all fail again
+	Backoff time.Duration
+	// Cooldown is the time for which an endpoint is avoided after a
+	// transient error, unless a health check finds it healthy
+	Cooldown time.Duration
+	// MaxLag is the number of blocks by which an endpoint can fall behind
+	// the highest head seen before it is avoided as stale
+	MaxLag uint64
+
+	mu        sync.Mutex
+	endpoints []*failoverEndpoint
+	writer    *failoverEndpoint
+	now       func() time.Time
+}
+
+// failoverEndpoint is an endpoint along with its health.
+type failoverEndpoint struct {
+	client    FailoverClient
+	head      uint64
+	failures  int
+	downUntil time.Time
+}
+
+// NewFailoverBackend creates a failover backend over the given clients, in
+// order of preference.  The heads of the clients are not known until
+// CheckHealth() or Monitor() is called.
+func NewFailoverBackend(clients ...FailoverClient) (*FailoverBackend, error) {
+	if len(clients) == 0 {
+		return nil, errors.New("no endpoints supplied")
+	}
+	endpoints := make([]*failoverEndpoint, len(clients))
+	for i, client := range clients {
+		endpoints[i] = &failoverEndpoint{client: client}
+	}
+	return &FailoverBackend{
+		MaxRetries: 4,
+		Backoff:    250 * time.Millisecond,
+		Cooldown:   30 * time.Second,
+		MaxLag:     10,
+		endpoints:  endpoints,
+		writer:     endpoints[0],
+		now:        time.Now,
+	}, nil
+}
+
+// DialFailover connects to the given RPC endpoints, in order of preference,
+// and creates a failover backend over them.  The health of the endpoints is
+// checked before it returns, failing if none are healthy.
+func DialFailover(ctx context.Context, urls ...string) (*FailoverBackend, error) {
+	clients := make([]FailoverClient, 0, len(urls))
+	for _, url := range urls {
+		client, err := ethclient.DialContext(ctx, url)
+		if err != nil {
+			for _, client := range clients {
+				client.(*ethclient.Client).Close()
+			}
+			return nil, errors.Wrapf(err, "failed to connect to %s", url)
+		}
+		clients = append(clients, client)
+	}
+	backend, err := NewFailoverBackend(clients...)
+	if err != nil {
+		return nil, err
+	}
+	if err := backend.CheckHealth(ctx); err != nil {
+		backend.Close()
+		return nil, err
+	}
+	return backend, nil
+}
+
+// Close closes the connections of endpoints that can be closed.
+func (f *FailoverBackend) Close() {
+	for _, endpoint := range f.endpoints {
+		if closer, isCloser := endpoint.client.(interface{ Close() }); isCloser {
+			closer.Close()
+		}
+	}
+}
+
+// CheckHealth obtains the head of each endpoint, marking those that fail as
+// cooling down and those that succeed as available.  It returns an error if
+// no endpoint is healthy.
+func (f *FailoverBackend) CheckHealth(ctx context.Context) error {
+	var wg sync.WaitGroup
+	healthy := make([]bool, len(f.endpoints))
+	for i, endpoint := range f.endpoints {
+		wg.Add(1)
+		go func(i int, endpoint *failoverEndpoint) {
+			defer wg.Done()
+			header, err := endpoint.client.HeaderByNumber(ctx, nil)
+			if err != nil {
+				f.failed(endpoint)
+				return
+			}
+			f.succeeded(endpoint, header)
+			healthy[i] = true
+		}(i, endpoint)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	for _, isHealthy := range healthy {
+		if isHealthy {
+			return nil
+		}
+	}
+	return errors.New("no healthy endpoints")
+}
+
+// Monitor checks the health of the endpoints at the given interval, until
+// the context is cancelled.
+func (f *FailoverBackend) Monitor(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		// Failures are recorded against the endpoints, so need no handling here
+		_ = f.CheckHealth(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// CodeAt obtains the code of a contract.
+func (f *FailoverBackend) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	var res []byte
+	err := f.read(ctx, func(client FailoverClient) (err error) {
+		res, err = client.CodeAt(ctx, contract, blockNumber)
+		return
+	})
+	return res, err
+}
+
+// CallContract makes a call.
+func (f *FailoverBackend) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	var res []byte
+	err := f.read(ctx, func(client FailoverClient) (err error) {
+		res, err = client.CallContract(ctx, call, blockNumber)
+		return
+	})
+	return res, err
+}
+
+// CallContractAtHash makes a call at the block with the given hash.
+func (f *FailoverBackend) CallContractAtHash(ctx context.Context, call ethereum.CallMsg, blockHash common.Hash) ([]byte, error) {
+	var res []byte
+	err := f.read(ctx, func(client FailoverClient) (err error) {
+		res, err = client.CallContractAtHash(ctx, call, blockHash)
+		return
+	})
+	return res, err
+}
+
+// HeaderByNumber obtains a header, recording the head of the endpoint if the
+// latest header is requested.
+func (f *FailoverBackend) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	var res *types.Header
+	endpoint, err := f.do(ctx, f.readOrder(), func(client FailoverClient) (err error) {
+		res, err = client.HeaderByNumber(ctx, number)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	if number == nil {
+		f.succeeded(endpoint, res)
+	}
+	return res, nil
+}
+
+// HeaderByHash obtains a header by its hash.
+func (f *FailoverBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	var res *types.Header
+	err := f.read(ctx, func(client FailoverClient) (err error) {
+		res, err = client.HeaderByHash(ctx, hash)
+		return
+	})
+	return res, err
+}
+
+// PendingCodeAt obtains the code of a contract in the pending state.
+func (f *FailoverBackend) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
+	var res []byte
+	err := f.write(ctx, func(client FailoverClient) (err error) {
+		res, err = client.PendingCodeAt(ctx, account)
+		return
+	})
+	return res, err
+}
+
+// PendingNonceAt obtains the nonce of an account in the pending state.
+func (f *FailoverBackend) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	var res uint64
+	err := f.write(ctx, func(client FailoverClient) (err error) {
+		res, err = client.PendingNonceAt(ctx, account)
+		return
+	})
+	return res, err
+}
+
+// NonceAt obtains the nonce of an account.
+func (f *FailoverBackend) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	var res uint64
+	err := f.read(ctx, func(client FailoverClient) (err error) {
+		res, err = client.NonceAt(ctx, account, blockNumber)
+		return
+	})
+	return res, err
+}
+
+// SuggestGasPrice suggests a gas price.
+func (f *FailoverBackend) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	var res *big.Int
+	err := f.read(ctx, func(client FailoverClient) (err error) {
+		res, err = client.SuggestGasPrice(ctx)
+		return
+	})
+	return res, err
+}
+
+// SuggestGasTipCap suggests a gas tip cap.
+func (f *FailoverBackend) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	var res *big.Int
+	err := f.read(ctx, func(client FailoverClient) (err error) {
+		res, err = client.SuggestGasTipCap(ctx)
+		return
+	})
+	return res, err
+}
+
+// FeeHistory obtains the fee history of recent blocks.
+func (f *FailoverBackend) FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error) {
+	var res *ethereum.FeeHistory
+	err := f.read(ctx, func(client FailoverClient) (err error) {
+		res, err = client.FeeHistory(ctx, blockCount, lastBlock, rewardPercentiles)
+		return
+	})
+	return res, err
+}
+
+// EstimateGas estimates the gas used by a call, against the same endpoint
+// as transactions are sent to.
+func (f *FailoverBackend) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	var res uint64
+	err := f.write(ctx, func(client FailoverClient) (err error) {
+		res, err = client.EstimateGas(ctx, call)
+		return
+	})
+	return res, err
+}
+
+// SendTransaction sends a transaction.  If a send is retried after the
+// transaction reached the node, the node reporting it as already known is
+// treated as success.
+func (f *FailoverBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	attempted := false
+	return f.write(ctx, func(client FailoverClient) error {
+		err := client.SendTransaction(ctx, tx)
+		if err != nil && attempted && strings.Contains(err.Error(), "already known") {
+			return nil
+		}
+		attempted = true
+		return err
+	})
+}
+
+// TransactionByHash obtains a transaction, asking the endpoint to which
+// transactions are sent first as it knows of pending transactions soonest.
+func (f *FailoverBackend) TransactionByHash(ctx context.Context, txHash common.Hash) (*types.Transaction, bool, error) {
+	var res *types.Transaction
+	var isPending bool
+	_, err := f.do(ctx, f.writeOrder(), func(client FailoverClient) (err error) {
+		res, isPending, err = client.TransactionByHash(ctx, txHash)
+		return
+	})
+	return res, isPending, err
+}
+
+// TransactionReceipt obtains the receipt of a transaction.
+func (f *FailoverBackend) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	var res *types.Receipt
+	err := f.read(ctx, func(client FailoverClient) (err error) {
+		res, err = client.TransactionReceipt(ctx, txHash)
+		return
+	})
+	return res, err
+}
+
+// FilterLogs obtains logs matching a query.
+func (f *FailoverBackend) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	var res []types.Log
+	err := f.read(ctx, func(client FailoverClient) (err error) {
+		res, err = client.FilterLogs(ctx, query)
+		return
+	})
+	return res, err
+}
+
+// SubscribeFilterLogs subscribes to logs matching a query, on the first
+// endpoint that accepts the subscription.  Subscriptions are not moved to
+// other endpoints if they later fail.
+func (f *FailoverBackend) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	var err error
+	for _, endpoint := range f.readOrder() {
+		var sub ethereum.Subscription
+		if sub, err = endpoint.client.SubscribeFilterLogs(ctx, query, ch); err == nil {
+			return sub, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+	return nil, err
+}
+
+// read makes a request against the endpoints in order of preference.
+func (f *FailoverBackend) read(ctx context.Context, fn func(client FailoverClient) error) error {
+	_, err := f.do(ctx, f.readOrder(), fn)
+	return err
+}
+
+// write makes a request against the sticky endpoint, moving the sticky
+// endpoint if the request succeeds elsewhere.
+func (f *FailoverBackend) write(ctx context.Context, fn func(client FailoverClient) error) error {
+	endpoint, err := f.do(ctx, f.writeOrder(), fn)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.writer = endpoint
+	f.mu.Unlock()
+	return nil
+}
+
+// do makes a request against the given endpoints, moving on to the next
+// endpoint after a transient error and backing off once all have failed.
+// It returns the endpoint that answered.
+func (f *FailoverBackend) do(ctx context.Context, order []*failoverEndpoint, fn func(client FailoverClient) error) (*failoverEndpoint, error) {
+	var err error
+	for attempt := 0; attempt <= f.MaxRetries; attempt++ {
+		if attempt > 0 && attempt%len(order) == 0 {
+			timer := time.NewTimer(f.Backoff << (attempt/len(order) - 1))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			}
+		}
+		endpoint := order[attempt%len(order)]
+		if err = fn(endpoint.client); err == nil || !isTransientError(err) {
+			// The endpoint answered, even if with an error of its own
+			f.succeeded(endpoint, nil)
+			return endpoint, err
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		f.failed(endpoint)
+	}
+	return nil, errors.Wrap(err, "all endpoints failed")
+}
+
+// readOrder returns the endpoints in the order in which to try reads:
+// available endpoints first, followed by those cooling down or stale in
+// case they are all that is left.
+func (f *FailoverBackend) readOrder() []*failoverEndpoint {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.order(nil)
+}
+
+// writeOrder returns the endpoints in the order in which to try writes: the
+// sticky endpoint first, followed by the others as per readOrder().
+func (f *FailoverBackend) writeOrder() []*failoverEndpoint {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]*failoverEndpoint{f.writer}, f.order(f.writer)...)
+}
+
+// order returns the endpoints other than the one excluded in order of
+// preference.  It must be called with the lock held.
+func (f *FailoverBackend) order(exclude *failoverEndpoint) []*failoverEndpoint {
+	now := f.now()
+	maxHead := uint64(0)
+	for _, endpoint := range f.endpoints {
+		if endpoint.head > maxHead {
+			maxHead = endpoint.head
+		}
+	}
+	available := make([]*failoverEndpoint, 0, len(f.endpoints))
+	unavailable := make([]*failoverEndpoint, 0)
+	for _, endpoint := range f.endpoints {
+		switch {
+		case endpoint == exclude:
+		case now.Before(endpoint.downUntil), endpoint.head != 0 && endpoint.head+f.MaxLag < maxHead:
+			unavailable = append(unavailable, endpoint)
+		default:
+			available = append(available, endpoint)
+		}
+	}
+	return append(available, unavailable...)
+}
+
+// succeeded marks an endpoint as available, recording its head if supplied.
+func (f *FailoverBackend) succeeded(endpoint *failoverEndpoint, head *types.Header) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	endpoint.failures = 0
+	endpoint.downUntil = time.Time{}
+	if head != nil && head.Number != nil {
+		endpoint.head = head.Number.Uint64()
+	}
+}
+
+// failed marks an endpoint as cooling down.
+func (f *FailoverBackend) failed(endpoint *failoverEndpoint) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	endpoint.failures++
+	endpoint.downUntil = f.now().Add(f.Cooldown)
+}
+
+// isTransientError returns true if an error is one that may not recur if
+// the request is retried, such as rate limiting or a dropped connection.
+func isTransientError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= http.StatusInternalServerError
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == -32005 {
+		// Limit exceeded
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	for _, transient := range []string{"rate limit", "too many requests", "header not found", "timeout"} {
+		if strings.Contains(msg, transient) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,264 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// failoverTestClient is a stub backend that fails its next requests with
+// the queued errors, and counts the requests made to it.
+type failoverTestClient struct {
+	*stubBackend
+	mu       sync.Mutex
+	errs     []error
+	requests int
+}
+
+func newFailoverTestClient(t *testing.T) *failoverTestClient {
+	alice := tconfig.testAccounts.aliceAddress
+	backend := newStubRegistry(t, map[string]*stubRegistryRecord{
+		"failover.country": {owner: alice, resolver: stubResolver, addr: alice},
+	})
+	return &failoverTestClient{stubBackend: backend}
+}
+
+// fail queues errors to be returned by the next requests.
+func (c *failoverTestClient) fail(errs ...error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.errs = append(c.errs, errs...)
+}
+
+// request counts a request, returning the next queued error if any.
+func (c *failoverTestClient) request() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests++
+	if len(c.errs) == 0 {
+		return nil
+	}
+	err := c.errs[0]
+	c.errs = c.errs[1:]
+	return err
+}
+
+func (c *failoverTestClient) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	if err := c.request(); err != nil {
+		return nil, err
+	}
+	return c.stubBackend.CallContract(ctx, call, blockNumber)
+}
+
+func (c *failoverTestClient) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	if err := c.request(); err != nil {
+		return nil, err
+	}
+	return c.stubBackend.HeaderByNumber(ctx, number)
+}
+
+func (c *failoverTestClient) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	if err := c.request(); err != nil {
+		return 0, err
+	}
+	return c.stubBackend.PendingNonceAt(ctx, account)
+}
+
+func (c *failoverTestClient) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	if err := c.request(); err != nil {
+		return err
+	}
+	return c.stubBackend.SendTransaction(ctx, tx)
+}
+
+// failoverTest creates a failover backend over the given number of clients,
+// with a clock that can be moved on by the test.
+func failoverTest(t *testing.T, count int) (*FailoverBackend, []*failoverTestClient, *time.Time) {
+	clients := make([]*failoverTestClient, count)
+	endpoints := make([]FailoverClient, count)
+	for i := range clients {
+		clients[i] = newFailoverTestClient(t)
+		endpoints[i] = clients[i]
+	}
+	backend, err := NewFailoverBackend(endpoints...)
+	require.Nil(t, err, "Failed to create failover backend")
+	backend.Backoff = time.Millisecond
+	now := time.Unix(1700000000, 0)
+	backend.now = func() time.Time { return now }
+	return backend, clients, &now
+}
+
+func TestFailoverReads(t *testing.T) {
+	backend, clients, now := failoverTest(t, 2)
+	clients[0].fail(rpc.HTTPError{StatusCode: 429, Status: "429 Too Many Requests"})
+
+	address, err := Resolve(backend, "failover.country")
+	require.Nil(t, err, "Failed to resolve name")
+	assert.Equal(t, tconfig.testAccounts.aliceAddress, address)
+	assert.Equal(t, 1, clients[0].requests)
+	assert.Greater(t, clients[1].requests, 0)
+
+	// The rate-limited endpoint is avoided until it has cooled down
+	requests := clients[1].requests
+	_, err = Resolve(backend, "failover.country")
+	require.Nil(t, err, "Failed to resolve name")
+	assert.Equal(t, 1, clients[0].requests)
+	assert.Equal(t, 2*requests, clients[1].requests)
+	*now = now.Add(backend.Cooldown)
+	_, err = Resolve(backend, "failover.country")
+	require.Nil(t, err, "Failed to resolve name")
+	assert.Equal(t, 1+requests, clients[0].requests)
+	assert.Equal(t, 2*requests, clients[1].requests)
+
+	// Errors from the chain itself are returned without retrying
+	clients[0].fail(errors.New("execution reverted"))
+	_, err = Resolve(backend, "failover.country")
+	assert.EqualError(t, err, "execution reverted")
+	assert.Equal(t, 2*requests, clients[1].requests)
+
+	_, err = NewFailoverBackend()
+	assert.EqualError(t, err, "no endpoints supplied")
+}
+
+func TestFailoverRetries(t *testing.T) {
+	backend, clients, _ := failoverTest(t, 2)
+	backend.MaxRetries = 3
+	clients[0].fail(io.EOF, io.EOF)
+	clients[1].fail(io.EOF)
+
+	// Both endpoints fail, so they are retried in turn after backing off
+	header, err := backend.HeaderByNumber(context.Background(), nil)
+	require.Nil(t, err, "Failed to obtain header")
+	assert.Equal(t, big.NewInt(100), header.Number)
+	assert.Equal(t, 2, clients[0].requests)
+	assert.Equal(t, 2, clients[1].requests)
+
+	clients[0].fail(io.EOF, io.EOF)
+	clients[1].fail(io.EOF, io.EOF)
+	_, err = backend.HeaderByNumber(context.Background(), nil)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, "all endpoints failed: EOF", err.Error())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	clients[0].fail(io.EOF, io.EOF)
+	clients[1].fail(io.EOF)
+	_, err = backend.HeaderByNumber(ctx, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestFailoverStaleHead(t *testing.T) {
+	backend, clients, _ := failoverTest(t, 2)
+	clients[0].head = 50
+	require.Nil(t, backend.CheckHealth(context.Background()), "Failed to check health")
+
+	// The first endpoint is behind, so reads go to the second
+	header, err := backend.HeaderByNumber(context.Background(), nil)
+	require.Nil(t, err, "Failed to obtain header")
+	assert.Equal(t, big.NewInt(100), header.Number)
+	assert.Equal(t, 1, clients[0].requests)
+	assert.Equal(t, 2, clients[1].requests)
+
+	// Once it has caught up it is preferred again
+	clients[0].head = 95
+	require.Nil(t, backend.CheckHealth(context.Background()), "Failed to check health")
+	_, err = backend.HeaderByNumber(context.Background(), nil)
+	require.Nil(t, err, "Failed to obtain header")
+	assert.Equal(t, 3, clients[0].requests)
+	assert.Equal(t, 3, clients[1].requests)
+
+	clients[0].fail(io.EOF)
+	clients[1].fail(io.EOF)
+	assert.EqualError(t, backend.CheckHealth(context.Background()), "no healthy endpoints")
+}
+
+func TestFailoverWrites(t *testing.T) {
+	backend, clients, now := failoverTest(t, 2)
+	alice := tconfig.testAccounts.aliceAddress
+	clients[0].nonces[alice] = 5
+	clients[1].nonces[alice] = 4
+
+	nonce, err := backend.PendingNonceAt(context.Background(), alice)
+	require.Nil(t, err, "Failed to obtain nonce")
+	assert.Equal(t, uint64(5), nonce)
+
+	// A failed send moves writes to the endpoint that accepted it, where they
+	// stay even once the first endpoint is available again
+	clients[0].fail(syscall.ECONNRESET)
+	tx := types.NewTx(&types.LegacyTx{Nonce: 5, GasPrice: big.NewInt(1), Gas: 21000})
+	require.Nil(t, backend.SendTransaction(context.Background(), tx), "Failed to send transaction")
+	assert.Len(t, clients[0].sent, 0)
+	assert.Len(t, clients[1].sent, 1)
+	*now = now.Add(backend.Cooldown)
+	nonce, err = backend.PendingNonceAt(context.Background(), alice)
+	require.Nil(t, err, "Failed to obtain nonce")
+	assert.Equal(t, uint64(4), nonce)
+
+	// A resent transaction that the node already has was sent successfully
+	clients[1].fail(io.ErrUnexpectedEOF, errors.New("already known"))
+	clients[0].fail(io.EOF)
+	require.Nil(t, backend.SendTransaction(context.Background(), tx), "Failed to send transaction")
+}
+
+func TestFailoverTransientErrors(t *testing.T) {
+	tests := []struct {
+		err       error
+		transient bool
+	}{
+		{nil, false},
+		{errors.New("execution reverted"), false},
+		{ethereum.NotFound, false},
+		{context.Canceled, false},
+		{fmt.Errorf("request failed: %w", context.DeadlineExceeded), false},
+		{rpc.HTTPError{StatusCode: 429}, true},
+		{rpc.HTTPError{StatusCode: 503}, true},
+		{rpc.HTTPError{StatusCode: 404}, false},
+		{io.EOF, true},
+		{fmt.Errorf("post: %w", syscall.ECONNREFUSED), true},
+		{&net.OpError{Op: "dial", Err: errors.New("no route to host")}, true},
+		{errors.New("header not found"), true},
+		{errors.New("Rate limit exceeded"), true},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.transient, isTransientError(test.err), fmt.Sprintf("%v", test.err))
+	}
+}
+
+func TestFailoverDial(t *testing.T) {
+	// An endpoint that refuses connections is found unhealthy on dialling
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err, "Failed to listen")
+	url := "http://" + listener.Addr().String()
+	require.Nil(t, listener.Close(), "Failed to close listener")
+
+	_, err = DialFailover(context.Background(), url)
+	assert.EqualError(t, err, "no healthy endpoints")
+}
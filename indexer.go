@@ -0,0 +1,930 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/jw-1ns/go-1ns/contracts/baseregistrar"
+	"github.com/jw-1ns/go-1ns/contracts/namewrapper"
+	"github.com/jw-1ns/go-1ns/contracts/publicresolver"
+	"github.com/jw-1ns/go-1ns/contracts/registrarcontroller"
+	"github.com/jw-1ns/go-1ns/contracts/registry"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Buckets used by the indexer database
+var (
+	indexerNamesBucket    = []byte("names")
+	indexerLabelsBucket   = []byte("labels")
+	indexerOwnersBucket   = []byte("owners")
+	indexerChildrenBucket = []byte("children")
+	indexerHistoryBucket  = []byte("history")
+	indexerMetaBucket     = []byte("meta")
+	indexerLastBlockKey   = []byte("lastBlock")
+)
+
+// defaultIndexerBlockRange is the number of blocks requested per log query
+// unless overridden.
+const defaultIndexerBlockRange = 5000
+
+// IndexerContracts are the contracts whose events are indexed.  They are
+// also the contracts from which events are read by WaitForRegistration(),
+// WaitForRenewal() and WaitForTransfer().
+type IndexerContracts struct {
+	// Domain is the top-level domain managed by the registrar, e.g. country
+	Domain        string
+	Registry      common.Address
+	BaseRegistrar common.Address
+	Controller    common.Address
+	NameWrapper   common.Address
+}
+
+// IndexedName is the indexer's view of a single node.
+type IndexedName struct {
+	// Name is the fully-qualified name, built from known labels
+	Name      string      `json:"name"`
+	Node      common.Hash `json:"node"`
+	Parent    common.Hash `json:"parent"`
+	LabelHash common.Hash `json:"labelHash"`
+	// Owner is the owner of the node in the registry
+	Owner common.Address `json:"owner"`
+	// Registrant is the owner of the registrar token, for second-level names
+	Registrant common.Address `json:"registrant"`
+	// WrappedOwner is the owner of the name wrapper token, for wrapped names
+	WrappedOwner common.Address `json:"wrappedOwner"`
+	Resolver     common.Address `json:"resolver"`
+	TTL          uint64         `json:"ttl"`
+	Fuses        uint32         `json:"fuses"`
+	// Expiry is the unix timestamp at which the registration expires
+	Expiry uint64 `json:"expiry"`
+}
+
+// Expires returns the expiry of the name as a time.
+func (n *IndexedName) Expires() time.Time {
+	return time.Unix(int64(n.Expiry), 0)
+}
+
+// NameEvent is a single entry in the history of a name.
+type NameEvent struct {
+	Node        common.Hash    `json:"node"`
+	Kind        string         `json:"kind"`
+	Contract    common.Address `json:"contract"`
+	BlockNumber uint64         `json:"blockNumber"`
+	TxHash      common.Hash    `json:"txHash"`
+	LogIndex    uint           `json:"logIndex"`
+	Owner       common.Address `json:"owner,omitempty"`
+	Resolver    common.Address `json:"resolver,omitempty"`
+	Expiry      uint64         `json:"expiry,omitempty"`
+	TTL         uint64         `json:"ttl,omitempty"`
+	Key         string         `json:"key,omitempty"`
+	Value       string         `json:"value,omitempty"`
+}
+
+// Indexer builds a local database of names, their owners, expiries and
+// record changes from registry, registrar, controller, name wrapper and
+// resolver events.
+type Indexer struct {
+	backend   bind.ContractBackend
+	db        *bolt.DB
+	contracts IndexerContracts
+	baseNode  common.Hash
+
+	registry   *registry.ContractFilterer
+	registrar  *baseregistrar.ContractFilterer
+	controller *registrarcontroller.ContractFilterer
+	wrapper    *namewrapper.ContractFilterer
+	resolver   *publicresolver.ContractFilterer
+
+	// StartBlock is the block from which indexing starts on an empty database
+	StartBlock uint64
+	// BlockRange is the maximum number of blocks requested in a single log query
+	BlockRange uint64
+}
+
+// NewIndexer opens (or creates) an indexer database at path for the given
+// top-level domain, obtaining the contract addresses from the chain.
+func NewIndexer(backend bind.ContractBackend, domain string, path string) (*Indexer, error) {
+	return NewIndexerCtx(context.Background(), backend, domain, path)
+}
+
+// NewIndexerCtx is as per NewIndexer, with a context.
+func NewIndexerCtx(ctx context.Context, backend bind.ContractBackend, domain string, path string) (*Indexer, error) {
+	contracts, err := DomainContractsCtx(ctx, backend, domain)
+	if err != nil {
+		return nil, err
+	}
+	return NewIndexerAt(backend, path, contracts)
+}
+
+// DomainContracts obtains the contracts of a top-level domain from the
+// chain.
+func DomainContracts(backend bind.ContractBackend, domain string) (IndexerContracts, error) {
+	return DomainContractsCtx(context.Background(), backend, domain)
+}
+
+// DomainContractsCtx is as per DomainContracts, with a context.
+func DomainContractsCtx(ctx context.Context, backend bind.ContractBackend, domain string) (IndexerContracts, error) {
+	registrar, err := NewBaseRegistrarCtx(ctx, backend, domain)
+	if err != nil {
+		return IndexerContracts{}, err
+	}
+	controller, err := NewRegistrarControllerCtx(ctx, backend, domain)
+	if err != nil {
+		return IndexerContracts{}, err
+	}
+	wrapper, err := controller.NameWrapperCtx(ctx)
+	if err != nil {
+		return IndexerContracts{}, err
+	}
+	return IndexerContracts{
+		Domain:        domain,
+		Registry:      config.Registry,
+		BaseRegistrar: registrar.ContractAddr,
+		Controller:    controller.ContractAddr,
+		NameWrapper:   wrapper,
+	}, nil
+}
+
+// NewIndexerAt opens (or creates) an indexer database at path for the given
+// contracts.
+func NewIndexerAt(backend bind.ContractBackend, path string, contracts IndexerContracts) (*Indexer, error) {
+	baseNode, err := NameHash(contracts.Domain)
+	if err != nil {
+		return nil, err
+	}
+	domainLabel, err := LabelHash(contracts.Domain)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{indexerNamesBucket, indexerLabelsBucket, indexerOwnersBucket, indexerChildrenBucket, indexerHistoryBucket, indexerMetaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		// Seed the top-level domain so that names below it can be built
+		// even if indexing starts after it was created.
+		if err := tx.Bucket(indexerLabelsBucket).Put(domainLabel[:], []byte(contracts.Domain)); err != nil {
+			return err
+		}
+		if tx.Bucket(indexerNamesBucket).Get(baseNode[:]) == nil {
+			return putIndexedName(tx, &IndexedName{Node: baseNode, LabelHash: domainLabel})
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	i := &Indexer{
+		backend:    backend,
+		db:         db,
+		contracts:  contracts,
+		baseNode:   baseNode,
+		BlockRange: defaultIndexerBlockRange,
+	}
+	// Filterers are only used to parse logs, so need no backend.
+	if i.registry, err = registry.NewContractFilterer(contracts.Registry, nil); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if i.registrar, err = baseregistrar.NewContractFilterer(contracts.BaseRegistrar, nil); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if i.controller, err = registrarcontroller.NewContractFilterer(contracts.Controller, nil); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if i.wrapper, err = namewrapper.NewContractFilterer(contracts.NameWrapper, nil); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if i.resolver, err = publicresolver.NewContractFilterer(common.Address{}, nil); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return i, nil
+}
+
+// Close closes the indexer database.
+func (i *Indexer) Close() error {
+	return i.db.Close()
+}
+
+// LastBlock returns the last block that has been indexed.
+func (i *Indexer) LastBlock() (uint64, error) {
+	var last uint64
+	err := i.db.View(func(tx *bolt.Tx) error {
+		if data := tx.Bucket(indexerMetaBucket).Get(indexerLastBlockKey); data != nil {
+			last = binary.BigEndian.Uint64(data)
+		}
+		return nil
+	})
+	return last, err
+}
+
+// AddLabels adds known labels, allowing names to be built for nodes whose
+// labels are not emitted by any event.
+func (i *Indexer) AddLabels(labels ...string) error {
+	return i.db.Update(func(tx *bolt.Tx) error {
+		for _, label := range labels {
+			if err := learnLabel(tx, label); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Sync indexes all events from the last indexed block to the current head,
+// returning the last block indexed.
+func (i *Indexer) Sync(ctx context.Context) (uint64, error) {
+	header, err := i.backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	head := header.Number.Uint64()
+
+	last, err := i.LastBlock()
+	if err != nil {
+		return 0, err
+	}
+	from := i.StartBlock
+	if last >= from {
+		from = last + 1
+	}
+	blockRange := i.BlockRange
+	if blockRange == 0 {
+		blockRange = defaultIndexerBlockRange
+	}
+
+	for from <= head {
+		to := from + blockRange - 1
+		if to > head {
+			to = head
+		}
+		if err := i.syncRange(ctx, from, to); err != nil {
+			return from - 1, err
+		}
+		from = to + 1
+	}
+	return head, nil
+}
+
+// syncRange indexes the events in the given (inclusive) block range.
+func (i *Indexer) syncRange(ctx context.Context, from uint64, to uint64) error {
+	query := ethereum.FilterQuery{
+		FromBlock: new(big.Int).SetUint64(from),
+		ToBlock:   new(big.Int).SetUint64(to),
+		Addresses: []common.Address{i.contracts.Registry, i.contracts.BaseRegistrar, i.contracts.Controller, i.contracts.NameWrapper},
+	}
+	logs, err := i.backend.FilterLogs(ctx, query)
+	if err != nil {
+		return errors.Wrap(err, "failed to obtain contract logs")
+	}
+
+	// Resolvers can live anywhere, so look for their events by topic alone
+	// and keep those for nodes that we know about.
+	query.Addresses = nil
+	query.Topics = [][]common.Hash{resolverEventTopics()}
+	resolverLogs, err := i.backend.FilterLogs(ctx, query)
+	if err != nil {
+		return errors.Wrap(err, "failed to obtain resolver logs")
+	}
+	logs = append(logs, resolverLogs...)
+
+	return i.indexLogs(logs, to)
+}
+
+// indexLogs applies logs to the database in chain order and records the
+// last block indexed.
+func (i *Indexer) indexLogs(logs []types.Log, lastBlock uint64) error {
+	sort.SliceStable(logs, func(a, b int) bool {
+		if logs[a].BlockNumber != logs[b].BlockNumber {
+			return logs[a].BlockNumber < logs[b].BlockNumber
+		}
+		return logs[a].Index < logs[b].Index
+	})
+
+	return i.db.Update(func(tx *bolt.Tx) error {
+		for j := range logs {
+			if logs[j].Removed || len(logs[j].Topics) == 0 {
+				continue
+			}
+			if err := i.applyLog(tx, &logs[j]); err != nil {
+				return errors.Wrapf(err, "failed to index log %d of transaction %s", logs[j].Index, logs[j].TxHash.Hex())
+			}
+		}
+		last := make([]byte, 8)
+		binary.BigEndian.PutUint64(last, lastBlock)
+		return tx.Bucket(indexerMetaBucket).Put(indexerLastBlockKey, last)
+	})
+}
+
+// applyLog updates the database for a single log.
+func (i *Indexer) applyLog(tx *bolt.Tx, log *types.Log) error {
+	switch log.Address {
+	case i.contracts.Registry:
+		return i.applyRegistryLog(tx, log)
+	case i.contracts.BaseRegistrar:
+		return i.applyRegistrarLog(tx, log)
+	case i.contracts.Controller:
+		return i.applyControllerLog(tx, log)
+	case i.contracts.NameWrapper:
+		return i.applyWrapperLog(tx, log)
+	default:
+		return i.applyResolverLog(tx, log)
+	}
+}
+
+func (i *Indexer) applyRegistryLog(tx *bolt.Tx, log *types.Log) error {
+	switch log.Topics[0] {
+	case registryEventID("NewOwner"):
+		event, err := i.registry.ParseNewOwner(*log)
+		if err != nil {
+			return err
+		}
+		node := subnode(event.Node, event.Label)
+		rec, err := getIndexedName(tx, node)
+		if err != nil {
+			return err
+		}
+		if rec == nil {
+			rec = &IndexedName{Node: node}
+			if err := tx.Bucket(indexerChildrenBucket).Put(append(event.Node[:], node[:]...), []byte{}); err != nil {
+				return err
+			}
+		}
+		rec.Parent = event.Node
+		rec.LabelHash = event.Label
+		rec.Owner = event.Owner
+		if err := putIndexedName(tx, rec); err != nil {
+			return err
+		}
+		return putNameEvent(tx, log, &NameEvent{Node: node, Kind: "NewOwner", Owner: event.Owner})
+	case registryEventID("Transfer"):
+		event, err := i.registry.ParseTransfer(*log)
+		if err != nil {
+			return err
+		}
+		return i.updateName(tx, log, event.Node, &NameEvent{Kind: "Transfer", Owner: event.Owner}, func(rec *IndexedName) {
+			rec.Owner = event.Owner
+		})
+	case registryEventID("NewResolver"):
+		event, err := i.registry.ParseNewResolver(*log)
+		if err != nil {
+			return err
+		}
+		return i.updateName(tx, log, event.Node, &NameEvent{Kind: "NewResolver", Resolver: event.Resolver}, func(rec *IndexedName) {
+			rec.Resolver = event.Resolver
+		})
+	case registryEventID("NewTTL"):
+		event, err := i.registry.ParseNewTTL(*log)
+		if err != nil {
+			return err
+		}
+		return i.updateName(tx, log, event.Node, &NameEvent{Kind: "NewTTL", TTL: event.Ttl}, func(rec *IndexedName) {
+			rec.TTL = event.Ttl
+		})
+	}
+	return nil
+}
+
+func (i *Indexer) applyRegistrarLog(tx *bolt.Tx, log *types.Log) error {
+	switch log.Topics[0] {
+	case registrarEventID("Transfer"):
+		event, err := i.registrar.ParseTransfer(*log)
+		if err != nil {
+			return err
+		}
+		node, err := i.tokenNode(tx, event.TokenId)
+		if err != nil {
+			return err
+		}
+		return i.updateName(tx, log, node, &NameEvent{Kind: "RegistrantTransfer", Owner: event.To}, func(rec *IndexedName) {
+			rec.Registrant = event.To
+		})
+	case registrarEventID("NameRegistered"):
+		event, err := i.registrar.ParseNameRegistered(*log)
+		if err != nil {
+			return err
+		}
+		node, err := i.tokenNode(tx, event.Id)
+		if err != nil {
+			return err
+		}
+		return i.updateName(tx, log, node, &NameEvent{Kind: "NameRegistered", Owner: event.Owner, Expiry: event.Expires.Uint64()}, func(rec *IndexedName) {
+			rec.Registrant = event.Owner
+			rec.Expiry = event.Expires.Uint64()
+		})
+	case registrarEventID("NameRenewed"):
+		event, err := i.registrar.ParseNameRenewed(*log)
+		if err != nil {
+			return err
+		}
+		node, err := i.tokenNode(tx, event.Id)
+		if err != nil {
+			return err
+		}
+		return i.updateName(tx, log, node, &NameEvent{Kind: "NameRenewed", Expiry: event.Expires.Uint64()}, func(rec *IndexedName) {
+			rec.Expiry = event.Expires.Uint64()
+		})
+	}
+	return nil
+}
+
+func (i *Indexer) applyControllerLog(tx *bolt.Tx, log *types.Log) error {
+	// The controller events duplicate those of the registrar, but they
+	// provide the plain-text label.
+	switch log.Topics[0] {
+	case controllerEventID("NameRegistered"):
+		event, err := i.controller.ParseNameRegistered(*log)
+		if err != nil {
+			return err
+		}
+		return learnLabel(tx, event.Name)
+	case controllerEventID("NameRenewed"):
+		event, err := i.controller.ParseNameRenewed(*log)
+		if err != nil {
+			return err
+		}
+		return learnLabel(tx, event.Name)
+	}
+	return nil
+}
+
+func (i *Indexer) applyWrapperLog(tx *bolt.Tx, log *types.Log) error {
+	switch log.Topics[0] {
+	case wrapperEventID("NameWrapped"):
+		event, err := i.wrapper.ParseNameWrapped(*log)
+		if err != nil {
+			return err
+		}
+		for _, label := range dnsDecodeLabels(event.Name) {
+			if err := learnLabel(tx, label); err != nil {
+				return err
+			}
+		}
+		return i.updateName(tx, log, event.Node, &NameEvent{Kind: "NameWrapped", Owner: event.Owner, Expiry: event.Expiry}, func(rec *IndexedName) {
+			rec.WrappedOwner = event.Owner
+			rec.Fuses = event.Fuses
+		})
+	case wrapperEventID("NameUnwrapped"):
+		event, err := i.wrapper.ParseNameUnwrapped(*log)
+		if err != nil {
+			return err
+		}
+		return i.updateName(tx, log, event.Node, &NameEvent{Kind: "NameUnwrapped", Owner: event.Owner}, func(rec *IndexedName) {
+			rec.WrappedOwner = UnknownAddress
+			rec.Fuses = 0
+		})
+	case wrapperEventID("FusesSet"):
+		event, err := i.wrapper.ParseFusesSet(*log)
+		if err != nil {
+			return err
+		}
+		return i.updateName(tx, log, event.Node, &NameEvent{Kind: "FusesSet", Value: fmt.Sprintf("%d", event.Fuses)}, func(rec *IndexedName) {
+			rec.Fuses = event.Fuses
+		})
+	case wrapperEventID("TransferSingle"):
+		event, err := i.wrapper.ParseTransferSingle(*log)
+		if err != nil {
+			return err
+		}
+		return i.applyWrappedTransfer(tx, log, event.Id, event.To)
+	case wrapperEventID("TransferBatch"):
+		event, err := i.wrapper.ParseTransferBatch(*log)
+		if err != nil {
+			return err
+		}
+		for _, id := range event.Ids {
+			if err := i.applyWrappedTransfer(tx, log, id, event.To); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (i *Indexer) applyWrappedTransfer(tx *bolt.Tx, log *types.Log, id *big.Int, to common.Address) error {
+	node := common.BigToHash(id)
+	return i.updateName(tx, log, node, &NameEvent{Kind: "WrappedTransfer", Owner: to}, func(rec *IndexedName) {
+		rec.WrappedOwner = to
+	})
+}
+
+func (i *Indexer) applyResolverLog(tx *bolt.Tx, log *types.Log) error {
+	if len(log.Topics) < 2 {
+		return nil
+	}
+	node := log.Topics[1]
+	// Only keep records for nodes that we know about.
+	rec, err := getIndexedName(tx, node)
+	if err != nil || rec == nil {
+		return err
+	}
+	// Resolver events are only meaningful if they come from the node's resolver.
+	if rec.Resolver != log.Address {
+		return nil
+	}
+
+	event, err := decodeResolverLog(i.resolver, log)
+	if err != nil || event == nil {
+		return err
+	}
+	return putNameEvent(tx, log, event)
+}
+
+// decodeResolverLog decodes a resolver record change event, returning nil if
+// the log is not a record change event.
+func decodeResolverLog(resolver *publicresolver.ContractFilterer, log *types.Log) (*NameEvent, error) {
+	if len(log.Topics) < 2 {
+		return nil, nil
+	}
+	event := &NameEvent{Node: log.Topics[1]}
+	switch log.Topics[0] {
+	case resolverEventID("AddrChanged"):
+		parsed, err := resolver.ParseAddrChanged(*log)
+		if err != nil {
+			return nil, err
+		}
+		event.Kind, event.Value = "AddrChanged", parsed.A.Hex()
+	case resolverEventID("AddressChanged"):
+		parsed, err := resolver.ParseAddressChanged(*log)
+		if err != nil {
+			return nil, err
+		}
+		event.Kind, event.Key, event.Value = "AddressChanged", parsed.CoinType.String(), "0x"+hex.EncodeToString(parsed.NewAddress)
+	case resolverEventID("TextChanged"):
+		parsed, err := resolver.ParseTextChanged(*log)
+		if err != nil {
+			return nil, err
+		}
+		event.Kind, event.Key, event.Value = "TextChanged", parsed.Key, parsed.Value
+	case resolverEventID("ContenthashChanged"):
+		parsed, err := resolver.ParseContenthashChanged(*log)
+		if err != nil {
+			return nil, err
+		}
+		event.Kind, event.Value = "ContenthashChanged", "0x"+hex.EncodeToString(parsed.Hash)
+	case resolverEventID("NameChanged"):
+		parsed, err := resolver.ParseNameChanged(*log)
+		if err != nil {
+			return nil, err
+		}
+		event.Kind, event.Value = "NameChanged", parsed.Name
+	case resolverEventID("PubkeyChanged"):
+		parsed, err := resolver.ParsePubkeyChanged(*log)
+		if err != nil {
+			return nil, err
+		}
+		event.Kind, event.Value = "PubkeyChanged", "0x"+hex.EncodeToString(parsed.X[:])+hex.EncodeToString(parsed.Y[:])
+	case resolverEventID("ABIChanged"):
+		parsed, err := resolver.ParseABIChanged(*log)
+		if err != nil {
+			return nil, err
+		}
+		event.Kind, event.Key = "ABIChanged", parsed.ContentType.String()
+	case resolverEventID("InterfaceChanged"):
+		parsed, err := resolver.ParseInterfaceChanged(*log)
+		if err != nil {
+			return nil, err
+		}
+		event.Kind, event.Key, event.Value = "InterfaceChanged", "0x"+hex.EncodeToString(parsed.InterfaceID[:]), parsed.Implementer.Hex()
+	case resolverEventID("DNSRecordChanged"):
+		parsed, err := resolver.ParseDNSRecordChanged(*log)
+		if err != nil {
+			return nil, err
+		}
+		event.Kind, event.Key, event.Value = "DNSRecordChanged", fmt.Sprintf("%s/%d", strings.Join(dnsDecodeLabels(parsed.Name), "."), parsed.Resource), "0x"+hex.EncodeToString(parsed.Record)
+	case resolverEventID("DNSRecordDeleted"):
+		parsed, err := resolver.ParseDNSRecordDeleted(*log)
+		if err != nil {
+			return nil, err
+		}
+		event.Kind, event.Key = "DNSRecordDeleted", fmt.Sprintf("%s/%d", strings.Join(dnsDecodeLabels(parsed.Name), "."), parsed.Resource)
+	case resolverEventID("DNSZonehashChanged"):
+		parsed, err := resolver.ParseDNSZonehashChanged(*log)
+		if err != nil {
+			return nil, err
+		}
+		event.Kind, event.Value = "DNSZonehashChanged", "0x"+hex.EncodeToString(parsed.Zonehash)
+	case resolverEventID("VersionChanged"):
+		parsed, err := resolver.ParseVersionChanged(*log)
+		if err != nil {
+			return nil, err
+		}
+		event.Kind, event.Value = "VersionChanged", fmt.Sprintf("%d", parsed.NewVersion)
+	default:
+		return nil, nil
+	}
+	return event, nil
+}
+
+// updateName applies an update to a node, creating it if required, and
+// records the event in its history.
+func (i *Indexer) updateName(tx *bolt.Tx, log *types.Log, node common.Hash, event *NameEvent, update func(rec *IndexedName)) error {
+	rec, err := getIndexedName(tx, node)
+	if err != nil {
+		return err
+	}
+	if rec == nil {
+		rec = &IndexedName{Node: node}
+	}
+	update(rec)
+	if err := putIndexedName(tx, rec); err != nil {
+		return err
+	}
+	event.Node = node
+	return putNameEvent(tx, log, event)
+}
+
+// tokenNode returns the node for a registrar token ID, creating it if it is
+// not yet known.  Registrar tokens are always direct children of the base node.
+func (i *Indexer) tokenNode(tx *bolt.Tx, id *big.Int) (common.Hash, error) {
+	labelHash := common.BigToHash(id)
+	node := subnode(i.baseNode, labelHash)
+	rec, err := getIndexedName(tx, node)
+	if err != nil || rec != nil {
+		return node, err
+	}
+	if err := tx.Bucket(indexerChildrenBucket).Put(append(i.baseNode.Bytes(), node[:]...), []byte{}); err != nil {
+		return node, err
+	}
+	return node, putIndexedName(tx, &IndexedName{Node: node, Parent: i.baseNode, LabelHash: labelHash})
+}
+
+// Name returns the indexed information for a name, or nil if the name is
+// not known to the indexer.
+func (i *Indexer) Name(name string) (*IndexedName, error) {
+	node, err := NameHash(name)
+	if err != nil {
+		return nil, err
+	}
+	var rec *IndexedName
+	err = i.db.View(func(tx *bolt.Tx) error {
+		rec, err = getIndexedName(tx, node)
+		if err != nil || rec == nil {
+			return err
+		}
+		rec.Name = nameOfNode(tx, node)
+		return nil
+	})
+	return rec, err
+}
+
+// NamesByOwner returns the names for which the address is the registry
+// owner, the registrant or the owner of the wrapped name.
+func (i *Indexer) NamesByOwner(owner common.Address) ([]*IndexedName, error) {
+	res := make([]*IndexedName, 0)
+	err := i.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(indexerOwnersBucket).Cursor()
+		prefix := owner.Bytes()
+		for k, _ := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cursor.Next() {
+			rec, err := getIndexedName(tx, common.BytesToHash(k[len(prefix):]))
+			if err != nil {
+				return err
+			}
+			if rec != nil {
+				rec.Name = nameOfNode(tx, rec.Node)
+				res = append(res, rec)
+			}
+		}
+		return nil
+	})
+	return res, err
+}
+
+// Subdomains returns the direct children of a name.
+func (i *Indexer) Subdomains(parent string) ([]*IndexedName, error) {
+	parentNode, err := NameHash(parent)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*IndexedName, 0)
+	err = i.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(indexerChildrenBucket).Cursor()
+		prefix := parentNode[:]
+		for k, _ := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = cursor.Next() {
+			rec, err := getIndexedName(tx, common.BytesToHash(k[len(prefix):]))
+			if err != nil {
+				return err
+			}
+			if rec != nil {
+				rec.Name = nameOfNode(tx, rec.Node)
+				res = append(res, rec)
+			}
+		}
+		return nil
+	})
+	return res, err
+}
+
+// History returns the events for a name in chain order.
+func (i *Indexer) History(name string) ([]*NameEvent, error) {
+	node, err := NameHash(name)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*NameEvent, 0)
+	err = i.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(indexerHistoryBucket).Cursor()
+		prefix := node[:]
+		for k, v := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Next() {
+			event := &NameEvent{}
+			if err := json.Unmarshal(v, event); err != nil {
+				return err
+			}
+			res = append(res, event)
+		}
+		return nil
+	})
+	return res, err
+}
+
+// getIndexedName fetches a node from the database, returning nil if it is
+// not present.
+func getIndexedName(tx *bolt.Tx, node common.Hash) (*IndexedName, error) {
+	data := tx.Bucket(indexerNamesBucket).Get(node[:])
+	if data == nil {
+		return nil, nil
+	}
+	rec := &IndexedName{}
+	if err := json.Unmarshal(data, rec); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// putIndexedName stores a node and keeps the owner index up to date.
+func putIndexedName(tx *bolt.Tx, rec *IndexedName) error {
+	owners := tx.Bucket(indexerOwnersBucket)
+	old, err := getIndexedName(tx, rec.Node)
+	if err != nil {
+		return err
+	}
+	if old != nil {
+		for _, owner := range []common.Address{old.Owner, old.Registrant, old.WrappedOwner} {
+			if err := owners.Delete(append(owner.Bytes(), rec.Node[:]...)); err != nil {
+				return err
+			}
+		}
+	}
+	for _, owner := range []common.Address{rec.Owner, rec.Registrant, rec.WrappedOwner} {
+		if owner == UnknownAddress {
+			continue
+		}
+		if err := owners.Put(append(owner.Bytes(), rec.Node[:]...), []byte{}); err != nil {
+			return err
+		}
+	}
+
+	// Names are built from labels when read, so are never stored.
+	stored := *rec
+	stored.Name = ""
+	data, err := json.Marshal(&stored)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(indexerNamesBucket).Put(rec.Node[:], data)
+}
+
+// putNameEvent adds an event to the history of its node.
+func putNameEvent(tx *bolt.Tx, log *types.Log, event *NameEvent) error {
+	event.Contract = log.Address
+	event.BlockNumber = log.BlockNumber
+	event.TxHash = log.TxHash
+	event.LogIndex = log.Index
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	key := make([]byte, 44)
+	copy(key, event.Node[:])
+	binary.BigEndian.PutUint64(key[32:], log.BlockNumber)
+	binary.BigEndian.PutUint32(key[40:], uint32(log.Index))
+	return tx.Bucket(indexerHistoryBucket).Put(key, data)
+}
+
+// learnLabel stores the preimage of a labelhash.  Hashing the label also
+// adds it to DefaultLabelStore.
+func learnLabel(tx *bolt.Tx, label string) error {
+	labelHash, err := LabelHash(label)
+	if err != nil {
+		// Labels that cannot be normalised cannot be hashed by us either
+		return nil
+	}
+	return tx.Bucket(indexerLabelsBucket).Put(labelHash[:], []byte(label))
+}
+
+// nameOfNode builds the name of a node from its known labels.
+func nameOfNode(tx *bolt.Tx, node common.Hash) string {
+	labels := make([]string, 0)
+	// Guard against loops in a corrupt database.
+	for depth := 0; depth < 128 && node != (common.Hash{}); depth++ {
+		rec, err := getIndexedName(tx, node)
+		if err != nil || rec == nil {
+			break
+		}
+		if label := tx.Bucket(indexerLabelsBucket).Get(rec.LabelHash[:]); label != nil {
+			labels = append(labels, string(label))
+		} else {
+			labels = append(labels, DefaultLabelStore.Decode(rec.LabelHash))
+		}
+		node = rec.Parent
+	}
+	return strings.Join(labels, ".")
+}
+
+// subnode calculates the node of a child given its parent node and labelhash.
+func subnode(parent common.Hash, label common.Hash) common.Hash {
+	return crypto.Keccak256Hash(parent[:], label[:])
+}
+
+// dnsDecodeLabels decodes a DNS wire-format name in to its labels.
+func dnsDecodeLabels(data []byte) []string {
+	labels := make([]string, 0)
+	for offset := 0; offset < len(data); {
+		length := int(data[offset])
+		if length == 0 || offset+1+length > len(data) {
+			break
+		}
+		labels = append(labels, string(data[offset+1:offset+1+length]))
+		offset += 1 + length
+	}
+	return labels
+}
+
+func registryEventID(name string) common.Hash {
+	return eventID(registry.ContractMetaData, name)
+}
+
+func registrarEventID(name string) common.Hash {
+	return eventID(baseregistrar.ContractMetaData, name)
+}
+
+func controllerEventID(name string) common.Hash {
+	return eventID(registrarcontroller.ContractMetaData, name)
+}
+
+func wrapperEventID(name string) common.Hash {
+	return eventID(namewrapper.ContractMetaData, name)
+}
+
+func resolverEventID(name string) common.Hash {
+	return eventID(publicresolver.ContractMetaData, name)
+}
+
+// resolverEventTopics are the topics of the resolver record change events.
+func resolverEventTopics() []common.Hash {
+	names := []string{"ABIChanged", "AddrChanged", "AddressChanged", "ContenthashChanged", "DNSRecordChanged", "DNSRecordDeleted", "DNSZonehashChanged", "InterfaceChanged", "NameChanged", "PubkeyChanged", "TextChanged", "VersionChanged"}
+	topics := make([]common.Hash, len(names))
+	for j, name := range names {
+		topics[j] = resolverEventID(name)
+	}
+	return topics
+}
+
+// eventID returns the topic of a named event in a contract's ABI.
+func eventID(metadata *bind.MetaData, name string) common.Hash {
+	parsed, err := metadata.GetAbi()
+	if err != nil {
+		panic(err)
+	}
+	return parsed.Events[name].ID
+}
@@ -0,0 +1,163 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/jw-1ns/go-1ns/contracts/baseregistrar"
+	"github.com/jw-1ns/go-1ns/contracts/publicresolver"
+	"github.com/jw-1ns/go-1ns/contracts/registrarcontroller"
+	"github.com/jw-1ns/go-1ns/contracts/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var indexerTestContracts = IndexerContracts{
+	Domain:        "country",
+	Registry:      common.HexToAddress("0x1000000000000000000000000000000000000001"),
+	BaseRegistrar: common.HexToAddress("0x1000000000000000000000000000000000000002"),
+	Controller:    common.HexToAddress("0x1000000000000000000000000000000000000003"),
+	NameWrapper:   common.HexToAddress("0x1000000000000000000000000000000000000004"),
+}
+
+// indexerTestLog builds a log for an event, splitting the arguments between
+// topics and data as per the event's ABI.
+func indexerTestLog(t *testing.T, metadata *bind.MetaData, address common.Address, block uint64, index uint, name string, args ...interface{}) types.Log {
+	parsed, err := metadata.GetAbi()
+	require.Nil(t, err, "Failed to parse ABI")
+	event := parsed.Events[name]
+	topics := []common.Hash{event.ID}
+	data := make([]interface{}, 0)
+	for j, input := range event.Inputs {
+		if !input.Indexed {
+			data = append(data, args[j])
+			continue
+		}
+		switch v := args[j].(type) {
+		case [32]byte:
+			topics = append(topics, common.Hash(v))
+		case common.Hash:
+			topics = append(topics, v)
+		case common.Address:
+			topics = append(topics, common.BytesToHash(v.Bytes()))
+		case *big.Int:
+			topics = append(topics, common.BigToHash(v))
+		case string:
+			topics = append(topics, crypto.Keccak256Hash([]byte(v)))
+		default:
+			t.Fatalf("unhandled indexed type %T", v)
+		}
+	}
+	packed, err := event.Inputs.NonIndexed().Pack(data...)
+	require.Nil(t, err, "Failed to pack event data")
+	return types.Log{
+		Address:     address,
+		Topics:      topics,
+		Data:        packed,
+		BlockNumber: block,
+		Index:       index,
+	}
+}
+
+func TestIndexer(t *testing.T) {
+	indexer, err := NewIndexerAt(nil, filepath.Join(t.TempDir(), "index.db"), indexerTestContracts)
+	require.Nil(t, err, "Failed to create indexer")
+	defer indexer.Close()
+
+	alice := tconfig.testAccounts.aliceAddress
+	bob := tconfig.testAccounts.bobAddress
+	baseNode, _ := NameHash("country")
+	testLabel, _ := LabelHash("test")
+	testNode, _ := NameHash("test.country")
+	// Hashed directly so that the label is not learned
+	subLabel := keccakLabel("sub")
+	tokenID := new(big.Int).SetBytes(testLabel[:])
+	expires := big.NewInt(1705531920)
+
+	logs := []types.Log{
+		// Registration of test.country by alice
+		indexerTestLog(t, registry.ContractMetaData, indexerTestContracts.Registry, 10, 0, "NewOwner", baseNode, testLabel, alice),
+		indexerTestLog(t, baseregistrar.ContractMetaData, indexerTestContracts.BaseRegistrar, 10, 1, "Transfer", UnknownAddress, alice, tokenID),
+		indexerTestLog(t, baseregistrar.ContractMetaData, indexerTestContracts.BaseRegistrar, 10, 2, "NameRegistered", tokenID, alice, expires),
+		indexerTestLog(t, registrarcontroller.ContractMetaData, indexerTestContracts.Controller, 10, 3, "NameRegistered", "test", testLabel, alice, big.NewInt(1), big.NewInt(0), expires),
+		indexerTestLog(t, registry.ContractMetaData, indexerTestContracts.Registry, 11, 0, "NewResolver", testNode, stubResolver),
+		// Resolver records, one from an unrelated resolver that should be ignored
+		indexerTestLog(t, publicresolver.ContractMetaData, stubResolver, 12, 0, "TextChanged", testNode, "url", "url", "https://1ns.domains"),
+		indexerTestLog(t, publicresolver.ContractMetaData, indexerTestContracts.NameWrapper, 12, 1, "TextChanged", testNode, "url", "url", "https://example.com"),
+		// Subdomain with unknown label given to bob
+		indexerTestLog(t, registry.ContractMetaData, indexerTestContracts.Registry, 13, 0, "NewOwner", testNode, subLabel, bob),
+	}
+	require.Nil(t, indexer.indexLogs(logs, 13), "Failed to index logs")
+
+	lastBlock, err := indexer.LastBlock()
+	require.Nil(t, err, "Failed to obtain last block")
+	assert.Equal(t, uint64(13), lastBlock)
+
+	name, err := indexer.Name("test.country")
+	require.Nil(t, err, "Failed to obtain name")
+	require.NotNil(t, name, "Failed to find name")
+	assert.Equal(t, "test.country", name.Name)
+	assert.Equal(t, alice, name.Owner)
+	assert.Equal(t, alice, name.Registrant)
+	assert.Equal(t, stubResolver, name.Resolver)
+	assert.Equal(t, expires.Uint64(), name.Expiry)
+
+	names, err := indexer.NamesByOwner(alice)
+	require.Nil(t, err, "Failed to obtain names by owner")
+	require.Len(t, names, 1)
+	assert.Equal(t, "test.country", names[0].Name)
+
+	names, err = indexer.NamesByOwner(bob)
+	require.Nil(t, err, "Failed to obtain names by owner")
+	require.Len(t, names, 1)
+	assert.Equal(t, "[fa1ea47215815692a5f1391cff19abbaf694c82fb2151a4c351b6c0eeaaf317b].test.country", names[0].Name)
+
+	subdomains, err := indexer.Subdomains("test.country")
+	require.Nil(t, err, "Failed to obtain subdomains")
+	require.Len(t, subdomains, 1)
+	assert.Equal(t, bob, subdomains[0].Owner)
+
+	// Learning the label later names the subdomain
+	require.Nil(t, indexer.AddLabels("sub"), "Failed to add labels")
+	subdomains, err = indexer.Subdomains("test.country")
+	require.Nil(t, err, "Failed to obtain subdomains")
+	assert.Equal(t, "sub.test.country", subdomains[0].Name)
+
+	history, err := indexer.History("test.country")
+	require.Nil(t, err, "Failed to obtain history")
+	kinds := make([]string, len(history))
+	for j := range history {
+		kinds[j] = history[j].Kind
+	}
+	assert.Equal(t, []string{"NewOwner", "RegistrantTransfer", "NameRegistered", "NewResolver", "TextChanged"}, kinds)
+	assert.Equal(t, "https://1ns.domains", history[4].Value)
+
+	// Transfer of the registration moves the name between owners
+	transfer := indexerTestLog(t, baseregistrar.ContractMetaData, indexerTestContracts.BaseRegistrar, 14, 0, "Transfer", alice, bob, tokenID)
+	require.Nil(t, indexer.indexLogs([]types.Log{transfer}, 14), "Failed to index transfer")
+	names, err = indexer.NamesByOwner(bob)
+	require.Nil(t, err, "Failed to obtain names by owner")
+	assert.Len(t, names, 2)
+	names, err = indexer.NamesByOwner(alice)
+	require.Nil(t, err, "Failed to obtain names by owner")
+	assert.Len(t, names, 1, "Registry owner should still be alice")
+}
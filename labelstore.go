@@ -0,0 +1,229 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jw-1ns/go-1ns/contracts/registrarcontroller"
+	"golang.org/x/crypto/sha3"
+)
+
+// DefaultLabelStore is the label store that learns every label passed
+// through LabelHash() and NameHash().
+var DefaultLabelStore = NewLabelStore()
+
+// LabelStore holds the known preimages of labelhashes, allowing hashes
+// found in events and token IDs to be turned back in to names.
+type LabelStore struct {
+	mutex  sync.RWMutex
+	labels map[[32]byte]string
+}
+
+// NewLabelStore creates an empty label store.
+func NewLabelStore() *LabelStore {
+	return &LabelStore{
+		labels: make(map[[32]byte]string),
+	}
+}
+
+// Add adds labels to the store.
+func (s *LabelStore) Add(labels ...string) {
+	for _, label := range labels {
+		s.add(keccakLabel(label), label)
+	}
+}
+
+// add adds a label with a known hash to the store.
+func (s *LabelStore) add(hash [32]byte, label string) {
+	s.mutex.RLock()
+	_, exists := s.labels[hash]
+	s.mutex.RUnlock()
+	if exists {
+		return
+	}
+	s.mutex.Lock()
+	s.labels[hash] = label
+	s.mutex.Unlock()
+}
+
+// Label returns the preimage of a labelhash, if known.
+func (s *LabelStore) Label(hash [32]byte) (string, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	label, exists := s.labels[hash]
+	return label, exists
+}
+
+// Decode returns the preimage of a labelhash, or its encoded form
+// '[<labelhash>]' if the preimage is not known.
+func (s *LabelStore) Decode(hash [32]byte) string {
+	if label, exists := s.Label(hash); exists {
+		return label
+	}
+	return EncodeLabelHash(hash)
+}
+
+// DecodeName builds a name from the labelhashes of its parts, lowest-level
+// first, using the encoded form for any labels that are not known.
+func (s *LabelStore) DecodeName(hashes ...[32]byte) string {
+	labels := make([]string, len(hashes))
+	for i, hash := range hashes {
+		labels[i] = s.Decode(hash)
+	}
+	return strings.Join(labels, ".")
+}
+
+// Len returns the number of labels in the store.
+func (s *LabelStore) Len() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.labels)
+}
+
+// Load adds labels from a wordlist, one label per line.  Blank lines and
+// lines starting with '#' are ignored.  Labels are normalised before being
+// added.  It returns the number of labels read.
+func (s *LabelStore) Load(r io.Reader) (int, error) {
+	count := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		label, err := Normalize(line)
+		if err != nil {
+			// Wordlists are often dirty; skip what cannot be a label
+			continue
+		}
+		s.Add(label)
+		count++
+	}
+	return count, scanner.Err()
+}
+
+// LoadFile adds labels from a wordlist file.
+func (s *LabelStore) LoadFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return s.Load(f)
+}
+
+// Save writes the labels in the store as a wordlist suitable for Load().
+func (s *LabelStore) Save(w io.Writer) error {
+	s.mutex.RLock()
+	labels := make([]string, 0, len(s.labels))
+	for _, label := range s.labels {
+		labels = append(labels, label)
+	}
+	s.mutex.RUnlock()
+	sort.Strings(labels)
+
+	bw := bufio.NewWriter(w)
+	for _, label := range labels {
+		if _, err := fmt.Fprintln(bw, label); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// LearnFromLog adds the label from a controller NameRegistered or
+// NameRenewed event.  It returns true if the log contained a label.
+func (s *LabelStore) LearnFromLog(log types.Log) bool {
+	if len(log.Topics) < 2 {
+		return false
+	}
+	filterer, err := registrarcontroller.NewContractFilterer(log.Address, nil)
+	if err != nil {
+		return false
+	}
+	var name string
+	switch log.Topics[0] {
+	case controllerEventID("NameRegistered"):
+		event, err := filterer.ParseNameRegistered(log)
+		if err != nil {
+			return false
+		}
+		name = event.Name
+	case controllerEventID("NameRenewed"):
+		event, err := filterer.ParseNameRenewed(log)
+		if err != nil {
+			return false
+		}
+		name = event.Name
+	default:
+		return false
+	}
+	// Anyone can emit the event, so confirm the preimage.
+	hash := keccakLabel(name)
+	if hash != log.Topics[1] {
+		return false
+	}
+	s.add(hash, name)
+	return true
+}
+
+// LearnFromChain adds the labels from all NameRegistered events in the
+// given block range.  A nil block is the genesis block for from and the
+// latest block for to.  It returns the number of labels learned.
+func (s *LabelStore) LearnFromChain(ctx context.Context, backend bind.ContractFilterer, from *big.Int, to *big.Int) (int, error) {
+	logs, err := backend.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: from,
+		ToBlock:   to,
+		Topics:    [][]common.Hash{{controllerEventID("NameRegistered")}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, log := range logs {
+		if s.LearnFromLog(log) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// EncodeLabelHash returns the encoded form of a labelhash, '[<labelhash>]',
+// used in place of a label whose preimage is not known.
+func EncodeLabelHash(hash [32]byte) string {
+	return fmt.Sprintf("[%x]", hash)
+}
+
+// keccakLabel hashes a label as-is, without normalisation or learning.
+func keccakLabel(label string) (hash [32]byte) {
+	sha := sha3.NewLegacyKeccak256()
+	// #nosec G104
+	sha.Write([]byte(label))
+	sha.Sum(hash[:0])
+	return
+}
@@ -0,0 +1,98 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"bytes"
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jw-1ns/go-1ns/contracts/registrarcontroller"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabelStoreAdd(t *testing.T) {
+	store := NewLabelStore()
+	hash := keccakLabel("labelstoreadd")
+	_, exists := store.Label(hash)
+	assert.False(t, exists)
+	assert.Equal(t, EncodeLabelHash(hash), store.Decode(hash))
+
+	store.Add("labelstoreadd")
+	label, exists := store.Label(hash)
+	assert.True(t, exists)
+	assert.Equal(t, "labelstoreadd", label)
+	assert.Equal(t, 1, store.Len())
+
+	other := NewLabelStore()
+	other.Add("country")
+	assert.Equal(t, EncodeLabelHash(hash)+".country", other.DecodeName(hash, keccakLabel("country")))
+}
+
+func TestLabelStoreDefault(t *testing.T) {
+	hash := keccakLabel("labelstoredefault")
+	_, exists := DefaultLabelStore.Label(hash)
+	require.False(t, exists)
+
+	_, err := NameHash("labelstoredefault.country")
+	require.Nil(t, err, "Failed to hash name")
+	label, exists := DefaultLabelStore.Label(hash)
+	assert.True(t, exists)
+	assert.Equal(t, "labelstoredefault", label)
+}
+
+func TestLabelStoreLoadSave(t *testing.T) {
+	store := NewLabelStore()
+	count, err := store.Load(strings.NewReader("# Wordlist\nalpha\n\n  Beta  \ngamma\n"))
+	require.Nil(t, err, "Failed to load wordlist")
+	assert.Equal(t, 3, count)
+	label, exists := store.Label(keccakLabel("beta"))
+	assert.True(t, exists, "Label should be normalised")
+	assert.Equal(t, "beta", label)
+
+	var buf bytes.Buffer
+	require.Nil(t, store.Save(&buf), "Failed to save wordlist")
+	assert.Equal(t, "alpha\nbeta\ngamma\n", buf.String())
+
+	restored := NewLabelStore()
+	count, err = restored.Load(&buf)
+	require.Nil(t, err, "Failed to reload wordlist")
+	assert.Equal(t, 3, count)
+	assert.Equal(t, 3, restored.Len())
+}
+
+func TestLabelStoreLearnFromChain(t *testing.T) {
+	backend := newStubBackend()
+	owner := tconfig.testAccounts.aliceAddress
+	controller := common.HexToAddress("0x03")
+	genuine := keccakLabel("labelstoregenuine")
+	forged := keccakLabel("labelstoreforged")
+	backend.logs = append(backend.logs,
+		indexerTestLog(t, registrarcontroller.ContractMetaData, controller, 1, 0, "NameRegistered", "labelstoregenuine", genuine, owner, big.NewInt(1), big.NewInt(0), big.NewInt(1)),
+		// Claims a different preimage for the labelhash
+		indexerTestLog(t, registrarcontroller.ContractMetaData, controller, 2, 0, "NameRegistered", "labelstoreother", forged, owner, big.NewInt(1), big.NewInt(0), big.NewInt(1)),
+	)
+
+	store := NewLabelStore()
+	count, err := store.LearnFromChain(context.Background(), backend, nil, nil)
+	require.Nil(t, err, "Failed to learn labels")
+	assert.Equal(t, 1, count)
+	assert.Equal(t, "labelstoregenuine", store.Decode(genuine))
+	assert.Equal(t, EncodeLabelHash(forged), store.Decode(forged))
+}
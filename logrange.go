@@ -0,0 +1,66 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// LogRange is the range of blocks searched for events.  Nodes limit the
+// number of blocks in a single log query, so the range is requested a part
+// at a time, as per the indexer.
+type LogRange struct {
+	// StartBlock is the block from which events are searched, for example
+	// the block in which the contracts were deployed
+	StartBlock uint64
+	// BlockRange is the maximum number of blocks requested in a single log
+	// query; if 0 a default of 5000 is used
+	BlockRange uint64
+}
+
+// filterLogs obtains the logs matching a query from StartBlock to the
+// latest block.  The block range of the query is ignored.
+func (r LogRange) filterLogs(ctx context.Context, backend bind.ContractBackend, query ethereum.FilterQuery) ([]types.Log, error) {
+	header, err := backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	head := header.Number.Uint64()
+	blockRange := r.BlockRange
+	if blockRange == 0 {
+		blockRange = defaultIndexerBlockRange
+	}
+
+	res := make([]types.Log, 0)
+	for from := r.StartBlock; from <= head; from += blockRange {
+		to := from + blockRange - 1
+		if to > head {
+			to = head
+		}
+		query.FromBlock = new(big.Int).SetUint64(from)
+		query.ToBlock = new(big.Int).SetUint64(to)
+		logs, err := backend.FilterLogs(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, logs...)
+	}
+	return res, nil
+}
@@ -0,0 +1,181 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Manifest is the desired state of the subdomains of a name.
+type Manifest struct {
+	// Parent is the name under which the subdomains sit e.g. ourname.country
+	Parent     string           `json:"parent"`
+	Subdomains []*ManifestEntry `json:"subdomains"`
+}
+
+// ManifestEntry is the desired state of a single subdomain.
+type ManifestEntry struct {
+	Label string         `json:"label"`
+	Owner common.Address `json:"owner"`
+	// Resolver is the resolver for the subdomain; if not supplied the
+	// resolver of the parent is used
+	Resolver common.Address `json:"resolver,omitempty"`
+	TTL      uint64         `json:"ttl,omitempty"`
+	// Address is the Ethereum address record; if not supplied the record is
+	// left unchanged
+	Address common.Address `json:"address,omitempty"`
+	// Text are text records; records not listed are left unchanged
+	Text map[string]string `json:"text,omitempty"`
+}
+
+// ReadManifestJSON reads a manifest in JSON format.
+func ReadManifestJSON(r io.Reader) (*Manifest, error) {
+	manifest := &Manifest{}
+	if err := json.NewDecoder(r).Decode(manifest); err != nil {
+		return nil, err
+	}
+	return manifest, manifest.validate()
+}
+
+// ReadManifestCSV reads the subdomains of a parent from CSV.  The first row
+// is a header naming the columns: label, owner, resolver, ttl and address,
+// along with text records as 'text.<key>'.  Only label and owner are
+// required.
+func ReadManifestCSV(r io.Reader, parent string) (*Manifest, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int)
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	for _, required := range []string{"label", "owner"} {
+		if _, exists := columns[required]; !exists {
+			return nil, fmt.Errorf("manifest missing %s column", required)
+		}
+	}
+
+	manifest := &Manifest{
+		Parent:     parent,
+		Subdomains: make([]*ManifestEntry, 0),
+	}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		entry := &ManifestEntry{
+			Label: row[columns["label"]],
+			Text:  make(map[string]string),
+		}
+		for column, i := range columns {
+			value := strings.TrimSpace(row[i])
+			if value == "" {
+				continue
+			}
+			switch {
+			case column == "owner":
+				entry.Owner, err = manifestAddress(value)
+			case column == "resolver":
+				entry.Resolver, err = manifestAddress(value)
+			case column == "address":
+				entry.Address, err = manifestAddress(value)
+			case column == "ttl":
+				entry.TTL, err = strconv.ParseUint(value, 10, 64)
+			case strings.HasPrefix(column, "text."):
+				entry.Text[strings.TrimPrefix(column, "text.")] = value
+			}
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid %s: %v", line, column, err)
+			}
+		}
+		manifest.Subdomains = append(manifest.Subdomains, entry)
+	}
+	return manifest, manifest.validate()
+}
+
+// LoadManifest loads a manifest from a file, in CSV or JSON format
+// according to its extension.  The parent is required for CSV files.
+func LoadManifest(path string, parent string) (*Manifest, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return ReadManifestJSON(f)
+	case ".csv":
+		return ReadManifestCSV(f, parent)
+	default:
+		return nil, fmt.Errorf("unknown manifest format %s", filepath.Ext(path))
+	}
+}
+
+// validate normalises the names in the manifest and checks it is coherent.
+func (m *Manifest) validate() error {
+	parent, err := NormaliseDomain(m.Parent)
+	if err != nil {
+		return err
+	}
+	if parent == "" {
+		return fmt.Errorf("manifest has no parent")
+	}
+	m.Parent = parent
+
+	seen := make(map[string]bool)
+	for _, entry := range m.Subdomains {
+		label, err := Normalize(entry.Label)
+		if err != nil {
+			return err
+		}
+		if label == "" || strings.Contains(label, ".") {
+			return fmt.Errorf("invalid label %q", entry.Label)
+		}
+		if seen[label] {
+			return fmt.Errorf("duplicate label %s", label)
+		}
+		seen[label] = true
+		entry.Label = label
+		if entry.Owner == UnknownAddress {
+			return fmt.Errorf("%s has no owner", label)
+		}
+	}
+	return nil
+}
+
+func manifestAddress(value string) (common.Address, error) {
+	if !common.IsHexAddress(value) {
+		return UnknownAddress, fmt.Errorf("%s is not an address", value)
+	}
+	return common.HexToAddress(value), nil
+}
@@ -1,8 +1,12 @@
 package onens
 
 import (
+	"context"
 	"fmt"
 	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 )
 
 // DomainLevel calculates the level of the domain presented.
@@ -13,14 +17,15 @@ func DomainLevel(name string) (level int) {
 	return len(strings.Split(name, ".")) - 1
 }
 
-// NormaliseDomain turns ENS domain in to normal form
+// NormaliseDomain turns ENS domain in to normal form.  Encoded labels of the
+// form '[<labelhash>]' are validated and passed through.
 func NormaliseDomain(domain string) (string, error) {
 	wildcard := false
 	if strings.HasPrefix(domain, "*.") {
 		wildcard = true
 		domain = domain[2:]
 	}
-	output, err := p.ToUnicode(strings.ToLower(domain))
+	output, err := toUnicode(p, strings.ToLower(domain))
 	if err != nil {
 		return "", err
 	}
@@ -45,7 +50,7 @@ func NormaliseDomainStrict(domain string) (string, error) {
 		wildcard = true
 		domain = domain[2:]
 	}
-	output, err := pStrict.ToUnicode(strings.ToLower(domain))
+	output, err := toUnicode(pStrict, strings.ToLower(domain))
 	if err != nil {
 		return "", err
 	}
@@ -101,6 +106,8 @@ func Domain(domain string) string {
 //	-1 |  com
 //	-2 |  foo
 //	-3 |  bar
+//
+// Encoded labels of the form '[<labelhash>]' are returned as-is.
 func DomainPart(domain string, part int) (string, error) {
 	if part == 0 {
 		return "", fmt.Errorf("invalid part")
@@ -136,3 +143,27 @@ func UnqualifiedName(domain string, root string) (string, error) {
 	}
 	return name, nil
 }
+
+// optsContext returns the context of transaction options, so that calls
+// made in preparing a transaction are cancelled along with it.
+func optsContext(opts *bind.TransactOpts) context.Context {
+	if opts == nil || opts.Context == nil {
+		return context.Background()
+	}
+	return opts.Context
+}
+
+// detachedContext carries the values of its parent but is never cancelled,
+// for work shared between callers that must outlive any one of them.
+// context.WithoutCancel() does the same from Go 1.21.
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
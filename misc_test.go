@@ -28,6 +28,8 @@ func TestNormaliseDomain(t *testing.T) {
 		{"omg.thetoken.country", "omg.thetoken.country", nil},
 		{"_underscore.thetoken.country", "_underscore.thetoken.country", nil},
 		{"點看.country", "點看.country", nil},
+		{"[41B1A0649752AF1B28B3DC29A1556EEE781E4A4C3A1F7F53F90FA834DE098C4D].country", "[41b1a0649752af1b28b3dc29a1556eee781e4a4c3a1f7f53f90fa834de098c4d].country", nil},
+		{"[41b1a0].country", "", errors.New("invalid encoded label [41b1a0]")},
 	}
 
 	for _, tt := range tests {
@@ -71,6 +73,9 @@ func TestNormaliseDomainStrict(t *testing.T) {
 		{"omg.thetoken.country", "omg.thetoken.country", nil},
 		{"_underscore.thetoken.country", "", errors.New("idna: disallowed rune U+005F")},
 		{"點看.country", "點看.country", nil},
+		{"[41b1a0649752af1b28b3dc29a1556eee781e4a4c3a1f7f53f90fa834de098c4d].1ns.country", "[41b1a0649752af1b28b3dc29a1556eee781e4a4c3a1f7f53f90fa834de098c4d].1ns.country", nil},
+		{".[41b1a0649752af1b28b3dc29a1556eee781e4a4c3a1f7f53f90fa834de098c4d].country", ".[41b1a0649752af1b28b3dc29a1556eee781e4a4c3a1f7f53f90fa834de098c4d].country", nil},
+		{"[41b1a0649752af1b28b3dc29a1556eee781e4a4c3a1f7f53f90fa834de098c4d]._underscore.country", "", errors.New("idna: disallowed rune U+005F")},
 	}
 
 	for _, tt := range tests {
@@ -175,6 +180,9 @@ func TestDomainPart(t *testing.T) {
 		{"a.b.c", -2, "b", false},
 		{"a.b.c", -3, "a", false},
 		{"a.b.c", -4, "", true},
+		{"[41b1a0649752af1b28b3dc29a1556eee781e4a4c3a1f7f53f90fa834de098c4d].1ns.country", 1, "[41b1a0649752af1b28b3dc29a1556eee781e4a4c3a1f7f53f90fa834de098c4d]", false},
+		{"[41b1a0649752af1b28b3dc29a1556eee781e4a4c3a1f7f53f90fa834de098c4d].1ns.country", -3, "[41b1a0649752af1b28b3dc29a1556eee781e4a4c3a1f7f53f90fa834de098c4d]", false},
+		{"[41b1a0].1ns.country", 1, "", true},
 	}
 
 	for _, tt := range tests {
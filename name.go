@@ -16,6 +16,7 @@
 package onens
 
 import (
+	"context"
 	"crypto/rand"
 	"fmt"
 	"math/big"
@@ -36,6 +37,15 @@ type Name struct {
 	Domain string
 	// Label is the name part of an ENS domain e.g. foo
 	Label string
+	// LogRange is the range of blocks searched for events by Subdomains()
+	LogRange
+	// Policy is applied to the options of each transaction sent, if set;
+	// RegisterStageTwoWithManager() uses the policy of the manager
+	Policy *TxPolicy
+	// PremiumDecayPeriod is the period over which the premium of the name
+	// decays after its grace period, as used by Status(); if 0
+	// DefaultPremiumDecayPeriod is used
+	PremiumDecayPeriod time.Duration
 	// Contracts
 	registry   *Registry
 	registrar  *BaseRegistrar
@@ -45,6 +55,11 @@ type Name struct {
 // NewName creates an ENS name structure.
 // Note that this does not create the name on-chain.
 func NewName(backend bind.ContractBackend, name string) (*Name, error) {
+	return NewNameCtx(context.Background(), backend, name)
+}
+
+// NewNameCtx is as per NewName, with a context.
+func NewNameCtx(ctx context.Context, backend bind.ContractBackend, name string) (*Name, error) {
 	name, err := NormaliseDomain(name)
 	if err != nil {
 		return nil, err
@@ -59,16 +74,16 @@ func NewName(backend bind.ContractBackend, name string) (*Name, error) {
 	if err != nil {
 		return nil, err
 	}
-	registrar, err := NewBaseRegistrar(backend, domain)
+	registrar, err := NewBaseRegistrarCtx(ctx, backend, domain)
 	if err != nil {
 		return nil, err
 	}
-	controller, err := NewRegistrarController(backend, domain)
+	controller, err := NewRegistrarControllerCtx(ctx, backend, domain)
 	if err != nil {
 		return nil, err
 	}
 
-	isValid, err := controller.IsValid(name)
+	isValid, err := controller.IsValidCtx(ctx, name)
 	if err != nil {
 		return nil, err
 	}
@@ -89,7 +104,12 @@ func NewName(backend bind.ContractBackend, name string) (*Name, error) {
 
 // IsRegistered returns true if the name is registered in the registrar
 func (n *Name) IsRegistered() (bool, error) {
-	registrant, err := n.Registrant()
+	return n.IsRegisteredCtx(context.Background())
+}
+
+// IsRegisteredCtx is as per IsRegistered, with a context.
+func (n *Name) IsRegisteredCtx(ctx context.Context) (bool, error) {
+	registrant, err := n.RegistrantCtx(ctx)
 	if err != nil {
 		return false, err
 	}
@@ -98,15 +118,20 @@ func (n *Name) IsRegistered() (bool, error) {
 
 // ExtendRegistration sends a transaction that extends the registration of the name.
 func (n *Name) ExtendRegistration(opts *bind.TransactOpts) (*types.Transaction, error) {
-	isRegistered, err := n.IsRegistered()
+	opts, err := n.Policy.apply(opts)
+	if err != nil {
+		return nil, err
+	}
+	ctx := optsContext(opts)
+	isRegistered, err := n.IsRegisteredCtx(ctx)
 	if err != nil {
 		return nil, err
 	}
 	if !isRegistered {
-		return nil, errors.New("name is not registered")
+		return nil, withReason(ErrNotRegistered, "name is not registered")
 	}
 
-	rentCost, err := n.RentCost()
+	rentCost, err := n.RentCostCtx(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -121,7 +146,12 @@ func (n *Name) ExtendRegistration(opts *bind.TransactOpts) (*types.Transaction,
 // RegistrationInterval obtains the minimum interval between commit and reveal
 // when registering this name.
 func (n *Name) RegistrationInterval() (time.Duration, error) {
-	interval, err := n.controller.MinCommitmentInterval()
+	return n.RegistrationIntervalCtx(context.Background())
+}
+
+// RegistrationIntervalCtx is as per RegistrationInterval, with a context.
+func (n *Name) RegistrationIntervalCtx(ctx context.Context) (time.Duration, error) {
+	interval, err := n.controller.MinCommitmentIntervalCtx(ctx)
 	if err != nil {
 		return time.Duration(0), err
 	}
@@ -131,12 +161,16 @@ func (n *Name) RegistrationInterval() (time.Duration, error) {
 // RegisterStageOne sends a transaction that starts the registration process.
 func (n *Name) RegisterStageOne(registrant common.Address, duration *big.Int, opts *bind.TransactOpts) (*types.Transaction, [32]byte, error) {
 	var secret [32]byte
-	_, err := rand.Read(secret[:])
+	opts, err := n.Policy.apply(opts)
+	if err != nil {
+		return nil, secret, err
+	}
+	_, err = rand.Read(secret[:])
 	if err != nil {
 		return nil, secret, err
 	}
 
-	isRegistered, err := n.IsRegistered()
+	isRegistered, err := n.IsRegisteredCtx(optsContext(opts))
 	if err != nil {
 		return nil, secret, err
 	}
@@ -154,7 +188,17 @@ func (n *Name) RegisterStageOne(registrant common.Address, duration *big.Int, op
 // At least RegistrationInterval() time must have passed since the stage one
 // transaction was mined for this to work.
 func (n *Name) RegisterStageTwo(registrant common.Address, duration *big.Int, secret [32]byte, opts *bind.TransactOpts) (*types.Transaction, error) {
-	commitTS, err := n.controller.CommitmentTime(n.Label, registrant, duration, secret)
+	opts, err := n.Policy.apply(opts)
+	if err != nil {
+		return nil, err
+	}
+	return n.registerStageTwo(registrant, duration, secret, opts)
+}
+
+// registerStageTwo sends the stage two transaction with the options given.
+func (n *Name) registerStageTwo(registrant common.Address, duration *big.Int, secret [32]byte, opts *bind.TransactOpts) (*types.Transaction, error) {
+	ctx := optsContext(opts)
+	commitTS, err := n.controller.CommitmentTimeCtx(ctx, n.Label, registrant, duration, secret)
 	if err != nil {
 		return nil, err
 	}
@@ -163,7 +207,7 @@ func (n *Name) RegisterStageTwo(registrant common.Address, duration *big.Int, se
 	}
 	commit := time.Unix(commitTS.Int64(), 0)
 
-	minCommitIntervalTS, err := n.controller.MinCommitmentInterval()
+	minCommitIntervalTS, err := n.controller.MinCommitmentIntervalCtx(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -173,7 +217,7 @@ func (n *Name) RegisterStageTwo(registrant common.Address, duration *big.Int, se
 		return nil, errors.New("too early to send second transaction")
 	}
 
-	maxCommitIntervalTS, err := n.controller.MaxCommitmentInterval()
+	maxCommitIntervalTS, err := n.controller.MaxCommitmentIntervalCtx(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -186,15 +230,66 @@ func (n *Name) RegisterStageTwo(registrant common.Address, duration *big.Int, se
 	return n.controller.Reveal(opts, n.Label, registrant, duration, secret)
 }
 
+// RevealDeadline obtains the time by which the stage two transaction must
+// be mined, given the details supplied to RegisterStageOne.
+func (n *Name) RevealDeadline(registrant common.Address, duration *big.Int, secret [32]byte) (time.Time, error) {
+	return n.RevealDeadlineCtx(context.Background(), registrant, duration, secret)
+}
+
+// RevealDeadlineCtx is as per RevealDeadline, with a context.
+func (n *Name) RevealDeadlineCtx(ctx context.Context, registrant common.Address, duration *big.Int, secret [32]byte) (time.Time, error) {
+	commitTS, err := n.controller.CommitmentTimeCtx(ctx, n.Label, registrant, duration, secret)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if commitTS.Cmp(big.NewInt(0)) == 0 {
+		return time.Time{}, errors.New("no commitment present")
+	}
+	maxCommitIntervalTS, err := n.controller.MaxCommitmentIntervalCtx(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	maxCommitInterval := time.Duration(maxCommitIntervalTS.Int64()) * time.Second
+	return time.Unix(commitTS.Int64(), 0).Add(maxCommitInterval), nil
+}
+
+// RegisterStageTwoWithManager sends the transaction that completes the
+// registration process through a transaction manager and waits for it to
+// be mined.  The transaction is sped up increasingly often as the reveal
+// deadline nears, so that a transaction stuck with low fees does not waste
+// the commitment.  The manager must have a maximum fee, either MaxFeeCap or
+// the cap of the fees of its policy, which limits how far fees are raised.
+func (n *Name) RegisterStageTwoWithManager(ctx context.Context, manager *TxManager, registrant common.Address, duration *big.Int, secret [32]byte, opts *bind.TransactOpts) (*types.Receipt, error) {
+	if manager.maxFeeCap() == nil {
+		return nil, errors.New("transaction manager has no maximum fee")
+	}
+	deadline, err := n.RevealDeadlineCtx(ctx, registrant, duration, secret)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := manager.Send(ctx, opts, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return n.registerStageTwo(registrant, duration, secret, opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return manager.Wait(ctx, tx.Hash(), deadline)
+}
+
 // Expires obtain the time at which the registration for this name expires.
 func (n *Name) Expires() (time.Time, error) {
-	expiryTS, err := n.registrar.Expiry(n.Label)
+	return n.ExpiresCtx(context.Background())
+}
+
+// ExpiresCtx is as per Expires, with a context.
+func (n *Name) ExpiresCtx(ctx context.Context) (time.Time, error) {
+	expiryTS, err := n.registrar.ExpiryCtx(ctx, n.Label)
 	if err != nil {
 		return time.Unix(0, 0), err
 	}
 
 	if expiryTS.Int64() == 0 {
-		return time.Unix(0, 0), errors.New("not registered")
+		return time.Unix(0, 0), ErrNotRegistered
 	}
 
 	return time.Unix(expiryTS.Int64(), 0), nil
@@ -204,83 +299,153 @@ func (n *Name) Expires() (time.Time, error) {
 // The controller can carry out operations on the name such as setting
 // records, but cannot transfer ultimate ownership of the name.
 func (n *Name) Controller() (common.Address, error) {
-	return n.registry.Owner(n.Name)
+	return n.ControllerCtx(context.Background())
+}
+
+// ControllerCtx is as per Controller, with a context.
+func (n *Name) ControllerCtx(ctx context.Context) (common.Address, error) {
+	return n.registry.OwnerCtx(ctx, n.Name)
 }
 
 // SetController sets the controller for this name.
 // The controller can carry out operations on the name such as setting
 // records, but cannot transfer ultimate ownership of the name.
+// It can be sent by the current controller or an operator it has approved in
+// the registry, or by the registrant or an operator approved in the registrar.
 func (n *Name) SetController(controller common.Address, opts *bind.TransactOpts) (*types.Transaction, error) {
+	opts, err := n.Policy.apply(opts)
+	if err != nil {
+		return nil, err
+	}
 	// Are we the current controller?
-	curController, err := n.Controller()
+	ctx := optsContext(opts)
+	curController, err := n.ControllerCtx(ctx)
 	if err != nil {
 		return nil, err
 	}
-	if curController == opts.From {
+	authorised, err := n.isControllerOrOperator(ctx, curController, opts.From)
+	if err != nil {
+		return nil, err
+	}
+	if authorised {
 		return n.registry.SetOwner(opts, n.Name, controller)
 	}
 
-	// Perhaps we are the registrant
-	registrant, err := n.Registrant()
+	// Perhaps we are the registrant, in which case we reclaim
+	authorised, err = n.isRegistrantOrOperator(ctx, opts.From)
 	if err != nil {
 		return nil, err
 	}
-	// 	// Are we actually trying to reclaim?
-	if registrant == opts.From && opts.From == controller {
-		return n.Reclaim(opts)
+	if authorised {
+		return n.registrar.Reclaim(opts, n.Name, controller)
 	}
 
-	return nil, errors.New("not authorised to change the controller")
+	return nil, withReason(ErrNotAuthorised, "not authorised to change the controller")
 }
 
 // Reclaim reclaims controller rights by the registrant
 func (n *Name) Reclaim(opts *bind.TransactOpts) (*types.Transaction, error) {
-	// Ensure the we are the registrant
-	registrant, err := n.Registrant()
+	opts, err := n.Policy.apply(opts)
+	if err != nil {
+		return nil, err
+	}
+	// Ensure the we are the registrant or its operator
+	ctx := optsContext(opts)
+	registrant, err := n.RegistrantCtx(ctx)
 	if err != nil {
 		return nil, err
 	}
-	if registrant != opts.From {
-		return nil, errors.New("not the registrant")
+	authorised, err := n.isRegistrantOrOperator(ctx, opts.From)
+	if err != nil {
+		return nil, err
+	}
+	if !authorised {
+		return nil, withReason(ErrNotAuthorised, "not the registrant")
 	}
 	return n.registrar.Reclaim(opts, n.Name, registrant)
 }
 
+// isControllerOrOperator returns true if the sender is the controller or an
+// operator approved by the controller in the registry.
+func (n *Name) isControllerOrOperator(ctx context.Context, controller common.Address, sender common.Address) (bool, error) {
+	if controller == sender {
+		return true, nil
+	}
+	if controller == UnknownAddress {
+		return false, nil
+	}
+	return n.registry.IsApprovedCtx(ctx, controller, sender)
+}
+
+// isRegistrantOrOperator returns true if the sender is the registrant or is
+// approved by the registrant to transfer the name in the registrar.
+func (n *Name) isRegistrantOrOperator(ctx context.Context, sender common.Address) (bool, error) {
+	registrant, err := n.RegistrantCtx(ctx)
+	if err != nil {
+		return false, err
+	}
+	if registrant == UnknownAddress {
+		return false, nil
+	}
+	if registrant == sender {
+		return true, nil
+	}
+	return n.registrar.IsApprovedCtx(ctx, n.Name, sender)
+}
+
 // Registrant obtains the registrant for this name.
 func (n *Name) Registrant() (common.Address, error) {
-	owner, err := n.registry.Owner(n.Name)
+	return n.RegistrantCtx(context.Background())
+}
+
+// RegistrantCtx is as per Registrant, with a context.
+func (n *Name) RegistrantCtx(ctx context.Context) (common.Address, error) {
+	owner, err := n.registry.OwnerCtx(ctx, n.Name)
 	if err != nil {
 		return zeroAddress, err
 	}
 	if owner == zeroAddress {
 		return owner, err
 	}
-	return n.registrar.Owner(n.Label)
+	return n.registrar.OwnerCtx(ctx, n.Label)
 }
 
 // Transfer transfers the registration of this name to a new registrant.
 func (n *Name) Transfer(registrant common.Address, opts *bind.TransactOpts) (*types.Transaction, error) {
-	// Ensure the we are the registrant
-	currentRegistrant, err := n.Registrant()
+	opts, err := n.Policy.apply(opts)
+	if err != nil {
+		return nil, err
+	}
+	// Ensure the we are the registrant or its operator
+	authorised, err := n.isRegistrantOrOperator(optsContext(opts), opts.From)
 	if err != nil {
 		return nil, err
 	}
-	if currentRegistrant != opts.From {
-		return nil, errors.New("not the current registrant")
+	if !authorised {
+		return nil, withReason(ErrNotAuthorised, "not the current registrant")
 	}
 	return n.registrar.SetOwner(opts, n.Label, registrant)
 }
 
 // RentCost returns the cost of rent in Wei-per-second.
 func (n *Name) RentCost() (*big.Int, error) {
-	return n.controller.RentCost(n.Label)
+	return n.RentCostCtx(context.Background())
+}
+
+// RentCostCtx is as per RentCost, with a context.
+func (n *Name) RentCostCtx(ctx context.Context) (*big.Int, error) {
+	return n.controller.RentCostCtx(ctx, n.Label)
 }
 
 // CreateSubdomain creates a subdomain on the name.
 func (n *Name) CreateSubdomain(label string, controller common.Address, opts *bind.TransactOpts) (*types.Transaction, error) {
+	opts, err := n.Policy.apply(opts)
+	if err != nil {
+		return nil, err
+	}
 	// Confirm the subdomain does not already exist
 	fqdn := fmt.Sprintf("%s.%s", label, n.Name)
-	subdomainController, err := n.registry.Owner(fqdn)
+	subdomainController, err := n.registry.OwnerCtx(optsContext(opts), fqdn)
 	if err != nil {
 		return nil, err
 	}
@@ -293,20 +458,53 @@ func (n *Name) CreateSubdomain(label string, controller common.Address, opts *bi
 
 // ResolverAddress fetches the address of the resolver contract for the name.
 func (n *Name) ResolverAddress() (common.Address, error) {
-	return n.registry.ResolverAddress(n.Name)
+	return n.ResolverAddressCtx(context.Background())
+}
+
+// ResolverAddressCtx is as per ResolverAddress, with a context.
+func (n *Name) ResolverAddressCtx(ctx context.Context) (common.Address, error) {
+	return n.registry.ResolverAddressCtx(ctx, n.Name)
 }
 
 // SetResolverAddress sets the resolver contract address for the name.
 func (n *Name) SetResolverAddress(address common.Address, opts *bind.TransactOpts) (*types.Transaction, error) {
+	opts, err := n.Policy.apply(opts)
+	if err != nil {
+		return nil, err
+	}
 	return n.registry.SetResolver(opts, n.Name, address)
 }
 
+// TTL fetches the time for which records of the name may be cached.
+func (n *Name) TTL() (time.Duration, error) {
+	return n.TTLCtx(context.Background())
+}
+
+// TTLCtx is as per TTL, with a context.
+func (n *Name) TTLCtx(ctx context.Context) (time.Duration, error) {
+	return n.registry.TTLCtx(ctx, n.Name)
+}
+
+// SetTTL sets the time for which records of the name may be cached.
+func (n *Name) SetTTL(ttl time.Duration, opts *bind.TransactOpts) (*types.Transaction, error) {
+	opts, err := n.Policy.apply(opts)
+	if err != nil {
+		return nil, err
+	}
+	return n.registry.SetTTL(opts, n.Name, ttl)
+}
+
 // Address fetches the address of the name for a given coin type.
 // Coin types are defined at https://github.com/satoshilabs/slips/blob/master/slip-0044.md
 func (n *Name) Address(coinType uint64) ([]byte, error) {
-	resolver, err := NewResolver(n.backend, n.Name)
+	return n.AddressCtx(context.Background(), coinType)
+}
+
+// AddressCtx is as per Address, with a context.
+func (n *Name) AddressCtx(ctx context.Context, coinType uint64) ([]byte, error) {
+	resolver, err := NewResolverCtx(ctx, n.backend, n.Name)
 	if err != nil {
 		return nil, err
 	}
-	return resolver.MultiAddress(coinType)
+	return resolver.MultiAddressCtx(ctx, coinType)
 }
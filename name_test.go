@@ -29,6 +29,8 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/jw-1ns/go-1ns/contracts/baseregistrar"
+	"github.com/jw-1ns/go-1ns/contracts/registry"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -674,3 +676,44 @@ func hasPrivateKey(address common.Address) bool {
 	_, err := crypto.HexToECDSA(os.Getenv(fmt.Sprintf("PRIVATE_KEY_%x", address)))
 	return err == nil
 }
+
+func TestNameOperator(t *testing.T) {
+	alice := tconfig.testAccounts.aliceAddress
+	bob := tconfig.testAccounts.bobAddress
+	carol := tconfig.testAccounts.carolAddress
+	stranger := common.HexToAddress("0x0000000000000000000000000000000000000099")
+	backend := newStubBackend()
+	name := newStubName(t, time.Now().Add(time.Hour).Unix(), false, 0)
+	reg, err := NewRegistry(backend)
+	require.Nil(t, err, "Failed to create registry")
+	name.registry = reg
+	name.registrar = newStubBaseRegistrar(t, backend, alice)
+	backend.handle(config.Registry, registry.ContractMetaData, "owner", returns(alice))
+	backend.handle(config.Registry, registry.ContractMetaData, "isApprovedForAll", func(args []interface{}) ([]interface{}, error) {
+		return []interface{}{args[0] == alice && args[1] == bob}, nil
+	})
+	backend.handle(registrarTestAddress, baseregistrar.ContractMetaData, "isApprovedForAll", returns(false))
+	backend.handle(registrarTestAddress, baseregistrar.ContractMetaData, "getApproved", returns(carol))
+
+	// A registry operator changes the controller directly
+	tx, err := name.SetController(carol, stubTxOpts(bob))
+	require.Nil(t, err, "Failed to set controller as registry operator")
+	method, _, err := stubTxCall(registry.ContractMetaData, tx)
+	require.Nil(t, err, "Failed to decode transaction")
+	assert.Equal(t, "setOwner", method)
+
+	// A registrar operator reclaims
+	tx, err = name.SetController(carol, stubTxOpts(carol))
+	require.Nil(t, err, "Failed to set controller as registrar operator")
+	method, args, err := stubTxCall(baseregistrar.ContractMetaData, tx)
+	require.Nil(t, err, "Failed to decode transaction")
+	assert.Equal(t, "reclaim", method)
+	assert.Equal(t, carol, args[1])
+	_, err = name.Transfer(bob, stubTxOpts(carol))
+	assert.Nil(t, err, "Failed to transfer as registrar operator")
+
+	_, err = name.SetController(stranger, stubTxOpts(stranger))
+	assert.EqualError(t, err, "not authorised to change the controller")
+	_, err = name.Transfer(stranger, stubTxOpts(bob))
+	assert.EqualError(t, err, "not the current registrant")
+}
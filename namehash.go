@@ -16,19 +16,22 @@
 package onens
 
 import (
+	"encoding/hex"
+	"fmt"
 	"strings"
 
-	"golang.org/x/net/idna"
-
+	"github.com/ethereum/go-ethereum/common"
 	"golang.org/x/crypto/sha3"
+	"golang.org/x/net/idna"
 )
 
 var p = idna.New(idna.MapForLookup(), idna.StrictDomainName(false), idna.Transitional(false))
 var pStrict = idna.New(idna.MapForLookup(), idna.StrictDomainName(true), idna.Transitional(false))
 
-// Normalize normalizes a name according to the ENS rules
+// Normalize normalizes a name according to the ENS rules.
+// Encoded labels of the form '[<labelhash>]' are validated and passed through.
 func Normalize(input string) (output string, err error) {
-	output, err = p.ToUnicode(input)
+	output, err = toUnicode(p, input)
 	if err != nil {
 		return
 	}
@@ -40,7 +43,12 @@ func Normalize(input string) (output string, err error) {
 }
 
 // LabelHash generates a simple hash for a piece of a name.
+// The label is added to DefaultLabelStore.  If the label is in the encoded
+// form '[<labelhash>]' then the labelhash is returned directly.
 func LabelHash(label string) (hash [32]byte, err error) {
+	if isEncodedLabel(label) {
+		return DecodeLabelHash(label)
+	}
 	normalizedLabel, err := Normalize(label)
 	if err != nil {
 		return
@@ -51,11 +59,14 @@ func LabelHash(label string) (hash [32]byte, err error) {
 		return
 	}
 	sha.Sum(hash[:0])
+	DefaultLabelStore.add(hash, normalizedLabel)
 	return
 }
 
 // NameHash generates a hash from a name that can be used to
-// look up the name in ENS
+// look up the name in ENS.
+// The labels of the name are added to DefaultLabelStore.  Labels in the
+// encoded form '[<labelhash>]' use the labelhash directly.
 func NameHash(name string) (hash [32]byte, err error) {
 	if name == "" {
 		return
@@ -78,14 +89,84 @@ func nameHashPart(currentHash [32]byte, name string) (hash [32]byte, err error)
 	if _, err = sha.Write(currentHash[:]); err != nil {
 		return
 	}
-	nameSha := sha3.NewLegacyKeccak256()
-	if _, err = nameSha.Write([]byte(name)); err != nil {
-		return
+	var nameHash []byte
+	if isEncodedLabel(name) {
+		var labelHash [32]byte
+		if labelHash, err = DecodeLabelHash(name); err != nil {
+			return
+		}
+		nameHash = labelHash[:]
+	} else {
+		nameSha := sha3.NewLegacyKeccak256()
+		if _, err = nameSha.Write([]byte(name)); err != nil {
+			return
+		}
+		nameHash = nameSha.Sum(nil)
+		DefaultLabelStore.add(common.BytesToHash(nameHash), name)
 	}
-	nameHash := nameSha.Sum(nil)
 	if _, err = sha.Write(nameHash); err != nil {
 		return
 	}
 	sha.Sum(hash[:0])
 	return
 }
+
+// DecodeLabelHash obtains the labelhash from a label in the encoded form
+// '[<labelhash>]', where the labelhash is 64 hex characters.
+func DecodeLabelHash(label string) (hash [32]byte, err error) {
+	if len(label) != 66 || label[0] != '[' || label[65] != ']' {
+		return hash, fmt.Errorf("invalid encoded label %s", label)
+	}
+	if _, err = hex.Decode(hash[:], []byte(label[1:65])); err != nil {
+		return hash, fmt.Errorf("invalid encoded label %s", label)
+	}
+	return
+}
+
+// isEncodedLabel returns true if the label appears to be in the encoded form
+// '[<labelhash>]'.  It does not validate the labelhash.
+func isEncodedLabel(label string) bool {
+	return strings.HasPrefix(label, "[") && strings.HasSuffix(label, "]")
+}
+
+// encodedLabelPlaceholder stands in for encoded labels when normalising.
+const encodedLabelPlaceholder = "x"
+
+// toUnicode normalises a name with the given profile.  Encoded labels are
+// validated and replaced with their canonical form, as the profile may not
+// permit them.
+func toUnicode(profile *idna.Profile, name string) (string, error) {
+	if !strings.ContainsAny(name, "[]") {
+		return profile.ToUnicode(name)
+	}
+
+	labels := strings.Split(name, ".")
+	encoded := make(map[int]string)
+	for i, label := range labels {
+		// Labels with stray brackets are malformed encoded labels, rejected
+		// here rather than hashed as text
+		if !strings.ContainsAny(label, "[]") {
+			continue
+		}
+		hash, err := DecodeLabelHash(label)
+		if err != nil {
+			return "", err
+		}
+		// Indexed from the end, as normalising can remove leading periods
+		encoded[len(labels)-i] = EncodeLabelHash(hash)
+		labels[i] = encodedLabelPlaceholder
+	}
+
+	output, err := profile.ToUnicode(strings.Join(labels, "."))
+	if err != nil {
+		return "", err
+	}
+	labels = strings.Split(output, ".")
+	for pos, label := range encoded {
+		if pos > len(labels) || labels[len(labels)-pos] != encodedLabelPlaceholder {
+			return "", fmt.Errorf("failed to normalise %s", name)
+		}
+		labels[len(labels)-pos] = label
+	}
+	return strings.Join(labels, "."), nil
+}
@@ -17,6 +17,7 @@ package onens
 
 import (
 	"encoding/hex"
+	"errors"
 	"testing"
 )
 
@@ -37,6 +38,13 @@ func TestNameHash(t *testing.T) {
 		{"bar.foo.eth", "275ae88e7263cdce5ab6cf296cdd6253f5e385353fe39cfff2dd4a2b14551cf3", nil},
 		{"Bar.foo.eth", "275ae88e7263cdce5ab6cf296cdd6253f5e385353fe39cfff2dd4a2b14551cf3", nil},
 		{"addr.reverse", "91d1777781884d03a6757a803996e38de2a42967fb37eeaca72729271025a9e2", nil},
+		{"[41b1a0649752af1b28b3dc29a1556eee781e4a4c3a1f7f53f90fa834de098c4d].eth", "de9b09fd7c5f901e23a3f19fecc54828e9c848539801e86591bd9801b019f84f", nil},
+		{"[41B1A0649752AF1B28B3DC29A1556EEE781E4A4C3A1F7F53F90FA834DE098C4D].eth", "de9b09fd7c5f901e23a3f19fecc54828e9c848539801e86591bd9801b019f84f", nil},
+		{"bar.[41b1a0649752af1b28b3dc29a1556eee781e4a4c3a1f7f53f90fa834de098c4d].eth", "275ae88e7263cdce5ab6cf296cdd6253f5e385353fe39cfff2dd4a2b14551cf3", nil},
+		{"[41b1a0].eth", "", errors.New("invalid encoded label [41b1a0]")},
+		{"[41b1a0649752af1b28b3dc29a1556eee781e4a4c3a1f7f53f90fa834de098c4x].eth", "", errors.New("invalid encoded label [41b1a0649752af1b28b3dc29a1556eee781e4a4c3a1f7f53f90fa834de098c4x]")},
+		{"Q41b1a0649752af1b28b3dc29a1556eee781e4a4c3a1f7f53f90fa834de098c4d].eth", "", errors.New("invalid encoded label Q41b1a0649752af1b28b3dc29a1556eee781e4a4c3a1f7f53f90fa834de098c4d]")},
+		{"[41b1a0649752af1b28b3dc29a1556eee781e4a4c3a1f7f53f90fa834de098c4dZ.eth", "", errors.New("invalid encoded label [41b1a0649752af1b28b3dc29a1556eee781e4a4c3a1f7f53f90fa834de098c4dZ")},
 	}
 
 	for _, tt := range tests {
@@ -68,6 +76,10 @@ func TestLabelHash(t *testing.T) {
 		{"", "c5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470", nil},
 		{"eth", "4f5b812789fc606be1b3b16908db13fc7a9adf7ca72641f84d75b47069d3d7f0", nil},
 		{"foo", "41b1a0649752af1b28b3dc29a1556eee781e4a4c3a1f7f53f90fa834de098c4d", nil},
+		{"[41b1a0649752af1b28b3dc29a1556eee781e4a4c3a1f7f53f90fa834de098c4d]", "41b1a0649752af1b28b3dc29a1556eee781e4a4c3a1f7f53f90fa834de098c4d", nil},
+		{"[foo]", "", errors.New("invalid encoded label [foo]")},
+		{"[41b1a0649752af1b28b3dc29a1556eee781e4a4c3a1f7f53f90fa834de098c4d)", "", errors.New("invalid encoded label [41b1a0649752af1b28b3dc29a1556eee781e4a4c3a1f7f53f90fa834de098c4d)")},
+		{"(41b1a0649752af1b28b3dc29a1556eee781e4a4c3a1f7f53f90fa834de098c4d]", "", errors.New("invalid encoded label (41b1a0649752af1b28b3dc29a1556eee781e4a4c3a1f7f53f90fa834de098c4d]")},
 	}
 
 	for _, tt := range tests {
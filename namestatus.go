@@ -0,0 +1,157 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+)
+
+// DefaultPremiumDecayPeriod is the period after the end of the grace period
+// over which the premium for a recently-expired name decays to zero, unless
+// the name sets another.  The price oracle does not expose this, so it is
+// that of the deployed oracle.
+const DefaultPremiumDecayPeriod = 21 * 24 * time.Hour
+
+// NameState is the state of a name in its registration lifecycle.
+type NameState int
+
+const (
+	// NameAvailable is a name that can be registered at the base price.
+	NameAvailable NameState = iota
+	// NameRegistered is a name with a current registration.
+	NameRegistered
+	// NameInGracePeriod is an expired name that can only be renewed.
+	NameInGracePeriod
+	// NamePremiumAuction is an expired name that can be registered at a
+	// premium that decays over time.
+	NamePremiumAuction
+	// NameReserved is an unregistered name that the controller will not
+	// register.
+	NameReserved
+)
+
+func (s NameState) String() string {
+	switch s {
+	case NameAvailable:
+		return "available"
+	case NameRegistered:
+		return "registered"
+	case NameInGracePeriod:
+		return "in grace period"
+	case NamePremiumAuction:
+		return "premium auction"
+	case NameReserved:
+		return "reserved"
+	default:
+		return "unknown"
+	}
+}
+
+// NameStatus is the state of a name along with the times at which it
+// changes.  Times are zero if the name has never been registered.
+type NameStatus struct {
+	State NameState
+	// Expiry is the time at which the registration expires
+	Expiry time.Time
+	// GracePeriodEnd is the time at which the name can be registered by
+	// anyone
+	GracePeriodEnd time.Time
+	// PremiumEnd is the time at which the premium decays to zero
+	PremiumEnd time.Time
+	// Premium is the current premium in Wei, on top of the base rent
+	Premium *big.Int
+}
+
+// Status obtains the state of the name in its registration lifecycle.
+func (n *Name) Status() (*NameStatus, error) {
+	return n.StatusCtx(context.Background())
+}
+
+// StatusCtx is as per Status, with a context.
+func (n *Name) StatusCtx(ctx context.Context) (*NameStatus, error) {
+	status := &NameStatus{
+		Premium: big.NewInt(0),
+	}
+
+	expiryTS, err := n.registrar.ExpiryCtx(ctx, n.Name)
+	if err != nil {
+		return nil, err
+	}
+	if expiryTS.Sign() == 0 {
+		available, err := n.controller.IsAvailableCtx(ctx, n.Name)
+		if err != nil {
+			return nil, err
+		}
+		if available {
+			status.State = NameAvailable
+		} else {
+			status.State = NameReserved
+		}
+		return status, nil
+	}
+
+	gracePeriod, err := n.registrar.GracePeriodCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status.Expiry = time.Unix(expiryTS.Int64(), 0)
+	status.GracePeriodEnd = status.Expiry.Add(gracePeriod)
+	premiumDecayPeriod := n.PremiumDecayPeriod
+	if premiumDecayPeriod == 0 {
+		premiumDecayPeriod = DefaultPremiumDecayPeriod
+	}
+	status.PremiumEnd = status.GracePeriodEnd.Add(premiumDecayPeriod)
+
+	now := time.Now()
+	switch {
+	case now.Before(status.Expiry):
+		status.State = NameRegistered
+		return status, nil
+	case now.Before(status.GracePeriodEnd):
+		status.State = NameInGracePeriod
+		return status, nil
+	}
+
+	name, err := UnqualifiedName(n.Name, n.Domain)
+	if err != nil {
+		return nil, err
+	}
+	price, err := n.controller.RentPrice(&bind.CallOpts{Context: ctx}, name, big.NewInt(1))
+	if err != nil {
+		return nil, err
+	}
+	if price.Premium != nil && price.Premium.Sign() > 0 {
+		status.State = NamePremiumAuction
+		status.Premium = price.Premium
+		return status, nil
+	}
+
+	// The controller can refuse names that have expired, as for those
+	// never registered
+	available, err := n.controller.IsAvailableCtx(ctx, n.Name)
+	if err != nil {
+		return nil, err
+	}
+	if available {
+		status.State = NameAvailable
+	} else {
+		status.State = NameReserved
+	}
+	return status, nil
+}
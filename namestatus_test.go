@@ -0,0 +1,103 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jw-1ns/go-1ns/contracts/baseregistrar"
+	"github.com/jw-1ns/go-1ns/contracts/registrarcontroller"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var controllerTestAddress = common.HexToAddress("0x2000000000000000000000000000000000000002")
+
+// newStubName creates a name with the given expiry, availability and
+// premium.
+func newStubName(t *testing.T, expiry int64, available bool, premium int64) *Name {
+	backend := newStubBackend()
+	registrar := newStubBaseRegistrar(t, backend, tconfig.testAccounts.aliceAddress)
+	backend.handle(registrarTestAddress, baseregistrar.ContractMetaData, "nameExpires", returns(big.NewInt(expiry)))
+	backend.handle(registrarTestAddress, baseregistrar.ContractMetaData, "GRACE_PERIOD", returns(big.NewInt(90*24*60*60)))
+	backend.handle(controllerTestAddress, registrarcontroller.ContractMetaData, "available", returns(available))
+	backend.handle(controllerTestAddress, registrarcontroller.ContractMetaData, "rentPrice", returns(registrarcontroller.IPriceOraclePrice{
+		Base:    big.NewInt(1000),
+		Premium: big.NewInt(premium),
+	}))
+	controller, err := NewRegistrarControllerAt(backend, "country", controllerTestAddress)
+	require.Nil(t, err, "Failed to create controller")
+
+	return &Name{
+		backend:    backend,
+		Name:       "status.country",
+		Domain:     "country",
+		Label:      "status",
+		registrar:  registrar,
+		controller: controller,
+	}
+}
+
+func TestNameStatus(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+	tests := []struct {
+		name      string
+		expiry    time.Time
+		available bool
+		premium   int64
+		state     NameState
+	}{
+		{name: "Available", available: true, state: NameAvailable},
+		{name: "Reserved", available: false, state: NameReserved},
+		{name: "Registered", expiry: now.Add(day), state: NameRegistered},
+		{name: "GracePeriod", expiry: now.Add(-day), state: NameInGracePeriod},
+		{name: "PremiumAuction", expiry: now.Add(-91 * day), available: true, premium: 500, state: NamePremiumAuction},
+		{name: "Expired", expiry: now.Add(-200 * day), available: true, state: NameAvailable},
+		{name: "ExpiredReserved", expiry: now.Add(-200 * day), available: false, state: NameReserved},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expiry := int64(0)
+			if !test.expiry.IsZero() {
+				expiry = test.expiry.Unix()
+			}
+			status, err := newStubName(t, expiry, test.available, test.premium).Status()
+			require.Nil(t, err, "Failed to obtain status")
+			assert.Equal(t, test.state, status.State)
+			assert.Equal(t, test.premium, status.Premium.Int64())
+			if expiry == 0 {
+				assert.True(t, status.Expiry.IsZero())
+				return
+			}
+			assert.Equal(t, expiry, status.Expiry.Unix())
+			assert.Equal(t, status.Expiry.Add(90*day), status.GracePeriodEnd)
+			assert.Equal(t, status.GracePeriodEnd.Add(DefaultPremiumDecayPeriod), status.PremiumEnd)
+		})
+	}
+}
+
+func TestNameStatusPremiumDecayPeriod(t *testing.T) {
+	name := newStubName(t, time.Now().Add(-91*24*time.Hour).Unix(), true, 500)
+	name.PremiumDecayPeriod = 28 * 24 * time.Hour
+	status, err := name.Status()
+	require.Nil(t, err, "Failed to obtain status")
+	assert.Equal(t, NamePremiumAuction, status.State)
+	assert.Equal(t, status.GracePeriodEnd.Add(28*24*time.Hour), status.PremiumEnd)
+}
@@ -0,0 +1,148 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jw-1ns/go-1ns/contracts/namewrapper"
+)
+
+// NameWrapper is the structure for the name wrapper contract
+type NameWrapper struct {
+	backend      bind.ContractBackend
+	Contract     *namewrapper.Contract
+	ContractAddr common.Address
+}
+
+// NewNameWrapper obtains the name wrapper used by the registrar controller
+// for a given domain
+func NewNameWrapper(backend bind.ContractBackend, domain string) (*NameWrapper, error) {
+	return NewNameWrapperCtx(context.Background(), backend, domain)
+}
+
+// NewNameWrapperCtx is as per NewNameWrapper, with a context.
+func NewNameWrapperCtx(ctx context.Context, backend bind.ContractBackend, domain string) (*NameWrapper, error) {
+	controller, err := NewRegistrarControllerCtx(ctx, backend, domain)
+	if err != nil {
+		return nil, err
+	}
+	address, err := controller.NameWrapperCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewNameWrapperAt(backend, address)
+}
+
+// NewNameWrapperAt obtains the name wrapper at a given address
+func NewNameWrapperAt(backend bind.ContractBackend, address common.Address) (*NameWrapper, error) {
+	contract, err := namewrapper.NewContract(address, backend)
+	if err != nil {
+		return nil, err
+	}
+	return &NameWrapper{
+		backend:      backend,
+		Contract:     contract,
+		ContractAddr: address,
+	}, nil
+}
+
+// IsWrapped returns true if the name is held by the name wrapper
+func (w *NameWrapper) IsWrapped(name string) (bool, error) {
+	return w.IsWrappedCtx(context.Background(), name)
+}
+
+// IsWrappedCtx is as per IsWrapped, with a context.
+func (w *NameWrapper) IsWrappedCtx(ctx context.Context, name string) (bool, error) {
+	nameHash, err := NameHash(name)
+	if err != nil {
+		return false, err
+	}
+	return w.Contract.IsWrapped(&bind.CallOpts{Context: ctx}, nameHash)
+}
+
+// Owner returns the owner of the wrapped token for a name
+func (w *NameWrapper) Owner(name string) (common.Address, error) {
+	return w.OwnerCtx(context.Background(), name)
+}
+
+// OwnerCtx is as per Owner, with a context.
+func (w *NameWrapper) OwnerCtx(ctx context.Context, name string) (common.Address, error) {
+	nameHash, err := NameHash(name)
+	if err != nil {
+		return UnknownAddress, err
+	}
+	return w.Contract.OwnerOf(&bind.CallOpts{Context: ctx}, new(big.Int).SetBytes(nameHash[:]))
+}
+
+// nameWrapperOf returns the name wrapper holding a name, or nil if the name is
+// not wrapped.  A name is wrapped if its owner in the registry is a contract
+// that reports the name as wrapped.
+func nameWrapperOf(ctx context.Context, backend bind.ContractBackend, registry *Registry, name string) (*NameWrapper, error) {
+	owner, err := registry.OwnerCtx(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if owner == UnknownAddress {
+		return nil, nil
+	}
+	code, err := backend.CodeAt(ctx, owner, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(code) == 0 {
+		return nil, nil
+	}
+	wrapped, err := isWrappedBy(ctx, backend, owner, name)
+	if err != nil || !wrapped {
+		return nil, err
+	}
+	return NewNameWrapperAt(backend, owner)
+}
+
+// isWrappedBy returns true if a contract is a name wrapper that reports a
+// name as wrapped.  Contracts that are not name wrappers revert, or return
+// output that is not a boolean; anything else is a failure of the call.
+func isWrappedBy(ctx context.Context, backend bind.ContractBackend, contract common.Address, name string) (bool, error) {
+	nameHash, err := NameHash(name)
+	if err != nil {
+		return false, err
+	}
+	parsed, err := namewrapper.ContractMetaData.GetAbi()
+	if err != nil {
+		return false, err
+	}
+	data, err := parsed.Pack("isWrapped", nameHash)
+	if err != nil {
+		return false, err
+	}
+	output, err := backend.CallContract(ctx, ethereum.CallMsg{To: &contract, Data: data}, nil)
+	if err != nil {
+		if isReverted(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	values, err := parsed.Unpack("isWrapped", output)
+	if err != nil || len(values) != 1 {
+		return false, nil
+	}
+	wrapped, _ := values[0].(bool)
+	return wrapped, nil
+}
@@ -0,0 +1,181 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jw-1ns/go-1ns/util"
+	"github.com/pkg/errors"
+)
+
+// OfflineTx is an unsigned transaction prepared for signing elsewhere, for
+// example by an air-gapped key.
+type OfflineTx struct {
+	ChainID *big.Int       `json:"chainId"`
+	From    common.Address `json:"from"`
+	// Summary is a human-readable description of the call, to be checked
+	// before signing
+	Summary string `json:"summary"`
+	// Tx is the unsigned transaction, with its nonce, gas and fees set
+	Tx *types.Transaction `json:"tx"`
+}
+
+// PrepareTx prepares the transaction created by a state-changing call for
+// signing offline.  The call is passed transaction options that capture the
+// transaction rather than signing and sending it, so the transaction is
+// exactly that which would have been sent; for example:
+//
+//	offline, err := onens.PrepareTx(ctx, chainID, opts, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+//		return name.Transfer(newRegistrant, opts)
+//	})
+//
+// The nonce, gas limit and fees are taken from opts if set, and obtained
+// from the backend of the called contract otherwise.
+func PrepareTx(ctx context.Context, chainID *big.Int, opts *bind.TransactOpts, fn func(opts *bind.TransactOpts) (*types.Transaction, error)) (*OfflineTx, error) {
+	if opts == nil {
+		return nil, errors.New("transaction options required")
+	}
+	if chainID == nil {
+		return nil, errors.New("chain ID required")
+	}
+	prepared := *opts
+	if prepared.Context == nil {
+		prepared.Context = ctx
+	}
+	prepared.Signer = func(_ common.Address, tx *types.Transaction) (*types.Transaction, error) {
+		return tx, nil
+	}
+	prepared.NoSend = true
+	tx, err := fn(&prepared)
+	if err != nil {
+		return nil, err
+	}
+	if tx.To() == nil {
+		return nil, errors.New("cannot prepare contract creation")
+	}
+
+	method, args, err := decodeCall(*tx.To(), tx.Data())
+	if err != nil {
+		return nil, err
+	}
+	return &OfflineTx{
+		ChainID: chainID,
+		From:    opts.From,
+		Summary: summariseCall(*tx.To(), tx.Value(), method, args),
+		Tx:      util.WithChainID(tx, chainID),
+	}, nil
+}
+
+// LoadOfflineTx loads a prepared transaction from its JSON form.
+func LoadOfflineTx(data []byte) (*OfflineTx, error) {
+	var offline OfflineTx
+	if err := json.Unmarshal(data, &offline); err != nil {
+		return nil, errors.Wrap(err, "invalid prepared transaction")
+	}
+	if offline.ChainID == nil || offline.Tx == nil {
+		return nil, errors.New("incomplete prepared transaction")
+	}
+	return &offline, nil
+}
+
+// JSON returns the prepared transaction in JSON form, which includes the
+// chain ID, sender and summary along with the transaction.
+func (o *OfflineTx) JSON() ([]byte, error) {
+	return json.MarshalIndent(o, "", "  ")
+}
+
+// RLP returns the unsigned transaction in its binary form: RLP for legacy
+// transactions, and the typed envelope for others.  The chain ID of legacy
+// transactions is not included, and must be supplied to the signer.
+func (o *OfflineTx) RLP() ([]byte, error) {
+	return o.Tx.MarshalBinary()
+}
+
+// Sign signs the prepared transaction, for use where the key is available.
+func (o *OfflineTx) Sign(ctx context.Context, signer util.Signer) (*types.Transaction, error) {
+	if signer.Address() != o.From {
+		return nil, fmt.Errorf("signer %s is not the sender %s", signer.Address().Hex(), o.From.Hex())
+	}
+	return signer.SignTx(ctx, o.Tx, o.ChainID)
+}
+
+// Import decodes a signed transaction, in binary, hex or JSON form, and
+// checks that it is the prepared transaction signed by the sender.
+func (o *OfflineTx) Import(data []byte) (*types.Transaction, error) {
+	signed, err := decodeSignedTx(data)
+	if err != nil {
+		return nil, err
+	}
+	signer := types.LatestSignerForChainID(o.ChainID)
+	sender, err := types.Sender(signer, signed)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid signature")
+	}
+	if sender != o.From {
+		return nil, fmt.Errorf("transaction signed by %s rather than %s", sender.Hex(), o.From.Hex())
+	}
+	if signer.Hash(signed) != signer.Hash(o.Tx) {
+		return nil, errors.New("signed transaction does not match the prepared transaction")
+	}
+	return signed, nil
+}
+
+// Broadcast imports a signed transaction, as per Import, and sends it.
+func (o *OfflineTx) Broadcast(ctx context.Context, backend bind.ContractTransactor, data []byte) (*types.Transaction, error) {
+	signed, err := o.Import(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := backend.SendTransaction(ctx, signed); err != nil {
+		return nil, err
+	}
+	return signed, nil
+}
+
+// decodeSignedTx decodes a transaction in binary, hex or JSON form.
+func decodeSignedTx(data []byte) (*types.Transaction, error) {
+	data = bytes.TrimSpace(data)
+	tx := new(types.Transaction)
+	switch {
+	case len(data) == 0:
+		return nil, errors.New("no signed transaction")
+	case data[0] == '{':
+		if err := tx.UnmarshalJSON(data); err != nil {
+			return nil, errors.Wrap(err, "invalid signed transaction")
+		}
+	case bytes.HasPrefix(data, []byte("0x")):
+		raw, err := hexutil.Decode(string(data))
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid signed transaction")
+		}
+		if err := tx.UnmarshalBinary(raw); err != nil {
+			return nil, errors.Wrap(err, "invalid signed transaction")
+		}
+	default:
+		if err := tx.UnmarshalBinary(data); err != nil {
+			return nil, errors.Wrap(err, "invalid signed transaction")
+		}
+	}
+	return tx, nil
+}
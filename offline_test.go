@@ -0,0 +1,119 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/jw-1ns/go-1ns/contracts/registry"
+	"github.com/jw-1ns/go-1ns/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var offlineTestChainID = big.NewInt(1666700000)
+
+func offlineTestPrepare(t *testing.T, backend *stubBackend, signer util.Signer) *OfflineTx {
+	reg, err := NewRegistry(backend)
+	require.Nil(t, err, "Failed to create registry")
+	offline, err := PrepareTx(context.Background(), offlineTestChainID, &bind.TransactOpts{From: signer.Address()}, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return reg.SetTTL(opts, "test.country", time.Hour)
+	})
+	require.Nil(t, err, "Failed to prepare transaction")
+	return offline
+}
+
+func TestOfflineLegacy(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.Nil(t, err, "Failed to generate key")
+	signer := util.NewPrivateKeySigner(key)
+	backend := newStubBackend()
+	backend.nonces[signer.Address()] = 4
+	backend.handle(config.Registry, registry.ContractMetaData, "setTTL", returns())
+
+	offline := offlineTestPrepare(t, backend, signer)
+	assert.Equal(t, uint64(4), offline.Tx.Nonce())
+	assert.Equal(t, uint64(100000), offline.Tx.Gas())
+	assert.Equal(t, big.NewInt(1000000000), offline.Tx.GasPrice())
+	assert.Contains(t, offline.Summary, "setTTL(")
+	assert.Empty(t, backend.sent)
+
+	// Round trip through JSON, as if carried to the air-gapped machine
+	data, err := offline.JSON()
+	require.Nil(t, err, "Failed to export transaction")
+	loaded, err := LoadOfflineTx(data)
+	require.Nil(t, err, "Failed to load transaction")
+	assert.Equal(t, offline.Tx.Hash(), loaded.Tx.Hash())
+	assert.Equal(t, offlineTestChainID, loaded.ChainID)
+	signed, err := loaded.Sign(context.Background(), signer)
+	require.Nil(t, err, "Failed to sign transaction")
+
+	raw, err := signed.MarshalBinary()
+	require.Nil(t, err, "Failed to encode signed transaction")
+	sent, err := offline.Broadcast(context.Background(), backend, []byte(hexutil.Encode(raw)))
+	require.Nil(t, err, "Failed to broadcast transaction")
+	assert.Equal(t, signed.Hash(), sent.Hash())
+	require.Len(t, backend.sent, 1)
+
+	// Transactions signed by others, or altered, are rejected
+	otherKey, err := crypto.GenerateKey()
+	require.Nil(t, err, "Failed to generate key")
+	other, err := util.NewPrivateKeySigner(otherKey).SignTx(context.Background(), offline.Tx, offlineTestChainID)
+	require.Nil(t, err, "Failed to sign transaction")
+	raw, err = other.MarshalBinary()
+	require.Nil(t, err, "Failed to encode signed transaction")
+	_, err = offline.Import(raw)
+	assert.EqualError(t, err, "transaction signed by "+util.NewPrivateKeySigner(otherKey).Address().Hex()+" rather than "+signer.Address().Hex())
+
+	altered, err := signer.SignTx(context.Background(), util.WithGas(offline.Tx, 200000), offlineTestChainID)
+	require.Nil(t, err, "Failed to sign transaction")
+	raw, err = altered.MarshalJSON()
+	require.Nil(t, err, "Failed to encode signed transaction")
+	_, err = offline.Import(raw)
+	assert.EqualError(t, err, "signed transaction does not match the prepared transaction")
+}
+
+func TestOfflineDynamic(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.Nil(t, err, "Failed to generate key")
+	signer := util.NewPrivateKeySigner(key)
+	backend := newStubBackend()
+	backend.baseFee = big.NewInt(2000000000)
+	backend.handle(config.Registry, registry.ContractMetaData, "setTTL", returns())
+
+	offline := offlineTestPrepare(t, backend, signer)
+	assert.Equal(t, uint8(types.DynamicFeeTxType), offline.Tx.Type())
+	assert.Equal(t, offlineTestChainID, offline.Tx.ChainId())
+
+	// The binary form can be decoded and signed as-is
+	data, err := offline.RLP()
+	require.Nil(t, err, "Failed to export transaction")
+	unsigned := new(types.Transaction)
+	require.Nil(t, unsigned.UnmarshalBinary(data), "Failed to decode transaction")
+	signed, err := types.SignTx(unsigned, types.LatestSignerForChainID(offlineTestChainID), key)
+	require.Nil(t, err, "Failed to sign transaction")
+	raw, err := signed.MarshalBinary()
+	require.Nil(t, err, "Failed to encode signed transaction")
+	imported, err := offline.Import(raw)
+	require.Nil(t, err, "Failed to import transaction")
+	assert.Equal(t, signed.Hash(), imported.Hash())
+}
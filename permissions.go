@@ -0,0 +1,252 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Fuses that can be burned on a wrapped name to restrict what its owner can
+// do with it.
+const (
+	FuseCannotUnwrap          uint32 = 1
+	FuseCannotBurnFuses       uint32 = 2
+	FuseCannotTransfer        uint32 = 4
+	FuseCannotSetResolver     uint32 = 8
+	FuseCannotSetTTL          uint32 = 16
+	FuseCannotCreateSubdomain uint32 = 32
+	FuseParentCannotControl   uint32 = 1 << 16
+)
+
+// Action is a management operation on a name.
+type Action int
+
+const (
+	// ActionSetResolver sets the resolver of the name.
+	ActionSetResolver Action = iota
+	// ActionSetRecords sets records of the name in its resolver.
+	ActionSetRecords
+	// ActionTransfer transfers the registration of the name.
+	ActionTransfer
+	// ActionCreateSubdomain creates subdomains of the name.
+	ActionCreateSubdomain
+	// ActionRenew extends the registration of the name.
+	ActionRenew
+	// ActionReclaim sets the controller of the name from its registration.
+	ActionReclaim
+)
+
+// Actions are all management operations, in the order they are reported.
+var Actions = []Action{
+	ActionSetResolver,
+	ActionSetRecords,
+	ActionTransfer,
+	ActionCreateSubdomain,
+	ActionRenew,
+	ActionReclaim,
+}
+
+// String returns a human-readable form of the action.
+func (a Action) String() string {
+	switch a {
+	case ActionSetResolver:
+		return "set resolver"
+	case ActionSetRecords:
+		return "set records"
+	case ActionTransfer:
+		return "transfer"
+	case ActionCreateSubdomain:
+		return "create subdomain"
+	case ActionRenew:
+		return "renew"
+	case ActionReclaim:
+		return "reclaim"
+	default:
+		return "unknown"
+	}
+}
+
+// Permission states whether an action is allowed, and why.
+type Permission struct {
+	Allowed bool
+	Reason  string
+}
+
+// Permissions are the management operations that an address can carry out on
+// a name, along with the state from which they were derived.
+type Permissions struct {
+	Address    common.Address
+	Registrant common.Address
+	Controller common.Address
+	// Wrapped is true if the name is held by the name wrapper, in which case
+	// Owner and Fuses are those of the wrapped name
+	Wrapped bool
+	Owner   common.Address
+	Fuses   uint32
+	// Resolver is the resolver of the name, or UnknownAddress if not set
+	Resolver common.Address
+	Actions  map[Action]*Permission
+}
+
+// Can returns true if the action is allowed.
+func (p *Permissions) Can(action Action) bool {
+	permission, exists := p.Actions[action]
+	return exists && permission.Allowed
+}
+
+// Permissions evaluates which management operations an address can carry out
+// on the name.  It takes into account ownership of the registration in the
+// registrar, ownership of the name in the registry, the name wrapper and its
+// fuses, and operator approvals in each of these and in the resolver.
+func (n *Name) Permissions(address common.Address) (*Permissions, error) {
+	return n.PermissionsCtx(context.Background(), address)
+}
+
+// PermissionsCtx is as per Permissions, with a context.
+func (n *Name) PermissionsCtx(ctx context.Context, address common.Address) (*Permissions, error) {
+	p := &Permissions{
+		Address: address,
+		Actions: make(map[Action]*Permission),
+	}
+	var err error
+	if p.Registrant, err = n.RegistrantCtx(ctx); err != nil {
+		return nil, err
+	}
+	if p.Controller, err = n.ControllerCtx(ctx); err != nil {
+		return nil, err
+	}
+	if p.Resolver, err = n.ResolverAddressCtx(ctx); err != nil {
+		return nil, err
+	}
+	wrapper, err := nameWrapperOf(ctx, n.backend, n.registry, n.Name)
+	if err != nil {
+		return nil, err
+	}
+	p.Wrapped = wrapper != nil
+
+	// manager is true if the address can manage the name in the registry,
+	// either directly or through the name wrapper
+	var manager bool
+	var managerReason string
+	if p.Wrapped {
+		nameHash, err := NameHash(n.Name)
+		if err != nil {
+			return nil, err
+		}
+		data, err := wrapper.Contract.GetData(&bind.CallOpts{Context: ctx}, new(big.Int).SetBytes(nameHash[:]))
+		if err != nil {
+			return nil, err
+		}
+		p.Owner = data.Owner
+		p.Fuses = data.Fuses
+		if manager, err = wrapper.Contract.CanModifyName(&bind.CallOpts{Context: ctx}, nameHash, address); err != nil {
+			return nil, err
+		}
+		managerReason = describeRole(manager, address == p.Owner, "owner of the wrapped name", "approved by the owner of the wrapped name")
+	} else {
+		p.Owner = p.Controller
+		switch {
+		case p.Controller == UnknownAddress:
+			managerReason = "name has no controller"
+		case address == p.Controller:
+			manager = true
+			managerReason = "controller of the name"
+		default:
+			if manager, err = n.registry.IsApprovedCtx(ctx, p.Controller, address); err != nil {
+				return nil, err
+			}
+			managerReason = describeRole(manager, false, "controller of the name", "approved by the controller in the registry")
+		}
+	}
+
+	// registrant is true if the address can transfer the registration
+	var registrant bool
+	var registrantReason string
+	switch {
+	case p.Registrant == UnknownAddress:
+		registrantReason = "name is not registered"
+	case address == p.Registrant:
+		registrant = true
+		registrantReason = "registrant of the name"
+	default:
+		if registrant, err = n.registrar.IsApprovedCtx(ctx, n.Name, address); err != nil {
+			return nil, err
+		}
+		registrantReason = describeRole(registrant, false, "registrant of the name", "approved by the registrant in the registrar")
+	}
+
+	p.Actions[ActionSetResolver] = fusedPermission(manager, managerReason, p.Fuses, FuseCannotSetResolver, "resolver fuse is burned")
+	p.Actions[ActionCreateSubdomain] = fusedPermission(manager, managerReason, p.Fuses, FuseCannotCreateSubdomain, "subdomain fuse is burned")
+
+	if p.Wrapped {
+		p.Actions[ActionTransfer] = fusedPermission(manager, managerReason, p.Fuses, FuseCannotTransfer, "transfer fuse is burned")
+		p.Actions[ActionReclaim] = &Permission{Reason: "registration is held by the name wrapper"}
+	} else {
+		p.Actions[ActionTransfer] = &Permission{Allowed: registrant, Reason: registrantReason}
+		p.Actions[ActionReclaim] = &Permission{Allowed: registrant, Reason: registrantReason}
+	}
+
+	if p.Registrant == UnknownAddress {
+		p.Actions[ActionRenew] = &Permission{Reason: "name is not registered"}
+	} else {
+		p.Actions[ActionRenew] = &Permission{Allowed: true, Reason: "any address can renew a registered name"}
+	}
+
+	// The resolver authorises the owner of the name and its own operators
+	switch {
+	case p.Resolver == UnknownAddress:
+		p.Actions[ActionSetRecords] = &Permission{Reason: "name has no resolver"}
+	case p.Owner == UnknownAddress:
+		p.Actions[ActionSetRecords] = &Permission{Reason: "name has no owner"}
+	case address == p.Owner:
+		p.Actions[ActionSetRecords] = &Permission{Allowed: true, Reason: "owner of the name"}
+	default:
+		resolver, err := NewResolverAtCtx(ctx, n.backend, n.Name, p.Resolver)
+		if err != nil {
+			return nil, err
+		}
+		approved, err := resolver.IsApprovedCtx(ctx, p.Owner, address)
+		if err != nil {
+			return nil, err
+		}
+		p.Actions[ActionSetRecords] = &Permission{Allowed: approved, Reason: describeRole(approved, false, "owner of the name", "approved by the owner in the resolver")}
+	}
+
+	return p, nil
+}
+
+// describeRole explains why an address does or does not hold a role.
+func describeRole(allowed bool, direct bool, role string, operator string) string {
+	switch {
+	case allowed && direct:
+		return role
+	case allowed:
+		return operator
+	default:
+		return "not the " + role + " or " + operator
+	}
+}
+
+// fusedPermission is a permission that is further restricted by a fuse.
+func fusedPermission(allowed bool, reason string, fuses uint32, fuse uint32, fusedReason string) *Permission {
+	if allowed && fuses&fuse != 0 {
+		return &Permission{Reason: fusedReason}
+	}
+	return &Permission{Allowed: allowed, Reason: reason}
+}
@@ -0,0 +1,113 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jw-1ns/go-1ns/contracts/baseregistrar"
+	"github.com/jw-1ns/go-1ns/contracts/namewrapper"
+	"github.com/jw-1ns/go-1ns/contracts/publicresolver"
+	"github.com/jw-1ns/go-1ns/contracts/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newStubPermissionsName creates a name whose registrant and controller are
+// as given, with the resolver approving carol as an operator of alice.
+func newStubPermissionsName(t *testing.T, registrant common.Address, controller common.Address) (*Name, *stubBackend) {
+	alice := tconfig.testAccounts.aliceAddress
+	bob := tconfig.testAccounts.bobAddress
+	carol := tconfig.testAccounts.carolAddress
+	name := newStubName(t, time.Now().Add(time.Hour).Unix(), false, 0)
+	backend := name.backend.(*stubBackend)
+	reg, err := NewRegistry(backend)
+	require.Nil(t, err, "Failed to create registry")
+	name.registry = reg
+	name.registrar = newStubBaseRegistrar(t, backend, registrant)
+	backend.handle(config.Registry, registry.ContractMetaData, "owner", returns(controller))
+	backend.handle(config.Registry, registry.ContractMetaData, "resolver", returns(stubResolver))
+	backend.handle(config.Registry, registry.ContractMetaData, "isApprovedForAll", func(args []interface{}) ([]interface{}, error) {
+		return []interface{}{args[0] == alice && args[1] == bob}, nil
+	})
+	backend.handle(registrarTestAddress, baseregistrar.ContractMetaData, "isApprovedForAll", returns(false))
+	backend.handle(registrarTestAddress, baseregistrar.ContractMetaData, "getApproved", returns(UnknownAddress))
+	backend.handle(stubResolver, publicresolver.ContractMetaData, "addr", returns(UnknownAddress))
+	backend.handle(stubResolver, publicresolver.ContractMetaData, "isApprovedForAll", func(args []interface{}) ([]interface{}, error) {
+		return []interface{}{args[0] == alice && args[1] == carol}, nil
+	})
+	return name, backend
+}
+
+func allowedActions(permissions *Permissions) []Action {
+	allowed := make([]Action, 0)
+	for _, action := range Actions {
+		if permissions.Can(action) {
+			allowed = append(allowed, action)
+		}
+	}
+	return allowed
+}
+
+func TestPermissionsUnwrapped(t *testing.T) {
+	alice := tconfig.testAccounts.aliceAddress
+	bob := tconfig.testAccounts.bobAddress
+	carol := tconfig.testAccounts.carolAddress
+	name, _ := newStubPermissionsName(t, alice, alice)
+
+	permissions, err := name.Permissions(alice)
+	require.Nil(t, err, "Failed to obtain permissions")
+	assert.False(t, permissions.Wrapped)
+	assert.Equal(t, Actions, allowedActions(permissions))
+	assert.Equal(t, "controller of the name", permissions.Actions[ActionSetResolver].Reason)
+
+	permissions, err = name.Permissions(bob)
+	require.Nil(t, err, "Failed to obtain permissions")
+	assert.Equal(t, []Action{ActionSetResolver, ActionCreateSubdomain, ActionRenew}, allowedActions(permissions))
+	assert.Equal(t, "approved by the controller in the registry", permissions.Actions[ActionSetResolver].Reason)
+	assert.Equal(t, "not the owner of the name or approved by the owner in the resolver", permissions.Actions[ActionSetRecords].Reason)
+	assert.Equal(t, "not the registrant of the name or approved by the registrant in the registrar", permissions.Actions[ActionTransfer].Reason)
+
+	permissions, err = name.Permissions(carol)
+	require.Nil(t, err, "Failed to obtain permissions")
+	assert.Equal(t, []Action{ActionSetRecords, ActionRenew}, allowedActions(permissions))
+	assert.Equal(t, "approved by the owner in the resolver", permissions.Actions[ActionSetRecords].Reason)
+}
+
+func TestPermissionsWrapped(t *testing.T) {
+	alice := tconfig.testAccounts.aliceAddress
+	bob := tconfig.testAccounts.bobAddress
+	name, backend := newStubPermissionsName(t, wrapperTestAddress, wrapperTestAddress)
+	backend.handle(wrapperTestAddress, namewrapper.ContractMetaData, "isWrapped", returns(true))
+	backend.handle(wrapperTestAddress, namewrapper.ContractMetaData, "getData", returns(alice, FuseCannotUnwrap|FuseCannotTransfer, uint64(0)))
+	backend.handle(wrapperTestAddress, namewrapper.ContractMetaData, "canModifyName", func(args []interface{}) ([]interface{}, error) {
+		return []interface{}{args[1] == alice}, nil
+	})
+
+	permissions, err := name.Permissions(alice)
+	require.Nil(t, err, "Failed to obtain permissions")
+	assert.True(t, permissions.Wrapped)
+	assert.Equal(t, alice, permissions.Owner)
+	assert.Equal(t, []Action{ActionSetResolver, ActionSetRecords, ActionCreateSubdomain, ActionRenew}, allowedActions(permissions))
+	assert.Equal(t, "transfer fuse is burned", permissions.Actions[ActionTransfer].Reason)
+	assert.Equal(t, "registration is held by the name wrapper", permissions.Actions[ActionReclaim].Reason)
+
+	permissions, err = name.Permissions(bob)
+	require.Nil(t, err, "Failed to obtain permissions")
+	assert.Equal(t, []Action{ActionRenew}, allowedActions(permissions))
+	assert.Equal(t, "not the owner of the wrapped name or approved by the owner of the wrapped name", permissions.Actions[ActionSetResolver].Reason)
+}
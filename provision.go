@@ -0,0 +1,444 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+)
+
+// ProvisionStep is a single transaction required to bring the chain in to
+// line with a manifest.
+type ProvisionStep struct {
+	// ID identifies the step by its contents, allowing progress to be
+	// tracked across runs
+	ID string
+	// Name is the subdomain to which the step applies
+	Name        string
+	Description string
+	To          common.Address
+	Data        []byte
+}
+
+// ProvisionPlan is the set of transactions required to bring the chain in
+// to line with a manifest, in the order in which they must be sent.
+type ProvisionPlan struct {
+	From  common.Address
+	Steps []*ProvisionStep
+}
+
+// Provisioner creates and updates subdomains in bulk from a manifest.
+type Provisioner struct {
+	// Policy is applied to each transaction sent by Execute(), if set
+	Policy *TxPolicy
+
+	backend  bind.ContractBackend
+	manifest *Manifest
+	registry *Registry
+}
+
+// NewProvisioner creates a provisioner for a manifest.
+func NewProvisioner(backend bind.ContractBackend, manifest *Manifest) (*Provisioner, error) {
+	if err := manifest.validate(); err != nil {
+		return nil, err
+	}
+	registry, err := NewRegistry(backend)
+	if err != nil {
+		return nil, err
+	}
+	return &Provisioner{
+		backend:  backend,
+		manifest: manifest,
+		registry: registry,
+	}, nil
+}
+
+// Plan compares the manifest with the chain and returns the transactions
+// required to bring the chain in to line, to be sent by the given address.
+// Subdomains that already match the manifest have no transactions.
+func (p *Provisioner) Plan(ctx context.Context, from common.Address) (*ProvisionPlan, error) {
+	defaultResolver, err := p.registry.ResolverAddressCtx(ctx, p.manifest.Parent)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &ProvisionPlan{
+		From:  from,
+		Steps: make([]*ProvisionStep, 0),
+	}
+	for _, entry := range p.manifest.Subdomains {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		steps, err := p.planEntry(ctx, from, entry, defaultResolver)
+		if err != nil {
+			return nil, errors.Wrap(err, entry.Label)
+		}
+		plan.Steps = append(plan.Steps, steps...)
+	}
+	return plan, nil
+}
+
+// planEntry returns the steps required for a single subdomain.
+func (p *Provisioner) planEntry(ctx context.Context, from common.Address, entry *ManifestEntry, defaultResolver common.Address) ([]*ProvisionStep, error) {
+	subdomain, err := NewSubdomain(p.backend, fmt.Sprintf("%s.%s", entry.Label, p.manifest.Parent))
+	if err != nil {
+		return nil, err
+	}
+	node, err := NameHash(subdomain.Name)
+	if err != nil {
+		return nil, err
+	}
+	owner, err := subdomain.ControllerCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resolverAddress, err := subdomain.ResolverAddressCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := p.registry.Contract.Ttl(&bind.CallOpts{Context: ctx}, node)
+	if err != nil {
+		return nil, err
+	}
+
+	desiredResolver := entry.Resolver
+	if desiredResolver == UnknownAddress {
+		desiredResolver = defaultResolver
+	}
+	records, err := p.recordsStep(ctx, from, subdomain.Name, desiredResolver, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	steps := make([]*ProvisionStep, 0)
+	setRecord := func(owner common.Address) error {
+		tx, err := subdomain.SetRecord(captureOpts(ctx, from), owner, desiredResolver, entry.TTL)
+		if err != nil {
+			return err
+		}
+		steps = append(steps, newProvisionStep(subdomain.Name, fmt.Sprintf("set owner %s, resolver %s, TTL %d", owner.Hex(), desiredResolver.Hex(), entry.TTL), tx))
+		return nil
+	}
+
+	recordMatches := owner == entry.Owner && resolverAddress == desiredResolver && ttl == entry.TTL
+	if records != nil {
+		// Resolver records can only be set by the owner, with the resolver
+		// in place, so take temporary ownership if required.
+		if owner != from || resolverAddress != desiredResolver {
+			if err := setRecord(from); err != nil {
+				return nil, err
+			}
+			recordMatches = entry.Owner == from
+		}
+		steps = append(steps, records)
+	}
+	if !recordMatches {
+		if err := setRecord(entry.Owner); err != nil {
+			return nil, err
+		}
+	}
+	return steps, nil
+}
+
+// recordsStep returns the step required to set the resolver records of a
+// subdomain, or nil if the records match.
+func (p *Provisioner) recordsStep(ctx context.Context, from common.Address, name string, resolverAddress common.Address, entry *ManifestEntry) (*ProvisionStep, error) {
+	if entry.Address == UnknownAddress && len(entry.Text) == 0 {
+		return nil, nil
+	}
+	if resolverAddress == UnknownAddress {
+		return nil, withReason(ErrNoResolver, "records supplied but no resolver")
+	}
+	resolver, err := NewResolverAtCtx(ctx, p.backend, name, resolverAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	calls := make([][]byte, 0)
+	changes := make([]string, 0)
+	if entry.Address != UnknownAddress {
+		address, err := resolver.AddressCtx(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if address != entry.Address {
+			tx, err := resolver.SetAddress(captureOpts(ctx, from), entry.Address)
+			if err != nil {
+				return nil, err
+			}
+			calls = append(calls, tx.Data())
+			changes = append(changes, fmt.Sprintf("address %s", entry.Address.Hex()))
+		}
+	}
+	keys := make([]string, 0, len(entry.Text))
+	for key := range entry.Text {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, err := resolver.TextCtx(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if value != entry.Text[key] {
+			tx, err := resolver.SetText(captureOpts(ctx, from), key, entry.Text[key])
+			if err != nil {
+				return nil, err
+			}
+			calls = append(calls, tx.Data())
+			changes = append(changes, fmt.Sprintf("text %s", key))
+		}
+	}
+
+	switch len(calls) {
+	case 0:
+		return nil, nil
+	case 1:
+		return &ProvisionStep{
+			ID:          provisionStepID(resolverAddress, calls[0]),
+			Name:        name,
+			Description: fmt.Sprintf("set %s", changes[0]),
+			To:          resolverAddress,
+			Data:        calls[0],
+		}, nil
+	default:
+		tx, err := resolver.Contract.Multicall(captureOpts(ctx, from), calls)
+		if err != nil {
+			return nil, err
+		}
+		return newProvisionStep(name, fmt.Sprintf("set %s", strings.Join(changes, ", ")), tx), nil
+	}
+}
+
+// Execute sends the transactions in a plan, waiting for each to be mined
+// before sending the next.  If progress is supplied it records the
+// transactions sent, allowing an interrupted run to resume without sending
+// duplicate transactions.
+func (p *Provisioner) Execute(ctx context.Context, opts *bind.TransactOpts, plan *ProvisionPlan, progress *ProvisionProgress) error {
+	if opts.From != plan.From {
+		return fmt.Errorf("plan is for %s", plan.From.Hex())
+	}
+	receipts, isReceiptBackend := p.backend.(receiptBackend)
+	if !isReceiptBackend {
+		return errors.New("backend cannot obtain transaction receipts")
+	}
+	if progress == nil {
+		progress = NewProvisionProgress("")
+	}
+
+	for _, step := range plan.Steps {
+		state := progress.Steps[step.ID]
+		if state != nil && state.Done {
+			continue
+		}
+		if state == nil {
+			txOpts := *opts
+			txOpts.Context = ctx
+			if p.Policy != nil {
+				policyOpts, err := p.Policy.Apply(ctx, &txOpts)
+				if err != nil {
+					return err
+				}
+				txOpts = *policyOpts
+				if gas, exists := p.Policy.gasLimit(step.To, step.Data); exists {
+					txOpts.GasLimit = gas
+				}
+			}
+			tx, err := bind.NewBoundContract(step.To, abi.ABI{}, p.backend, p.backend, p.backend).RawTransact(&txOpts, step.Data)
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("%s: failed to %s", step.Name, step.Description))
+			}
+			state = &ProvisionStepState{TxHash: tx.Hash()}
+			progress.Steps[step.ID] = state
+			if err := progress.Save(); err != nil {
+				return err
+			}
+		}
+
+		receipt, err := waitForReceipt(ctx, receipts, state.TxHash)
+		if errors.Is(err, errTxDropped) {
+			// Allow the step to be resent
+			delete(progress.Steps, step.ID)
+			if saveErr := progress.Save(); saveErr != nil {
+				return saveErr
+			}
+			return errors.Wrap(err, fmt.Sprintf("%s: failed to %s", step.Name, step.Description))
+		}
+		if err != nil {
+			return err
+		}
+		if receipt.Status != types.ReceiptStatusSuccessful {
+			// Allow the step to be retried
+			delete(progress.Steps, step.ID)
+			if err := progress.Save(); err != nil {
+				return err
+			}
+			return fmt.Errorf("%s: transaction %s to %s failed", step.Name, state.TxHash.Hex(), step.Description)
+		}
+		state.Done = true
+		if err := progress.Save(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ProvisionProgress tracks the transactions sent when executing a plan.
+type ProvisionProgress struct {
+	path  string
+	Steps map[string]*ProvisionStepState `json:"steps"`
+}
+
+// ProvisionStepState is the state of a step that has been sent.
+type ProvisionStepState struct {
+	TxHash common.Hash `json:"tx"`
+	Done   bool        `json:"done"`
+}
+
+// NewProvisionProgress creates progress tracking that is saved to the given
+// path.  An empty path does not save progress.
+func NewProvisionProgress(path string) *ProvisionProgress {
+	return &ProvisionProgress{
+		path:  path,
+		Steps: make(map[string]*ProvisionStepState),
+	}
+}
+
+// LoadProvisionProgress loads progress tracking from a path, starting
+// afresh if there is nothing at the path.
+func LoadProvisionProgress(path string) (*ProvisionProgress, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return NewProvisionProgress(path), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	progress := NewProvisionProgress(path)
+	if err := json.Unmarshal(data, progress); err != nil {
+		return nil, err
+	}
+	return progress, nil
+}
+
+// Save saves the progress.
+func (p *ProvisionProgress) Save() error {
+	if p.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write then rename so that an interruption does not lose progress
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.path)
+}
+
+// receiptPollInterval is the interval at which receipts are polled.
+var receiptPollInterval = time.Second
+
+// receiptBackend is a backend that can obtain transaction receipts.
+type receiptBackend interface {
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+}
+
+// txByHashReader is a backend that can obtain transactions by their hash.
+type txByHashReader interface {
+	TransactionByHash(ctx context.Context, txHash common.Hash) (*types.Transaction, bool, error)
+}
+
+// errTxDropped is returned when waiting for a transaction that the node no
+// longer knows about, so will never be mined.
+var errTxDropped = errors.New("transaction is no longer known to the node")
+
+// waitForReceipt waits for a transaction to be mined.  If the backend can
+// obtain transactions by their hash, waiting fails with errTxDropped once
+// the transaction is neither mined nor pending.
+func waitForReceipt(ctx context.Context, backend receiptBackend, txHash common.Hash) (*types.Receipt, error) {
+	ticker := time.NewTicker(receiptPollInterval)
+	defer ticker.Stop()
+	for {
+		receipt, err := backend.TransactionReceipt(ctx, txHash)
+		if err == nil && receipt != nil {
+			return receipt, nil
+		}
+		if reader, isReader := backend.(txByHashReader); isReader {
+			_, _, err := reader.TransactionByHash(ctx, txHash)
+			if errors.Is(err, ethereum.NotFound) {
+				// The transaction may have been mined since its receipt
+				// was requested
+				if receipt, err := backend.TransactionReceipt(ctx, txHash); err == nil && receipt != nil {
+					return receipt, nil
+				}
+				return nil, errors.Wrap(errTxDropped, txHash.Hex())
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// captureOpts creates transaction options that build a transaction without
+// signing or sending it, or contacting the backend, allowing the
+// transaction's destination and data to be captured.
+func captureOpts(ctx context.Context, from common.Address) *bind.TransactOpts {
+	return &bind.TransactOpts{
+		From:     from,
+		Nonce:    big.NewInt(0),
+		GasPrice: big.NewInt(0),
+		GasLimit: 1,
+		Signer: func(_ common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			return tx, nil
+		},
+		Context: ctx,
+		NoSend:  true,
+	}
+}
+
+func newProvisionStep(name string, description string, tx *types.Transaction) *ProvisionStep {
+	return &ProvisionStep{
+		ID:          provisionStepID(*tx.To(), tx.Data()),
+		Name:        name,
+		Description: description,
+		To:          *tx.To(),
+		Data:        tx.Data(),
+	}
+}
+
+func provisionStepID(to common.Address, data []byte) string {
+	return crypto.Keccak256Hash(to[:], data).Hex()
+}
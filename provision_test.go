@@ -0,0 +1,132 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"math/big"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jw-1ns/go-1ns/contracts/publicresolver"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifestCSV(t *testing.T) {
+	csv := "label,owner,ttl,text.url\n" +
+		"# Comments are ignored\n" +
+		"Alice,0x0000000000000000000000000000000000000001,300,https://alice.example\n" +
+		"bob,0x0000000000000000000000000000000000000002,,\n"
+	manifest, err := ReadManifestCSV(strings.NewReader(csv), "Team.country")
+	require.Nil(t, err, "Failed to read manifest")
+	assert.Equal(t, "team.country", manifest.Parent)
+	require.Len(t, manifest.Subdomains, 2)
+	assert.Equal(t, "alice", manifest.Subdomains[0].Label)
+	assert.Equal(t, uint64(300), manifest.Subdomains[0].TTL)
+	assert.Equal(t, map[string]string{"url": "https://alice.example"}, manifest.Subdomains[0].Text)
+	assert.Len(t, manifest.Subdomains[1].Text, 0)
+
+	_, err = ReadManifestCSV(strings.NewReader("label\nalice\n"), "team.country")
+	assert.EqualError(t, err, "manifest missing owner column")
+	_, err = ReadManifestCSV(strings.NewReader("label,owner\na,0x01\n"), "team.country")
+	assert.EqualError(t, err, "line 2: invalid owner: 0x01 is not an address")
+	_, err = ReadManifestJSON(strings.NewReader(`{"parent":"team.country","subdomains":[{"label":"a","owner":"0x0000000000000000000000000000000000000001"},{"label":"A","owner":"0x0000000000000000000000000000000000000001"}]}`))
+	assert.EqualError(t, err, "duplicate label a")
+}
+
+func TestProvision(t *testing.T) {
+	alice := tconfig.testAccounts.aliceAddress
+	bob := tconfig.testAccounts.bobAddress
+	carol := tconfig.testAccounts.carolAddress
+	backend := newStubRegistry(t, map[string]*stubRegistryRecord{
+		"team.country":       {owner: alice, resolver: stubResolver},
+		"same.team.country":  {owner: bob, resolver: stubResolver},
+		"own.team.country":   {owner: alice, resolver: stubResolver, text: map[string]string{"url": "old"}},
+		"moved.team.country": {owner: bob, resolver: stubResolver},
+	})
+
+	manifest, err := ReadManifestJSON(strings.NewReader(`{
+  "parent": "team.country",
+  "subdomains": [
+    {"label": "new", "owner": "` + bob.Hex() + `", "address": "` + bob.Hex() + `", "text": {"url": "https://new.example"}},
+    {"label": "same", "owner": "` + bob.Hex() + `"},
+    {"label": "own", "owner": "` + alice.Hex() + `", "text": {"url": "new"}},
+    {"label": "moved", "owner": "` + carol.Hex() + `"}
+  ]
+}`))
+	require.Nil(t, err, "Failed to read manifest")
+	provisioner, err := NewProvisioner(backend, manifest)
+	require.Nil(t, err, "Failed to create provisioner")
+
+	plan, err := provisioner.Plan(context.Background(), alice)
+	require.Nil(t, err, "Failed to create plan")
+	methods := make([]string, len(plan.Steps))
+	for i, step := range plan.Steps {
+		methods[i] = step.Name + ":" + step.Description
+	}
+	assert.Equal(t, []string{
+		"new.team.country:set owner " + alice.Hex() + ", resolver " + stubResolver.Hex() + ", TTL 0",
+		"new.team.country:set address " + bob.Hex() + ", text url",
+		"new.team.country:set owner " + bob.Hex() + ", resolver " + stubResolver.Hex() + ", TTL 0",
+		"own.team.country:set text url",
+		"moved.team.country:set owner " + carol.Hex() + ", resolver " + stubResolver.Hex() + ", TTL 0",
+	}, methods)
+
+	// Records for new are set in a single multicall to the resolver
+	assert.Equal(t, stubResolver, plan.Steps[1].To)
+	parsed, err := publicresolver.ContractMetaData.GetAbi()
+	require.Nil(t, err, "Failed to parse ABI")
+	method, err := parsed.MethodById(plan.Steps[1].Data[:4])
+	require.Nil(t, err, "Failed to find method")
+	assert.Equal(t, "multicall", method.Name)
+
+	// Execution is tracked and can resume
+	path := filepath.Join(t.TempDir(), "progress.json")
+	progress, err := LoadProvisionProgress(path)
+	require.Nil(t, err, "Failed to create progress")
+	opts := stubTxOpts(alice)
+	opts.NoSend = false
+	opts.GasLimit = 0
+	provisioner.Policy = &TxPolicy{
+		Fees:      &txPolicyTestFees{},
+		GasLimits: map[string]uint64{"multicall": 300000},
+	}
+	require.Nil(t, provisioner.Execute(context.Background(), opts, plan, progress), "Failed to execute plan")
+	require.Len(t, backend.sent, 5)
+	// The policy gives each transaction its own fees
+	assert.Equal(t, big.NewInt(1), backend.sent[0].GasPrice())
+	assert.Equal(t, big.NewInt(5), backend.sent[4].GasPrice())
+	assert.Equal(t, uint64(100000), backend.sent[0].Gas())
+	assert.Equal(t, uint64(300000), backend.sent[1].Gas())
+
+	progress, err = LoadProvisionProgress(path)
+	require.Nil(t, err, "Failed to load progress")
+	assert.Len(t, progress.Steps, 5)
+	require.Nil(t, provisioner.Execute(context.Background(), opts, plan, progress), "Failed to resume plan")
+	assert.Len(t, backend.sent, 5, "Completed steps should not be resent")
+
+	err = provisioner.Execute(context.Background(), stubTxOpts(bob), plan, nil)
+	assert.EqualError(t, err, "plan is for "+alice.Hex())
+
+	// A dropped transaction fails the run and is resent by the next
+	progress = NewProvisionProgress("")
+	progress.Steps[plan.Steps[0].ID] = &ProvisionStepState{TxHash: common.HexToHash("0x01")}
+	err = provisioner.Execute(context.Background(), opts, plan, progress)
+	assert.ErrorIs(t, err, errTxDropped)
+	assert.NotContains(t, progress.Steps, plan.Steps[0].ID)
+}
@@ -18,11 +18,13 @@ package onens
 import (
 	"bytes"
 	"compress/zlib"
+	"context"
 	"errors"
 	"io"
 	"io/ioutil"
 	"math/big"
 	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
@@ -44,30 +46,40 @@ type Resolver struct {
 
 // NewResolver obtains an Public resolver for a given domain
 func NewResolver(backend bind.ContractBackend, domain string) (*Resolver, error) {
+	return NewResolverCtx(context.Background(), backend, domain)
+}
+
+// NewResolverCtx is as per NewResolver, with a context.
+func NewResolverCtx(ctx context.Context, backend bind.ContractBackend, domain string) (*Resolver, error) {
 	registry, err := NewRegistry(backend)
 	if err != nil {
 		return nil, err
 	}
 
 	// Ensure the name is registered
-	ownerAddress, err := registry.Owner(domain)
+	ownerAddress, err := registry.OwnerCtx(ctx, domain)
 	if err != nil {
 		return nil, err
 	}
 	if bytes.Equal(ownerAddress.Bytes(), UnknownAddress.Bytes()) {
-		return nil, errors.New("unregistered name")
+		return nil, withReason(ErrNotRegistered, "unregistered name")
 	}
 
 	// Obtain the resolver address for this domain
-	resolver, err := registry.ResolverAddress(domain)
+	resolver, err := registry.ResolverAddressCtx(ctx, domain)
 	if err != nil {
 		return nil, err
 	}
-	return NewResolverAt(backend, domain, resolver)
+	return NewResolverAtCtx(ctx, backend, domain, resolver)
 }
 
 // NewResolverAt obtains an ENS resolver at a given address
 func NewResolverAt(backend bind.ContractBackend, domain string, address common.Address) (*Resolver, error) {
+	return NewResolverAtCtx(context.Background(), backend, domain, address)
+}
+
+// NewResolverAtCtx is as per NewResolverAt, with a context.
+func NewResolverAtCtx(ctx context.Context, backend bind.ContractBackend, domain string, address common.Address) (*Resolver, error) {
 	contract, err := publicresolver.NewContract(address, backend)
 	if err != nil {
 		return nil, err
@@ -78,10 +90,10 @@ func NewResolverAt(backend bind.ContractBackend, domain string, address common.A
 	if err != nil {
 		return nil, err
 	}
-	_, err = contract.Addr(nil, nameHash)
+	_, err = contract.Addr(&bind.CallOpts{Context: ctx}, nameHash)
 	if err != nil {
 		if err.Error() == "no contract code at given address" {
-			return nil, errors.New("no resolver H")
+			return nil, ErrNoResolver
 		}
 		return nil, err
 	}
@@ -95,35 +107,67 @@ func NewResolverAt(backend bind.ContractBackend, domain string, address common.A
 
 // PublicResolverAddress obtains the address of the public resolver for a chain
 func PublicResolverAddress(backend bind.ContractBackend) (common.Address, error) {
-	return Resolve(backend, "resolver.country")
+	return PublicResolverAddressCtx(context.Background(), backend)
+}
+
+// PublicResolverAddressCtx is as per PublicResolverAddress, with a context.
+func PublicResolverAddressCtx(ctx context.Context, backend bind.ContractBackend) (common.Address, error) {
+	return ResolveCtx(ctx, backend, "resolver.country")
 }
 
 // Address returns the Ethereum address of the domain
 func (r *Resolver) Address() (common.Address, error) {
+	return r.AddressCtx(context.Background())
+}
+
+// AddressCtx is as per Address, with a context.
+func (r *Resolver) AddressCtx(ctx context.Context) (common.Address, error) {
 	nameHash, err := NameHash(r.domain)
 	if err != nil {
 		return UnknownAddress, err
 	}
-	return r.Contract.Addr(nil, nameHash)
+	return r.Contract.Addr(&bind.CallOpts{Context: ctx}, nameHash)
 }
 
 // SetAddress sets the Ethereum address of the domain
-// func (r *Resolver) SetAddress(opts *bind.TransactOpts, address common.Address) (*types.Transaction, error) {
-// 	nameHash, err := NameHash(r.domain)
-// 	if err != nil {
-// 		return nil, err
-// 	}
-// 	return r.Contract.SetAddr(opts, nameHash, address)
-// }
+func (r *Resolver) SetAddress(opts *bind.TransactOpts, address common.Address) (*types.Transaction, error) {
+	nameHash, err := NameHash(r.domain)
+	if err != nil {
+		return nil, err
+	}
+	return r.Contract.SetAddr0(opts, nameHash, address)
+}
+
+// Approve sets or clears approval for an operator to set records of all
+// names controlled by the sender.
+func (r *Resolver) Approve(opts *bind.TransactOpts, operator common.Address, approved bool) (*types.Transaction, error) {
+	return r.Contract.SetApprovalForAll(opts, operator, approved)
+}
+
+// IsApproved returns true if the operator is approved to set records of all
+// names controlled by the owner.
+func (r *Resolver) IsApproved(owner common.Address, operator common.Address) (bool, error) {
+	return r.IsApprovedCtx(context.Background(), owner, operator)
+}
+
+// IsApprovedCtx is as per IsApproved, with a context.
+func (r *Resolver) IsApprovedCtx(ctx context.Context, owner common.Address, operator common.Address) (bool, error) {
+	return r.Contract.IsApprovedForAll(&bind.CallOpts{Context: ctx}, owner, operator)
+}
 
 // MultiAddress returns the address of the domain for a given coin type.
 // The coin type is as per https://github.com/satoshilabs/slips/blob/master/slip-0044.md
 func (r *Resolver) MultiAddress(coinType uint64) ([]byte, error) {
+	return r.MultiAddressCtx(context.Background(), coinType)
+}
+
+// MultiAddressCtx is as per MultiAddress, with a context.
+func (r *Resolver) MultiAddressCtx(ctx context.Context, coinType uint64) ([]byte, error) {
 	nameHash, err := NameHash(r.domain)
 	if err != nil {
 		return nil, err
 	}
-	return r.Contract.Addr0(nil, nameHash, big.NewInt(int64(coinType)))
+	return r.Contract.Addr0(&bind.CallOpts{Context: ctx}, nameHash, big.NewInt(int64(coinType)))
 }
 
 // SetMultiAddress sets the iaddress of the domain for a given coin type.
@@ -138,11 +182,16 @@ func (r *Resolver) MultiAddress(coinType uint64) ([]byte, error) {
 
 // PubKey returns the public key of the domain
 func (r *Resolver) PubKey() ([32]byte, [32]byte, error) {
+	return r.PubKeyCtx(context.Background())
+}
+
+// PubKeyCtx is as per PubKey, with a context.
+func (r *Resolver) PubKeyCtx(ctx context.Context) ([32]byte, [32]byte, error) {
 	nameHash, err := NameHash(r.domain)
 	if err != nil {
 		return [32]byte{}, [32]byte{}, err
 	}
-	res, err := r.Contract.Pubkey(nil, nameHash)
+	res, err := r.Contract.Pubkey(&bind.CallOpts{Context: ctx}, nameHash)
 	return res.X, res.Y, err
 }
 
@@ -157,11 +206,16 @@ func (r *Resolver) SetPubKey(opts *bind.TransactOpts, x [32]byte, y [32]byte) (*
 
 // Contenthash returns the content hash of the domain
 func (r *Resolver) Contenthash() ([]byte, error) {
+	return r.ContenthashCtx(context.Background())
+}
+
+// ContenthashCtx is as per Contenthash, with a context.
+func (r *Resolver) ContenthashCtx(ctx context.Context) ([]byte, error) {
 	nameHash, err := NameHash(r.domain)
 	if err != nil {
 		return nil, err
 	}
-	return r.Contract.Contenthash(nil, nameHash)
+	return r.Contract.Contenthash(&bind.CallOpts{Context: ctx}, nameHash)
 }
 
 // SetContenthash sets the content hash of the domain
@@ -175,18 +229,28 @@ func (r *Resolver) SetContenthash(opts *bind.TransactOpts, contenthash []byte) (
 
 // InterfaceImplementer returns the address of the contract that implements the given interface for the given domain
 func (r *Resolver) InterfaceImplementer(interfaceID [4]byte) (common.Address, error) {
+	return r.InterfaceImplementerCtx(context.Background(), interfaceID)
+}
+
+// InterfaceImplementerCtx is as per InterfaceImplementer, with a context.
+func (r *Resolver) InterfaceImplementerCtx(ctx context.Context, interfaceID [4]byte) (common.Address, error) {
 	nameHash, err := NameHash(r.domain)
 	if err != nil {
 		return UnknownAddress, err
 	}
-	return r.Contract.InterfaceImplementer(nil, nameHash, interfaceID)
+	return r.Contract.InterfaceImplementer(&bind.CallOpts{Context: ctx}, nameHash, interfaceID)
 }
 
 // Resolve resolves an ENS name in to an Etheruem address
 // This will return an error if the name is not found or otherwise 0
 func Resolve(backend bind.ContractBackend, input string) (address common.Address, err error) {
+	return ResolveCtx(context.Background(), backend, input)
+}
+
+// ResolveCtx is as per Resolve, with a context.
+func ResolveCtx(ctx context.Context, backend bind.ContractBackend, input string) (address common.Address, err error) {
 	if strings.Contains(input, ".") {
-		return resolveName(backend, input)
+		return resolveName(ctx, backend, input)
 	}
 	if (strings.HasPrefix(input, "0x") && len(input) > 42) || (!strings.HasPrefix(input, "0x") && len(input) > 40) {
 		err = errors.New("address too long")
@@ -200,7 +264,31 @@ func Resolve(backend bind.ContractBackend, input string) (address common.Address
 	return
 }
 
-func resolveName(backend bind.ContractBackend, input string) (address common.Address, err error) {
+// ResolveWithTTL resolves an address as per Resolve, additionally returning
+// the registry TTL of the name; this is the longest time for which the
+// address may be cached.  Inputs that are addresses have a TTL of 0.
+func ResolveWithTTL(backend bind.ContractBackend, input string) (common.Address, time.Duration, error) {
+	return ResolveWithTTLCtx(context.Background(), backend, input)
+}
+
+// ResolveWithTTLCtx is as per ResolveWithTTL, with a context.
+func ResolveWithTTLCtx(ctx context.Context, backend bind.ContractBackend, input string) (common.Address, time.Duration, error) {
+	address, err := ResolveCtx(ctx, backend, input)
+	if err != nil || !strings.Contains(input, ".") {
+		return address, 0, err
+	}
+	registry, err := NewRegistry(backend)
+	if err != nil {
+		return UnknownAddress, 0, err
+	}
+	ttl, err := registry.TTLCtx(ctx, input)
+	if err != nil {
+		return UnknownAddress, 0, err
+	}
+	return address, ttl, nil
+}
+
+func resolveName(ctx context.Context, backend bind.ContractBackend, input string) (address common.Address, err error) {
 	nameHash, err := NameHash(input)
 	if err != nil {
 		return UnknownAddress, err
@@ -208,19 +296,19 @@ func resolveName(backend bind.ContractBackend, input string) (address common.Add
 	if bytes.Equal(nameHash[:], zeroHash) {
 		err = errors.New("bad name")
 	} else {
-		address, err = resolveHash(backend, input)
+		address, err = resolveHash(ctx, backend, input)
 	}
 	return
 }
 
-func resolveHash(backend bind.ContractBackend, domain string) (address common.Address, err error) {
-	resolver, err := NewResolver(backend, domain)
+func resolveHash(ctx context.Context, backend bind.ContractBackend, domain string) (address common.Address, err error) {
+	resolver, err := NewResolverCtx(ctx, backend, domain)
 	if err != nil {
 		return UnknownAddress, err
 	}
 
 	// Resolve the domain
-	address, err = resolver.Address()
+	address, err = resolver.AddressCtx(ctx)
 	if err != nil {
 		return UnknownAddress, err
 	}
@@ -242,11 +330,16 @@ func (r *Resolver) SetText(opts *bind.TransactOpts, name string, value string) (
 
 // Text obtains the text associated with a name
 func (r *Resolver) Text(name string) (string, error) {
+	return r.TextCtx(context.Background(), name)
+}
+
+// TextCtx is as per Text, with a context.
+func (r *Resolver) TextCtx(ctx context.Context, name string) (string, error) {
 	nameHash, err := NameHash(r.domain)
 	if err != nil {
 		return "", err
 	}
-	return r.Contract.Text(nil, nameHash, name)
+	return r.Contract.Text(&bind.CallOpts{Context: ctx}, nameHash, name)
 }
 
 // SetABI sets the ABI associated with a name
@@ -278,12 +371,17 @@ func (r *Resolver) SetABI(opts *bind.TransactOpts, name string, abi string, cont
 
 // ABI returns the ABI associated with a name
 func (r *Resolver) ABI(name string) (string, error) {
+	return r.ABICtx(context.Background(), name)
+}
+
+// ABICtx is as per ABI, with a context.
+func (r *Resolver) ABICtx(ctx context.Context, name string) (string, error) {
 	contentTypes := big.NewInt(3)
 	nameHash, err := NameHash(name)
 	if err != nil {
 		return "", err
 	}
-	contentType, data, err := r.Contract.ABI(nil, nameHash, contentTypes)
+	contentType, data, err := r.Contract.ABI(&bind.CallOpts{Context: ctx}, nameHash, contentTypes)
 	var abi string
 	if err == nil {
 		if contentType.Cmp(big.NewInt(1)) == 0 {
@@ -0,0 +1,386 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jw-1ns/go-1ns/contracts/baseregistrar"
+	"github.com/jw-1ns/go-1ns/contracts/namewrapper"
+	"github.com/jw-1ns/go-1ns/contracts/publicresolver"
+	"github.com/jw-1ns/go-1ns/contracts/registrarcontroller"
+	"github.com/jw-1ns/go-1ns/contracts/registry"
+)
+
+// ReceiptBackend is a backend that can wait for transactions to be mined,
+// such as ethclient.Client.
+type ReceiptBackend interface {
+	bind.ContractBackend
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+}
+
+// RegistrationReceipt is the outcome of registering a name.
+type RegistrationReceipt struct {
+	Receipt *types.Receipt
+	// Label is the label that was registered
+	Label   string
+	TokenID *big.Int
+	Owner   common.Address
+	// BaseCost and Premium are only available for registrations through
+	// the controller
+	BaseCost *big.Int
+	Premium  *big.Int
+	Expires  time.Time
+}
+
+// RenewalReceipt is the outcome of renewing a name.
+type RenewalReceipt struct {
+	Receipt *types.Receipt
+	// Label is the label that was renewed
+	Label   string
+	TokenID *big.Int
+	// Cost is only available for renewals through the controller
+	Cost    *big.Int
+	Expires time.Time
+}
+
+// TransferReceipt is the outcome of transferring a name.  Kind is
+// "RegistrantTransfer" for the registration, "Transfer" for control of the
+// name in the registry and "WrappedTransfer" for a wrapped name; ID is the
+// label hash for the registration and the node otherwise.
+type TransferReceipt struct {
+	Receipt *types.Receipt
+	Kind    string
+	ID      common.Hash
+	From    common.Address
+	To      common.Address
+}
+
+// RecordUpdateReceipt is the outcome of updating the records of a name.
+type RecordUpdateReceipt struct {
+	Receipt *types.Receipt
+	// Updates are the record changes, in the same form as the history of the
+	// indexer
+	Updates []*NameEvent
+}
+
+// Wait waits for a transaction to be mined and have at least the given
+// number of confirmations, returning its receipt.  A transaction that fails
+// returns a *TxFailedError with the decoded reason for its failure.
+func Wait(ctx context.Context, backend ReceiptBackend, tx *types.Transaction, confirmations uint64) (*types.Receipt, error) {
+	for {
+		receipt, err := waitForReceipt(ctx, backend, tx.Hash())
+		if err != nil {
+			return nil, err
+		}
+		if confirmations > 1 {
+			if receipt, err = waitForConfirmations(ctx, backend, receipt, confirmations); err != nil {
+				return nil, err
+			}
+			if receipt == nil {
+				// Reorganised out of the chain; wait for it to be mined again
+				continue
+			}
+		}
+		if receipt.Status == types.ReceiptStatusFailed {
+			return nil, &TxFailedError{
+				Receipt: receipt,
+				Reason:  failureReason(ctx, backend, tx, receipt),
+			}
+		}
+		return receipt, nil
+	}
+}
+
+// waitForConfirmations waits for a mined transaction to have a number of
+// confirmations, returning its receipt or nil if it is no longer in the
+// chain.
+func waitForConfirmations(ctx context.Context, backend ReceiptBackend, receipt *types.Receipt, confirmations uint64) (*types.Receipt, error) {
+	ticker := time.NewTicker(receiptPollInterval)
+	defer ticker.Stop()
+	target := new(big.Int).Add(receipt.BlockNumber, new(big.Int).SetUint64(confirmations-1))
+	for {
+		head, err := backend.HeaderByNumber(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		if head.Number.Cmp(target) >= 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	current, err := backend.TransactionReceipt(ctx, receipt.TxHash)
+	if err != nil || current == nil || current.BlockHash != receipt.BlockHash {
+		return nil, nil
+	}
+	return current, nil
+}
+
+// failureReason replays a failed transaction against the state before its
+// block to obtain the reason that it failed.
+func failureReason(ctx context.Context, backend ReceiptBackend, tx *types.Transaction, receipt *types.Receipt) error {
+	var from common.Address
+	if sender, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx); err == nil {
+		from = sender
+	}
+	block := receipt.BlockNumber
+	if block != nil && block.Sign() > 0 {
+		block = new(big.Int).Sub(block, big.NewInt(1))
+	}
+	_, err := backend.CallContract(ctx, ethereum.CallMsg{
+		From:  from,
+		To:    tx.To(),
+		Gas:   tx.Gas(),
+		Value: tx.Value(),
+		Data:  tx.Data(),
+	}, block)
+	return DecodeError(err)
+}
+
+// WaitForRegistration waits for a registration transaction and returns the
+// details of the registration.  Only events emitted by the given contracts
+// are read.
+func WaitForRegistration(ctx context.Context, backend ReceiptBackend, contracts IndexerContracts, tx *types.Transaction, confirmations uint64) (*RegistrationReceipt, error) {
+	receipt, err := Wait(ctx, backend, tx, confirmations)
+	if err != nil {
+		return nil, err
+	}
+	controller, err := registrarcontroller.NewContractFilterer(common.Address{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	registrar, err := baseregistrar.NewContractFilterer(common.Address{}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var res *RegistrationReceipt
+	for _, log := range receipt.Logs {
+		if len(log.Topics) == 0 {
+			continue
+		}
+		switch log.Topics[0] {
+		case controllerEventID("NameRegistered"):
+			if log.Address != contracts.Controller {
+				continue
+			}
+			event, err := controller.ParseNameRegistered(*log)
+			if err != nil {
+				return nil, err
+			}
+			return &RegistrationReceipt{
+				Receipt:  receipt,
+				Label:    event.Name,
+				TokenID:  new(big.Int).SetBytes(event.Label[:]),
+				Owner:    event.Owner,
+				BaseCost: event.BaseCost,
+				Premium:  event.Premium,
+				Expires:  time.Unix(event.Expires.Int64(), 0),
+			}, nil
+		case registrarEventID("NameRegistered"):
+			if log.Address != contracts.BaseRegistrar {
+				continue
+			}
+			event, err := registrar.ParseNameRegistered(*log)
+			if err != nil {
+				return nil, err
+			}
+			// Keep looking for the controller's event, which has more detail
+			res = &RegistrationReceipt{
+				Receipt: receipt,
+				Label:   DefaultLabelStore.Decode(common.BigToHash(event.Id)),
+				TokenID: event.Id,
+				Owner:   event.Owner,
+				Expires: time.Unix(event.Expires.Int64(), 0),
+			}
+		}
+	}
+	if res == nil {
+		return nil, fmt.Errorf("no registration in transaction %s", receipt.TxHash.Hex())
+	}
+	return res, nil
+}
+
+// WaitForRenewal waits for a renewal transaction and returns the details of
+// the renewal.  Only events emitted by the given contracts are read.
+func WaitForRenewal(ctx context.Context, backend ReceiptBackend, contracts IndexerContracts, tx *types.Transaction, confirmations uint64) (*RenewalReceipt, error) {
+	receipt, err := Wait(ctx, backend, tx, confirmations)
+	if err != nil {
+		return nil, err
+	}
+	controller, err := registrarcontroller.NewContractFilterer(common.Address{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	registrar, err := baseregistrar.NewContractFilterer(common.Address{}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var res *RenewalReceipt
+	for _, log := range receipt.Logs {
+		if len(log.Topics) == 0 {
+			continue
+		}
+		switch log.Topics[0] {
+		case controllerEventID("NameRenewed"):
+			if log.Address != contracts.Controller {
+				continue
+			}
+			event, err := controller.ParseNameRenewed(*log)
+			if err != nil {
+				return nil, err
+			}
+			return &RenewalReceipt{
+				Receipt: receipt,
+				Label:   event.Name,
+				TokenID: new(big.Int).SetBytes(event.Label[:]),
+				Cost:    event.Cost,
+				Expires: time.Unix(event.Expires.Int64(), 0),
+			}, nil
+		case registrarEventID("NameRenewed"):
+			if log.Address != contracts.BaseRegistrar {
+				continue
+			}
+			event, err := registrar.ParseNameRenewed(*log)
+			if err != nil {
+				return nil, err
+			}
+			// Keep looking for the controller's event, which has more detail
+			res = &RenewalReceipt{
+				Receipt: receipt,
+				Label:   DefaultLabelStore.Decode(common.BigToHash(event.Id)),
+				TokenID: event.Id,
+				Expires: time.Unix(event.Expires.Int64(), 0),
+			}
+		}
+	}
+	if res == nil {
+		return nil, fmt.Errorf("no renewal in transaction %s", receipt.TxHash.Hex())
+	}
+	return res, nil
+}
+
+// WaitForTransfer waits for a transfer transaction and returns the details
+// of the first transfer that it made.  Only events emitted by the given
+// contracts are read.
+func WaitForTransfer(ctx context.Context, backend ReceiptBackend, contracts IndexerContracts, tx *types.Transaction, confirmations uint64) (*TransferReceipt, error) {
+	receipt, err := Wait(ctx, backend, tx, confirmations)
+	if err != nil {
+		return nil, err
+	}
+	registryFilterer, err := registry.NewContractFilterer(common.Address{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	registrar, err := baseregistrar.NewContractFilterer(common.Address{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	wrapper, err := namewrapper.NewContractFilterer(common.Address{}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, log := range receipt.Logs {
+		if len(log.Topics) == 0 {
+			continue
+		}
+		switch {
+		case log.Topics[0] == registrarEventID("Transfer") && len(log.Topics) == 4 && log.Address == contracts.BaseRegistrar:
+			// ERC-20 transfers share the topic but do not index the amount
+			event, err := registrar.ParseTransfer(*log)
+			if err != nil {
+				return nil, err
+			}
+			return &TransferReceipt{
+				Receipt: receipt,
+				Kind:    "RegistrantTransfer",
+				ID:      common.BigToHash(event.TokenId),
+				From:    event.From,
+				To:      event.To,
+			}, nil
+		case log.Topics[0] == registryEventID("Transfer") && log.Address == contracts.Registry:
+			event, err := registryFilterer.ParseTransfer(*log)
+			if err != nil {
+				return nil, err
+			}
+			return &TransferReceipt{
+				Receipt: receipt,
+				Kind:    "Transfer",
+				ID:      event.Node,
+				To:      event.Owner,
+			}, nil
+		case log.Topics[0] == wrapperEventID("TransferSingle") && log.Address == contracts.NameWrapper:
+			event, err := wrapper.ParseTransferSingle(*log)
+			if err != nil {
+				return nil, err
+			}
+			return &TransferReceipt{
+				Receipt: receipt,
+				Kind:    "WrappedTransfer",
+				ID:      common.BigToHash(event.Id),
+				From:    event.From,
+				To:      event.To,
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("no transfer in transaction %s", receipt.TxHash.Hex())
+}
+
+// WaitForRecordUpdate waits for a transaction that updates resolver records,
+// for example a multicall, and returns the records that it changed.
+func WaitForRecordUpdate(ctx context.Context, backend ReceiptBackend, tx *types.Transaction, confirmations uint64) (*RecordUpdateReceipt, error) {
+	receipt, err := Wait(ctx, backend, tx, confirmations)
+	if err != nil {
+		return nil, err
+	}
+	resolver, err := publicresolver.NewContractFilterer(common.Address{}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &RecordUpdateReceipt{
+		Receipt: receipt,
+		Updates: make([]*NameEvent, 0),
+	}
+	for _, log := range receipt.Logs {
+		event, err := decodeResolverLog(resolver, log)
+		if err != nil {
+			return nil, err
+		}
+		if event == nil {
+			continue
+		}
+		event.Contract = log.Address
+		event.BlockNumber = log.BlockNumber
+		event.TxHash = log.TxHash
+		event.LogIndex = log.Index
+		res.Updates = append(res.Updates, event)
+	}
+	return res, nil
+}
@@ -0,0 +1,212 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jw-1ns/go-1ns/contracts/baseregistrar"
+	"github.com/jw-1ns/go-1ns/contracts/namewrapper"
+	"github.com/jw-1ns/go-1ns/contracts/publicresolver"
+	"github.com/jw-1ns/go-1ns/contracts/registrarcontroller"
+	"github.com/jw-1ns/go-1ns/contracts/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// receiptTestSend sends a transaction to the stub backend whose receipt
+// contains the given logs.
+func receiptTestSend(t *testing.T, backend *stubBackend, to common.Address, data []byte, logs ...types.Log) *types.Transaction {
+	tx := types.NewTx(&types.LegacyTx{
+		Nonce:    uint64(len(backend.sent)),
+		GasPrice: big.NewInt(1),
+		Gas:      100000,
+		To:       &to,
+		Data:     data,
+	})
+	require.Nil(t, backend.SendTransaction(context.Background(), tx), "Failed to send transaction")
+	for i := range logs {
+		logs[i].TxHash = tx.Hash()
+		backend.receipts[tx.Hash()] = append(backend.receipts[tx.Hash()], &logs[i])
+	}
+	return tx
+}
+
+// receiptTestContracts are the contracts from which receipts are read.
+var receiptTestContracts = IndexerContracts{
+	Domain:        "country",
+	Registry:      config.Registry,
+	BaseRegistrar: registrarTestAddress,
+	Controller:    controllerTestAddress,
+	NameWrapper:   wrapperTestAddress,
+}
+
+func TestReceiptRegistration(t *testing.T) {
+	backend := newStubBackend()
+	owner := tconfig.testAccounts.aliceAddress
+	label, err := LabelHash("test")
+	require.Nil(t, err, "Failed to hash label")
+	tokenID := new(big.Int).SetBytes(label[:])
+	expires := big.NewInt(1800000000)
+	tx := receiptTestSend(t, backend, controllerTestAddress, nil,
+		indexerTestLog(t, baseregistrar.ContractMetaData, registrarTestAddress, 100, 0, "NameRegistered", tokenID, owner, expires),
+		indexerTestLog(t, registrarcontroller.ContractMetaData, controllerTestAddress, 100, 1, "NameRegistered", "test", label, owner, big.NewInt(1000), big.NewInt(5), expires),
+	)
+
+	registration, err := WaitForRegistration(context.Background(), backend, receiptTestContracts, tx, 1)
+	require.Nil(t, err, "Failed to wait for registration")
+	assert.Equal(t, tx.Hash(), registration.Receipt.TxHash)
+	assert.Equal(t, "test", registration.Label)
+	assert.Equal(t, tokenID, registration.TokenID)
+	assert.Equal(t, owner, registration.Owner)
+	assert.Equal(t, big.NewInt(1000), registration.BaseCost)
+	assert.Equal(t, big.NewInt(5), registration.Premium)
+	assert.Equal(t, int64(1800000000), registration.Expires.Unix())
+
+	// Renewals through the registrar alone have no cost
+	tx = receiptTestSend(t, backend, registrarTestAddress, nil,
+		indexerTestLog(t, baseregistrar.ContractMetaData, registrarTestAddress, 100, 0, "NameRenewed", tokenID, expires),
+	)
+	renewal, err := WaitForRenewal(context.Background(), backend, receiptTestContracts, tx, 1)
+	require.Nil(t, err, "Failed to wait for renewal")
+	assert.Equal(t, "test", renewal.Label)
+	assert.Nil(t, renewal.Cost)
+	assert.Equal(t, int64(1800000000), renewal.Expires.Unix())
+
+	_, err = WaitForRegistration(context.Background(), backend, receiptTestContracts, tx, 1)
+	assert.EqualError(t, err, "no registration in transaction "+tx.Hash().Hex())
+
+	// Events from other contracts are ignored
+	impostor := common.HexToAddress("0x99")
+	tx = receiptTestSend(t, backend, impostor, nil,
+		indexerTestLog(t, baseregistrar.ContractMetaData, impostor, 100, 0, "NameRegistered", tokenID, owner, expires),
+		indexerTestLog(t, registrarcontroller.ContractMetaData, impostor, 100, 1, "NameRegistered", "test", label, owner, big.NewInt(1000), big.NewInt(5), expires),
+		indexerTestLog(t, baseregistrar.ContractMetaData, impostor, 100, 2, "NameRenewed", tokenID, expires),
+	)
+	_, err = WaitForRegistration(context.Background(), backend, receiptTestContracts, tx, 1)
+	assert.EqualError(t, err, "no registration in transaction "+tx.Hash().Hex())
+	_, err = WaitForRenewal(context.Background(), backend, receiptTestContracts, tx, 1)
+	assert.EqualError(t, err, "no renewal in transaction "+tx.Hash().Hex())
+}
+
+func TestReceiptTransfer(t *testing.T) {
+	backend := newStubBackend()
+	alice := tconfig.testAccounts.aliceAddress
+	bob := tconfig.testAccounts.bobAddress
+	label, err := LabelHash("test")
+	require.Nil(t, err, "Failed to hash label")
+	tx := receiptTestSend(t, backend, registrarTestAddress, nil,
+		indexerTestLog(t, baseregistrar.ContractMetaData, registrarTestAddress, 100, 0, "Transfer", alice, bob, new(big.Int).SetBytes(label[:])),
+	)
+	transfer, err := WaitForTransfer(context.Background(), backend, receiptTestContracts, tx, 1)
+	require.Nil(t, err, "Failed to wait for transfer")
+	assert.Equal(t, "RegistrantTransfer", transfer.Kind)
+	assert.Equal(t, common.Hash(label), transfer.ID)
+	assert.Equal(t, alice, transfer.From)
+	assert.Equal(t, bob, transfer.To)
+
+	node, err := NameHash("test.country")
+	require.Nil(t, err, "Failed to hash name")
+	tx = receiptTestSend(t, backend, config.Registry, nil,
+		indexerTestLog(t, registry.ContractMetaData, config.Registry, 100, 0, "Transfer", node, bob),
+	)
+	transfer, err = WaitForTransfer(context.Background(), backend, receiptTestContracts, tx, 1)
+	require.Nil(t, err, "Failed to wait for transfer")
+	assert.Equal(t, "Transfer", transfer.Kind)
+	assert.Equal(t, common.Hash(node), transfer.ID)
+	assert.Equal(t, bob, transfer.To)
+
+	// Transfers by other contracts are ignored
+	impostor := common.HexToAddress("0x99")
+	tx = receiptTestSend(t, backend, impostor, nil,
+		indexerTestLog(t, registry.ContractMetaData, impostor, 100, 0, "Transfer", node, alice),
+		indexerTestLog(t, registry.ContractMetaData, config.Registry, 100, 1, "Transfer", node, bob),
+	)
+	transfer, err = WaitForTransfer(context.Background(), backend, receiptTestContracts, tx, 1)
+	require.Nil(t, err, "Failed to wait for transfer")
+	assert.Equal(t, bob, transfer.To)
+	tx = receiptTestSend(t, backend, impostor, nil,
+		indexerTestLog(t, baseregistrar.ContractMetaData, impostor, 100, 0, "Transfer", alice, bob, new(big.Int).SetBytes(label[:])),
+	)
+	_, err = WaitForTransfer(context.Background(), backend, receiptTestContracts, tx, 1)
+	assert.EqualError(t, err, "no transfer in transaction "+tx.Hash().Hex())
+
+	tx = receiptTestSend(t, backend, stubResolver, nil,
+		indexerTestLog(t, publicresolver.ContractMetaData, stubResolver, 100, 0, "TextChanged", node, "url", "url", "https://1ns.domains"),
+		indexerTestLog(t, publicresolver.ContractMetaData, stubResolver, 100, 1, "AddrChanged", node, alice),
+	)
+	update, err := WaitForRecordUpdate(context.Background(), backend, tx, 1)
+	require.Nil(t, err, "Failed to wait for record update")
+	require.Len(t, update.Updates, 2)
+	assert.Equal(t, "TextChanged", update.Updates[0].Kind)
+	assert.Equal(t, "url", update.Updates[0].Key)
+	assert.Equal(t, "https://1ns.domains", update.Updates[0].Value)
+	assert.Equal(t, stubResolver, update.Updates[0].Contract)
+	assert.Equal(t, "AddrChanged", update.Updates[1].Kind)
+	assert.Equal(t, alice.Hex(), update.Updates[1].Value)
+}
+
+func TestReceiptFailure(t *testing.T) {
+	backend := newStubBackend()
+	node, err := NameHash("test.country")
+	require.Nil(t, err, "Failed to hash name")
+	backend.handle(wrapperTestAddress, namewrapper.ContractMetaData, "setTTL", func([]interface{}) ([]interface{}, error) {
+		return nil, errorsTestRevert(t, namewrapper.ContractMetaData, "Unauthorised", node, tconfig.testAccounts.bobAddress)
+	})
+	parsed, err := namewrapper.ContractMetaData.GetAbi()
+	require.Nil(t, err, "Failed to parse ABI")
+	data, err := parsed.Pack("setTTL", node, uint64(3600))
+	require.Nil(t, err, "Failed to pack call")
+
+	tx := receiptTestSend(t, backend, wrapperTestAddress, data)
+	backend.failed[tx.Hash()] = true
+	_, err = Wait(context.Background(), backend, tx, 1)
+	var failed *TxFailedError
+	require.True(t, errors.As(err, &failed), "Expected failed transaction")
+	assert.Equal(t, tx.Hash(), failed.Receipt.TxHash)
+	var unauthorised *UnauthorisedError
+	require.True(t, errors.As(err, &unauthorised), "Expected decoded reason")
+	assert.Equal(t, tconfig.testAccounts.bobAddress, unauthorised.Address)
+	assert.True(t, errors.Is(err, ErrNotAuthorised))
+}
+
+func TestReceiptConfirmations(t *testing.T) {
+	interval := receiptPollInterval
+	receiptPollInterval = time.Millisecond
+	defer func() { receiptPollInterval = interval }()
+
+	backend := newStubBackend()
+	tx := receiptTestSend(t, backend, registrarTestAddress, nil)
+	go func() {
+		for i := 0; i < 3; i++ {
+			time.Sleep(5 * time.Millisecond)
+			backend.mu.Lock()
+			backend.head++
+			backend.mu.Unlock()
+		}
+	}()
+	receipt, err := Wait(context.Background(), backend, tx, 3)
+	require.Nil(t, err, "Failed to wait for confirmations")
+	assert.Equal(t, tx.Hash(), receipt.TxHash)
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	assert.GreaterOrEqual(t, backend.head, uint64(102))
+}
@@ -15,6 +15,7 @@
 package onens
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
@@ -23,6 +24,11 @@ import (
 
 // RegistrarContractAddress obtains the registrar contract address for a given domain
 func RegistrarContractAddress(backend bind.ContractBackend, domain string) (common.Address, error) {
+	return RegistrarContractAddressCtx(context.Background(), backend, domain)
+}
+
+// RegistrarContractAddressCtx is as per RegistrarContractAddress, with a context.
+func RegistrarContractAddressCtx(ctx context.Context, backend bind.ContractBackend, domain string) (common.Address, error) {
 	// Obtain a registry contract
 	registry, err := NewRegistry(backend)
 	if err != nil {
@@ -30,7 +36,7 @@ func RegistrarContractAddress(backend bind.ContractBackend, domain string) (comm
 	}
 
 	// Obtain the registrar address from the registry
-	address, err := registry.Owner(domain)
+	address, err := registry.OwnerCtx(ctx, domain)
 	if address == UnknownAddress {
 		err = fmt.Errorf("no registrar for %s", domain)
 	}
@@ -60,6 +60,7 @@ Following is a list of errors, events and public functions for registrarcontroll
 package onens
 
 import (
+	"context"
 	"fmt"
 	"math/big"
 	"time"
@@ -81,11 +82,16 @@ type RegistrarController struct {
 
 // NewRegistrarController creates a new controller for a given domain
 func NewRegistrarController(backend bind.ContractBackend, domain string) (*RegistrarController, error) {
+	return NewRegistrarControllerCtx(context.Background(), backend, domain)
+}
+
+// NewRegistrarControllerCtx is as per NewRegistrarController, with a context.
+func NewRegistrarControllerCtx(ctx context.Context, backend bind.ContractBackend, domain string) (*RegistrarController, error) {
 	registry, err := NewRegistry(backend)
 	if err != nil {
 		return nil, err
 	}
-	resolver, err := registry.Resolver(domain)
+	resolver, err := registry.ResolverCtx(ctx, domain)
 	if err != nil {
 		return nil, err
 	}
@@ -94,7 +100,7 @@ func NewRegistrarController(backend bind.ContractBackend, domain string) (*Regis
 	// permanentRegistrar: '0x018fac06'
 	// controllerAddress, err := resolver.InterfaceImplementer([4]byte{0x01, 0x8f, 0xac, 0x06})
 	// RegistrarController 0xdf7ed181
-	controllerAddress, err := resolver.InterfaceImplementer([4]byte{0xdf, 0x7e, 0xd1, 0x81})
+	controllerAddress, err := resolver.InterfaceImplementerCtx(ctx, [4]byte{0xdf, 0x7e, 0xd1, 0x81})
 	if err != nil {
 		return nil, err
 	}
@@ -120,7 +126,12 @@ func NewRegistrarControllerAt(backend bind.ContractBackend, domain string, addre
 //
 // MinRegistrationDuration returns the minimum duration for which a name can be registered
 func (c *RegistrarController) MinRegistrationDuration() (time.Duration, error) {
-	tmp, err := c.Contract.MINREGISTRATIONDURATION(nil)
+	return c.MinRegistrationDurationCtx(context.Background())
+}
+
+// MinRegistrationDurationCtx is as per MinRegistrationDuration, with a context.
+func (c *RegistrarController) MinRegistrationDurationCtx(ctx context.Context) (time.Duration, error) {
+	tmp, err := c.Contract.MINREGISTRATIONDURATION(&bind.CallOpts{Context: ctx})
 	if err != nil {
 		return 0 * time.Second, err
 	}
@@ -131,17 +142,27 @@ func (c *RegistrarController) MinRegistrationDuration() (time.Duration, error) {
 // "function available(string) view returns (bool)",
 // IsAvailable returns true if the domain is available for registration.
 func (c *RegistrarController) IsAvailable(domain string) (bool, error) {
+	return c.IsAvailableCtx(context.Background(), domain)
+}
+
+// IsAvailableCtx is as per IsAvailable, with a context.
+func (c *RegistrarController) IsAvailableCtx(ctx context.Context, domain string) (bool, error) {
 	name, err := UnqualifiedName(domain, c.domain)
 	if err != nil {
 		return false, fmt.Errorf("invalid name %s", domain)
 	}
-	return c.Contract.Available(nil, name)
+	return c.Contract.Available(&bind.CallOpts{Context: ctx}, name)
 }
 
 // "function baseExtension() view returns (string)",
 // BaseExtension retrieves the baseExtension
 func (c *RegistrarController) Basextension() (string, error) {
-	return c.Contract.BaseExtension(nil)
+	return c.BasextensionCtx(context.Background())
+}
+
+// BasextensionCtx is as per Basextension, with a context.
+func (c *RegistrarController) BasextensionCtx(ctx context.Context) (string, error) {
+	return c.Contract.BaseExtension(&bind.CallOpts{Context: ctx})
 }
 
 // "function baseNode() view returns (bytes32)",
@@ -167,7 +188,7 @@ func (c *RegistrarController) Commit(opts *bind.TransactOpts, domain string, own
 	// func (_Contract *ContractCaller) MakeCommitment(opts *bind.CallOpts, name string, owner common.Address, duration *big.Int, secret [32]byte, resolver common.Address, data [][]byte, reverseRecord bool, fuses uint32, wrapperExpiry uint64) ([32]byte, error) {
 	// commitment, err := c.Contract.MakeCommitment(nil, name, owner, secret)
 	config := getConfig()
-	commitment, err := c.Contract.MakeCommitment(nil, name, owner, duration, secret, config.commitmentData.publicResover, config.commitmentData.calldata, config.commitmentData.reverseRecord, config.commitmentData.fuses, config.commitmentData.wrapperExpiry)
+	commitment, err := c.Contract.MakeCommitment(&bind.CallOpts{Context: optsContext(opts)}, name, owner, duration, secret, config.commitmentData.publicResover, config.commitmentData.calldata, config.commitmentData.reverseRecord, config.commitmentData.fuses, config.commitmentData.wrapperExpiry)
 	if err != nil {
 		return nil, errors.New("failed to create commitment")
 	}
@@ -176,7 +197,8 @@ func (c *RegistrarController) Commit(opts *bind.TransactOpts, domain string, own
 		return nil, errors.New("commitment should have 0 value")
 	}
 
-	return c.Contract.Commit(opts, commitment)
+	tx, err := c.Contract.Commit(opts, commitment)
+	return tx, DecodeError(err)
 }
 
 // "function commitments(bytes32) view returns (uint256)"
@@ -187,24 +209,34 @@ func (c *RegistrarController) Commitments(opts *bind.CallOpts, commitment [32]by
 
 // CommitmentTime states the time at which a commitment was registered on the blockchain.
 func (c *RegistrarController) CommitmentTime(domain string, owner common.Address, duration *big.Int, secret [32]byte) (*big.Int, error) {
-	hash, err := c.CommitmentHash(domain, owner, duration, secret)
+	return c.CommitmentTimeCtx(context.Background(), domain, owner, duration, secret)
+}
+
+// CommitmentTimeCtx is as per CommitmentTime, with a context.
+func (c *RegistrarController) CommitmentTimeCtx(ctx context.Context, domain string, owner common.Address, duration *big.Int, secret [32]byte) (*big.Int, error) {
+	hash, err := c.CommitmentHashCtx(ctx, domain, owner, duration, secret)
 	if err != nil {
 		return nil, err
 	}
 
-	return c.Contract.Commitments(nil, hash)
+	return c.Contract.Commitments(&bind.CallOpts{Context: ctx}, hash)
 }
 
 // "function makeCommitment(string,address,uint256,bytes32,address,bytes[],bool,uint32,uint64) pure returns (bytes32)",
 // CommitmentHash returns the commitment hash for a label/owner/secret tuple
 func (c *RegistrarController) CommitmentHash(domain string, owner common.Address, duration *big.Int, secret [32]byte) (common.Hash, error) {
+	return c.CommitmentHashCtx(context.Background(), domain, owner, duration, secret)
+}
+
+// CommitmentHashCtx is as per CommitmentHash, with a context.
+func (c *RegistrarController) CommitmentHashCtx(ctx context.Context, domain string, owner common.Address, duration *big.Int, secret [32]byte) (common.Hash, error) {
 	name, err := UnqualifiedName(domain, c.domain)
 	if err != nil {
 		return common.BytesToHash([]byte{}), fmt.Errorf("invalid name %s", domain)
 	}
 
 	config := getConfig()
-	commitment, err := c.Contract.MakeCommitment(nil, name, owner, duration, secret, config.commitmentData.publicResover, config.commitmentData.calldata, config.commitmentData.reverseRecord, config.commitmentData.fuses, config.commitmentData.wrapperExpiry)
+	commitment, err := c.Contract.MakeCommitment(&bind.CallOpts{Context: ctx}, name, owner, duration, secret, config.commitmentData.publicResover, config.commitmentData.calldata, config.commitmentData.reverseRecord, config.commitmentData.fuses, config.commitmentData.wrapperExpiry)
 	// commitment, err := c.Contract.MakeCommitment(nil, name, owner, duration, secret, resolver, data, reverseRecord, fuses, wrapperExpiry)
 	if err != nil {
 		return common.BytesToHash([]byte{}), err
@@ -215,28 +247,53 @@ func (c *RegistrarController) CommitmentHash(domain string, owner common.Address
 
 // "function maxCommitmentAge() view returns (uint256)",
 func (c *RegistrarController) MaxCommitmentInterval() (*big.Int, error) {
-	return c.Contract.MaxCommitmentAge(nil)
+	return c.MaxCommitmentIntervalCtx(context.Background())
+}
+
+// MaxCommitmentIntervalCtx is as per MaxCommitmentInterval, with a context.
+func (c *RegistrarController) MaxCommitmentIntervalCtx(ctx context.Context) (*big.Int, error) {
+	return c.Contract.MaxCommitmentAge(&bind.CallOpts{Context: ctx})
 }
 
 // "function minCommitmentAge() view returns (uint256)",
 // MinCommitmentInterval returns the minimum time that has to pass between a commit and reveal
 func (c *RegistrarController) MinCommitmentInterval() (*big.Int, error) {
-	return c.Contract.MinCommitmentAge(nil)
+	return c.MinCommitmentIntervalCtx(context.Background())
+}
+
+// MinCommitmentIntervalCtx is as per MinCommitmentInterval, with a context.
+func (c *RegistrarController) MinCommitmentIntervalCtx(ctx context.Context) (*big.Int, error) {
+	return c.Contract.MinCommitmentAge(&bind.CallOpts{Context: ctx})
 }
 
 // "function nameWrapper() view returns (address)",
 func (c *RegistrarController) NameWrapper() (common.Address, error) {
-	return c.Contract.NameWrapper(nil)
+	return c.NameWrapperCtx(context.Background())
+}
+
+// NameWrapperCtx is as per NameWrapper, with a context.
+func (c *RegistrarController) NameWrapperCtx(ctx context.Context) (common.Address, error) {
+	return c.Contract.NameWrapper(&bind.CallOpts{Context: ctx})
 }
 
 // "function owner() view returns (address)",
 func (c *RegistrarController) Owner() (common.Address, error) {
-	return c.Contract.Owner(nil)
+	return c.OwnerCtx(context.Background())
+}
+
+// OwnerCtx is as per Owner, with a context.
+func (c *RegistrarController) OwnerCtx(ctx context.Context) (common.Address, error) {
+	return c.Contract.Owner(&bind.CallOpts{Context: ctx})
 }
 
 // "function prices() view returns (address)",
 func (c *RegistrarController) Prices() (common.Address, error) {
-	return c.Contract.Prices(nil)
+	return c.PricesCtx(context.Background())
+}
+
+// PricesCtx is as per Prices, with a context.
+func (c *RegistrarController) PricesCtx(ctx context.Context) (common.Address, error) {
+	return c.Contract.Prices(&bind.CallOpts{Context: ctx})
 }
 
 // "function recoverFunds(address,address,uint256)",
@@ -246,7 +303,8 @@ func (c *RegistrarController) RecoverFunds(opts *bind.TransactOpts, token common
 
 // "function register(string,address,uint256,bytes32,address,bytes[],bool,uint32,uint64) payable",
 func (c *RegistrarController) Register(opts *bind.TransactOpts, name string, owner common.Address, duration *big.Int, secret [32]byte, resolver common.Address, data [][]byte, reverseRecord bool, fuses uint32, wrapperExpiry uint64) (*types.Transaction, error) {
-	return c.Contract.Register(opts, name, owner, duration, secret, resolver, data, reverseRecord, fuses, wrapperExpiry)
+	tx, err := c.Contract.Register(opts, name, owner, duration, secret, resolver, data, reverseRecord, fuses, wrapperExpiry)
+	return tx, DecodeError(err)
 }
 
 // "function renew(string,uint256) payable",
@@ -256,7 +314,8 @@ func (c *RegistrarController) Register(opts *bind.TransactOpts, name string, own
 
 // "function renewWithFuses(string,uint256,uint32,uint64) payable",
 func (c *RegistrarController) RenewWithFuses(opts *bind.TransactOpts, name string, duration *big.Int, fuses uint32, wrapperExpiry uint64) (*types.Transaction, error) {
-	return c.Contract.RenewWithFuses(opts, name, duration, fuses, wrapperExpiry)
+	tx, err := c.Contract.RenewWithFuses(opts, name, duration, fuses, wrapperExpiry)
+	return tx, DecodeError(err)
 }
 
 // "function renounceOwnership()",
@@ -271,12 +330,17 @@ func (c *RegistrarController) RentPrice(opts *bind.CallOpts, name string, durati
 
 // RentCost returns the cost of rent in wei-per-second.
 func (c *RegistrarController) RentCost(domain string) (*big.Int, error) {
+	return c.RentCostCtx(context.Background(), domain)
+}
+
+// RentCostCtx is as per RentCost, with a context.
+func (c *RegistrarController) RentCostCtx(ctx context.Context, domain string) (*big.Int, error) {
 	name, err := UnqualifiedName(domain, c.domain)
 	if err != nil {
 		return nil, fmt.Errorf("invalid name %s", domain)
 	}
 	//TODO Modify this to read the value returned from the PriceOracle type IPriceOraclePrice
-	priceOraclePrice, err := c.Contract.RentPrice(nil, name, big.NewInt(1))
+	priceOraclePrice, err := c.Contract.RentPrice(&bind.CallOpts{Context: ctx}, name, big.NewInt(1))
 	if err != nil {
 		return nil, fmt.Errorf("invalid price for %s", domain)
 	}
@@ -287,12 +351,17 @@ func (c *RegistrarController) RentCost(domain string) (*big.Int, error) {
 
 // "function reverseRegistrar() view returns (address)",
 func (c *RegistrarController) ReverseRegistrar() (common.Address, error) {
-	return c.Contract.ReverseRegistrar(nil)
+	return c.ReverseRegistrarCtx(context.Background())
+}
+
+// ReverseRegistrarCtx is as per ReverseRegistrar, with a context.
+func (c *RegistrarController) ReverseRegistrarCtx(ctx context.Context) (common.Address, error) {
+	return c.Contract.ReverseRegistrar(&bind.CallOpts{Context: ctx})
 }
 
 // "function supportsInterface(bytes4) pure returns (bool)",
 func (c *RegistrarController) SupportsInterface(opts *bind.CallOpts, interfaceID [4]byte) (bool, error) {
-	return c.Contract.SupportsInterface(nil, interfaceID)
+	return c.Contract.SupportsInterface(opts, interfaceID)
 }
 
 // "function transferOwnership(address)",
@@ -302,11 +371,16 @@ func (c *RegistrarController) TransferOwnership(opts *bind.TransactOpts, newOwne
 
 // IsValid returns true if the domain is considered valid by the controller.
 func (c *RegistrarController) IsValid(domain string) (bool, error) {
+	return c.IsValidCtx(context.Background(), domain)
+}
+
+// IsValidCtx is as per IsValid, with a context.
+func (c *RegistrarController) IsValidCtx(ctx context.Context, domain string) (bool, error) {
 	name, err := UnqualifiedName(domain, c.domain)
 	if err != nil {
 		return false, fmt.Errorf("invalid name %s", domain)
 	}
-	return c.Contract.Valid(nil, name)
+	return c.Contract.Valid(&bind.CallOpts{Context: ctx}, name)
 }
 
 // "function withdraw()"
@@ -328,7 +402,8 @@ func (c *RegistrarController) Reveal(opts *bind.TransactOpts, domain string, own
 		return nil, errors.New("no ether supplied with transaction")
 	}
 
-	commitTS, err := c.CommitmentTime(name, owner, duration, secret)
+	ctx := optsContext(opts)
+	commitTS, err := c.CommitmentTimeCtx(ctx, name, owner, duration, secret)
 	if err != nil {
 		return nil, err
 	}
@@ -337,7 +412,7 @@ func (c *RegistrarController) Reveal(opts *bind.TransactOpts, domain string, own
 	}
 	commit := time.Unix(commitTS.Int64(), 0)
 
-	minCommitIntervalTS, err := c.MinCommitmentInterval()
+	minCommitIntervalTS, err := c.MinCommitmentIntervalCtx(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -347,7 +422,7 @@ func (c *RegistrarController) Reveal(opts *bind.TransactOpts, domain string, own
 		return nil, errors.New("commitment too young to reveal")
 	}
 
-	maxCommitIntervalTS, err := c.MaxCommitmentInterval()
+	maxCommitIntervalTS, err := c.MaxCommitmentIntervalCtx(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -365,7 +440,7 @@ func (c *RegistrarController) Reveal(opts *bind.TransactOpts, domain string, own
 	// // duration := new(big.Int).Div(opts.Value, costPerSecond)
 
 	// Ensure duration is greater than minimum duration
-	minDuration, err := c.MinRegistrationDuration()
+	minDuration, err := c.MinRegistrationDurationCtx(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -374,7 +449,8 @@ func (c *RegistrarController) Reveal(opts *bind.TransactOpts, domain string, own
 	}
 
 	config := getConfig()
-	return c.Contract.Register(opts, name, owner, duration, secret, config.commitmentData.publicResover, config.commitmentData.calldata, config.commitmentData.reverseRecord, config.commitmentData.fuses, config.commitmentData.wrapperExpiry)
+	tx, err := c.Contract.Register(opts, name, owner, duration, secret, config.commitmentData.publicResover, config.commitmentData.calldata, config.commitmentData.reverseRecord, config.commitmentData.fuses, config.commitmentData.wrapperExpiry)
+	return tx, DecodeError(err)
 }
 
 // Renew renews a registered domain.
@@ -389,20 +465,22 @@ func (c *RegistrarController) Renew(opts *bind.TransactOpts, domain string) (*ty
 	if err != nil {
 		return nil, err
 	}
-	owner, err := registry.Owner(domain)
+	ctx := optsContext(opts)
+	owner, err := registry.OwnerCtx(ctx, domain)
 	if err != nil {
 		return nil, err
 	}
 	if owner == UnknownAddress {
-		return nil, fmt.Errorf("%s not registered", domain)
+		return nil, withReason(ErrNotRegistered, fmt.Sprintf("%s not registered", domain))
 	}
 
 	// Calculate the duration given the rent cost and the value
-	costPerSecond, err := c.RentCost(domain)
+	costPerSecond, err := c.RentCostCtx(ctx, domain)
 	if err != nil {
 		return nil, errors.New("failed to obtain rent cost")
 	}
 	duration := new(big.Int).Div(opts.Value, costPerSecond)
 
-	return c.Contract.Renew(opts, name, duration)
+	tx, err := c.Contract.Renew(opts, name, duration)
+	return tx, DecodeError(err)
 }
@@ -16,7 +16,10 @@
 package onens
 
 import (
+	"context"
+	"math"
 	"math/big"
+	"time"
 
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
@@ -33,6 +36,8 @@ type Registry struct {
 	backend      bind.ContractBackend
 	Contract     *registry.Contract
 	ContractAddr common.Address
+	// Policy is applied to the options of each transaction sent, if set
+	Policy *TxPolicy
 }
 
 // NewRegistry obtains the ENS registry
@@ -50,24 +55,38 @@ func NewRegistry(backend bind.ContractBackend) (*Registry, error) {
 
 // Owner returns the address of the owner of a name
 func (r *Registry) Owner(name string) (common.Address, error) {
+	return r.OwnerCtx(context.Background(), name)
+}
+
+// OwnerCtx is as per Owner, with a context.
+func (r *Registry) OwnerCtx(ctx context.Context, name string) (common.Address, error) {
 	nameHash, err := NameHash(name)
 	if err != nil {
 		return UnknownAddress, err
 	}
-	return r.Contract.Owner(nil, nameHash)
+	return r.Contract.Owner(&bind.CallOpts{Context: ctx}, nameHash)
 }
 
 // ResolverAddress returns the address of the resolver for a name
 func (r *Registry) ResolverAddress(name string) (common.Address, error) {
+	return r.ResolverAddressCtx(context.Background(), name)
+}
+
+// ResolverAddressCtx is as per ResolverAddress, with a context.
+func (r *Registry) ResolverAddressCtx(ctx context.Context, name string) (common.Address, error) {
 	nameHash, err := NameHash(name)
 	if err != nil {
 		return UnknownAddress, err
 	}
-	return r.Contract.Resolver(nil, nameHash)
+	return r.Contract.Resolver(&bind.CallOpts{Context: ctx}, nameHash)
 }
 
 // SetResolver sets the resolver for a name
 func (r *Registry) SetResolver(opts *bind.TransactOpts, name string, address common.Address) (*types.Transaction, error) {
+	opts, err := r.Policy.apply(opts)
+	if err != nil {
+		return nil, err
+	}
 	nameHash, err := NameHash(name)
 	if err != nil {
 		return nil, err
@@ -77,15 +96,24 @@ func (r *Registry) SetResolver(opts *bind.TransactOpts, name string, address com
 
 // Resolver returns the resolver for a name
 func (r *Registry) Resolver(name string) (*Resolver, error) {
-	address, err := r.ResolverAddress(name)
+	return r.ResolverCtx(context.Background(), name)
+}
+
+// ResolverCtx is as per Resolver, with a context.
+func (r *Registry) ResolverCtx(ctx context.Context, name string) (*Resolver, error) {
+	address, err := r.ResolverAddressCtx(ctx, name)
 	if err != nil {
 		return nil, err
 	}
-	return NewResolverAt(r.backend, name, address)
+	return NewResolverAtCtx(ctx, r.backend, name, address)
 }
 
 // SetOwner sets the ownership of a domain
 func (r *Registry) SetOwner(opts *bind.TransactOpts, name string, address common.Address) (*types.Transaction, error) {
+	opts, err := r.Policy.apply(opts)
+	if err != nil {
+		return nil, err
+	}
 	nameHash, err := NameHash(name)
 	if err != nil {
 		return nil, err
@@ -95,6 +123,10 @@ func (r *Registry) SetOwner(opts *bind.TransactOpts, name string, address common
 
 // SetSubdomainOwner sets the ownership of a subdomain, potentially creating it in the process
 func (r *Registry) SetSubdomainOwner(opts *bind.TransactOpts, name string, subname string, address common.Address) (*types.Transaction, error) {
+	opts, err := r.Policy.apply(opts)
+	if err != nil {
+		return nil, err
+	}
 	nameHash, err := NameHash(name)
 	if err != nil {
 		return nil, err
@@ -106,6 +138,66 @@ func (r *Registry) SetSubdomainOwner(opts *bind.TransactOpts, name string, subna
 	return r.Contract.SetSubnodeOwner(opts, nameHash, labelHash, address)
 }
 
+// Approve sets or clears approval for an operator to manage all names
+// controlled by the sender.
+func (r *Registry) Approve(opts *bind.TransactOpts, operator common.Address, approved bool) (*types.Transaction, error) {
+	opts, err := r.Policy.apply(opts)
+	if err != nil {
+		return nil, err
+	}
+	return r.Contract.SetApprovalForAll(opts, operator, approved)
+}
+
+// IsApproved returns true if the operator is approved to manage all names
+// controlled by the owner.
+func (r *Registry) IsApproved(owner common.Address, operator common.Address) (bool, error) {
+	return r.IsApprovedCtx(context.Background(), owner, operator)
+}
+
+// IsApprovedCtx is as per IsApproved, with a context.
+func (r *Registry) IsApprovedCtx(ctx context.Context, owner common.Address, operator common.Address) (bool, error) {
+	return r.Contract.IsApprovedForAll(&bind.CallOpts{Context: ctx}, owner, operator)
+}
+
+// TTL returns the time for which records of a name may be cached
+func (r *Registry) TTL(name string) (time.Duration, error) {
+	return r.TTLCtx(context.Background(), name)
+}
+
+// TTLCtx is as per TTL, with a context.
+func (r *Registry) TTLCtx(ctx context.Context, name string) (time.Duration, error) {
+	nameHash, err := NameHash(name)
+	if err != nil {
+		return 0, err
+	}
+	ttl, err := r.Contract.Ttl(&bind.CallOpts{Context: ctx}, nameHash)
+	if err != nil {
+		return 0, err
+	}
+	// TTLs too long to be held as a duration are capped
+	if ttl > maxTTLSeconds {
+		ttl = maxTTLSeconds
+	}
+	return time.Duration(ttl) * time.Second, nil
+}
+
+// maxTTLSeconds is the longest TTL, in seconds, that can be held as a
+// duration.
+const maxTTLSeconds = uint64(math.MaxInt64 / int64(time.Second))
+
+// SetTTL sets the time for which records of a name may be cached
+func (r *Registry) SetTTL(opts *bind.TransactOpts, name string, ttl time.Duration) (*types.Transaction, error) {
+	opts, err := r.Policy.apply(opts)
+	if err != nil {
+		return nil, err
+	}
+	nameHash, err := NameHash(name)
+	if err != nil {
+		return nil, err
+	}
+	return r.Contract.SetTTL(opts, nameHash, uint64(ttl.Seconds()))
+}
+
 // RegistryContractAddress obtains the address of the registry contract for a chain.
 // Get the Registry contract address from config
 func RegistryContractAddress(backend bind.ContractBackend) (common.Address, error) {
@@ -116,10 +208,15 @@ func RegistryContractAddress(backend bind.ContractBackend) (common.Address, erro
 // RegistryContractFromRegistrar obtains the registry contract given an
 // existing registrar contract
 func RegistryContractFromRegistrar(backend bind.ContractBackend, registrar *baseregistrar.Contract) (*registry.Contract, error) {
+	return RegistryContractFromRegistrarCtx(context.Background(), backend, registrar)
+}
+
+// RegistryContractFromRegistrarCtx is as per RegistryContractFromRegistrar, with a context.
+func RegistryContractFromRegistrarCtx(ctx context.Context, backend bind.ContractBackend, registrar *baseregistrar.Contract) (*registry.Contract, error) {
 	if registrar == nil {
 		return nil, errors.New("no registrar contract")
 	}
-	registryAddress, err := registrar.Ens(nil)
+	registryAddress, err := registrar.Ens(&bind.CallOpts{Context: ctx})
 	if err != nil {
 		return nil, err
 	}
@@ -148,10 +245,16 @@ func SetSubdomainOwner(session *registry.ContractSession, name string, subdomain
 	return session.SetSubnodeOwner(nameHash, labelHash, *ownerAddr)
 }
 
-// CreateRegistrySession creates a session suitable for multiple calls
-func CreateRegistrySession(chainID *big.Int, wallet *accounts.Wallet, account *accounts.Account, passphrase string, contract *registry.Contract, gasPrice *big.Int) *registry.ContractSession {
+// CreateRegistrySession creates a session suitable for multiple calls.
+// If policy is set it is applied to each transaction as it is signed,
+// otherwise the fees are obtained from the node, using EIP-1559 transactions
+// where the chain supports them.
+func CreateRegistrySession(chainID *big.Int, wallet *accounts.Wallet, account *accounts.Account, passphrase string, contract *registry.Contract, policy *TxPolicy) *registry.ContractSession {
 	// Create a signer
 	signer := util.AccountSigner(chainID, wallet, account, passphrase)
+	if policy != nil {
+		signer = policy.Signer(context.Background(), signer)
+	}
 
 	// Return our session
 	session := &registry.ContractSession{
@@ -160,9 +263,8 @@ func CreateRegistrySession(chainID *big.Int, wallet *accounts.Wallet, account *a
 			Pending: true,
 		},
 		TransactOpts: bind.TransactOpts{
-			From:     account.Address,
-			Signer:   signer,
-			GasPrice: gasPrice,
+			From:   account.Address,
+			Signer: signer,
 		},
 	}
 
@@ -16,9 +16,15 @@
 package onens
 
 import (
+	"context"
 	"encoding/hex"
+	"errors"
+	"math"
 	"testing"
+	"time"
 
+	"github.com/jw-1ns/go-1ns/contracts/baseregistrar"
+	"github.com/jw-1ns/go-1ns/contracts/registry"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -110,3 +116,73 @@ func TestResolveHexString(t *testing.T) {
 // 	require.Nil(t, err, "Error resotlving address")
 // 	assert.Equal(t, expected, actual, "Did not receive expected result")
 // }
+
+func TestResolveWithTTL(t *testing.T) {
+	alice := tconfig.testAccounts.aliceAddress
+	backend := newStubRegistry(t, map[string]*stubRegistryRecord{
+		"ttl.country": {owner: alice, resolver: stubResolver, addr: alice},
+	})
+	backend.handle(config.Registry, registry.ContractMetaData, "ttl", returns(uint64(300)))
+
+	address, ttl, err := ResolveWithTTL(backend, "ttl.country")
+	require.Nil(t, err, "Failed to resolve name")
+	assert.Equal(t, alice, address)
+	assert.Equal(t, 5*time.Minute, ttl)
+
+	_, ttl, err = ResolveWithTTL(backend, alice.Hex())
+	require.Nil(t, err, "Failed to resolve address")
+	assert.Equal(t, time.Duration(0), ttl)
+
+	reg, err := NewRegistry(backend)
+	require.Nil(t, err, "Failed to create registry")
+	tx, err := reg.SetTTL(stubTxOpts(alice), "ttl.country", time.Hour)
+	require.Nil(t, err, "Failed to set TTL")
+	method, args, err := stubTxCall(registry.ContractMetaData, tx)
+	require.Nil(t, err, "Failed to decode transaction")
+	assert.Equal(t, "setTTL", method)
+	assert.Equal(t, uint64(3600), args[1])
+
+	// TTLs too long for a duration are capped rather than overflowing
+	backend.handle(config.Registry, registry.ContractMetaData, "ttl", returns(uint64(math.MaxUint64)))
+	ttl, err = reg.TTL("ttl.country")
+	require.Nil(t, err, "Failed to obtain TTL")
+	assert.Equal(t, time.Duration(maxTTLSeconds)*time.Second, ttl)
+	assert.Greater(t, ttl, time.Duration(0))
+}
+
+func TestResolveCtx(t *testing.T) {
+	alice := tconfig.testAccounts.aliceAddress
+	backend := newStubRegistry(t, map[string]*stubRegistryRecord{
+		"ctx.country": {owner: alice, resolver: stubResolver, addr: alice},
+	})
+
+	address, err := ResolveCtx(context.Background(), backend, "ctx.country")
+	require.Nil(t, err, "Failed to resolve name")
+	assert.Equal(t, alice, address)
+
+	// Cancellation stops resolution before any calls are made
+	backend.calls = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = ResolveCtx(ctx, backend, "ctx.country")
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Equal(t, 0, backend.calls)
+}
+
+func TestRegistryContractFromRegistrar(t *testing.T) {
+	backend := newStubBackend()
+	backend.handle(registrarTestAddress, baseregistrar.ContractMetaData, "ens", returns(config.Registry))
+	registrar, err := baseregistrar.NewContract(registrarTestAddress, backend)
+	require.Nil(t, err, "Failed to create registrar contract")
+
+	_, err = RegistryContractFromRegistrar(backend, registrar)
+	require.Nil(t, err, "Failed to obtain registry contract")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = RegistryContractFromRegistrarCtx(ctx, backend, registrar)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = RegistryContractFromRegistrar(backend, nil)
+	assert.EqualError(t, err, "no registrar contract")
+}
@@ -0,0 +1,336 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/pkg/errors"
+)
+
+// DefaultMultiSendCallOnly is the address of the MultiSendCallOnly contract
+// of Safe v1.3.0, used to batch calls.
+var DefaultMultiSendCallOnly = common.HexToAddress("0x40A2aCCbd92BCA938b02010E17A5b8929b49130D")
+
+// safeABI contains the parts of the Safe and MultiSend contracts used here.
+const safeABI = `[
+	{"inputs":[],"name":"nonce","outputs":[{"type":"uint256"}],"stateMutability":"view","type":"function"},
+	{"inputs":[{"name":"transactions","type":"bytes"}],"name":"multiSend","outputs":[],"stateMutability":"payable","type":"function"}
+]`
+
+var (
+	safeDomainTypeHash = crypto.Keccak256Hash([]byte("EIP712Domain(uint256 chainId,address verifyingContract)"))
+	safeTxTypeHash     = crypto.Keccak256Hash([]byte("SafeTx(address to,uint256 value,bytes data,uint8 operation,uint256 safeTxGas,uint256 baseGas,uint256 gasPrice,address gasToken,address refundReceiver,uint256 nonce)"))
+)
+
+// SafeOperation is the operation of a Safe transaction.
+type SafeOperation uint8
+
+const (
+	// SafeOperationCall calls the target from the Safe.
+	SafeOperationCall SafeOperation = 0
+	// SafeOperationDelegateCall runs the code of the target in the context
+	// of the Safe, as used for MultiSend batches.
+	SafeOperationDelegateCall SafeOperation = 1
+)
+
+// SafeTx is a transaction to be proposed to the owners of a Safe.
+type SafeTx struct {
+	Safe           common.Address
+	ChainID        *big.Int
+	To             common.Address
+	Value          *big.Int
+	Data           []byte
+	Operation      SafeOperation
+	SafeTxGas      *big.Int
+	BaseGas        *big.Int
+	GasPrice       *big.Int
+	GasToken       common.Address
+	RefundReceiver common.Address
+	Nonce          *big.Int
+}
+
+// Hash returns the EIP-712 hash of the transaction, known as the
+// safeTxHash, which is signed by the owners of the Safe.  The transaction
+// must have a chain ID.
+func (t *SafeTx) Hash() common.Hash {
+	domainSeparator := crypto.Keccak256(
+		safeDomainTypeHash.Bytes(),
+		math.U256Bytes(new(big.Int).Set(t.ChainID)),
+		common.LeftPadBytes(t.Safe.Bytes(), 32),
+	)
+	structHash := crypto.Keccak256(
+		safeTxTypeHash.Bytes(),
+		common.LeftPadBytes(t.To.Bytes(), 32),
+		safeUint(t.Value),
+		crypto.Keccak256(t.Data),
+		common.LeftPadBytes([]byte{byte(t.Operation)}, 32),
+		safeUint(t.SafeTxGas),
+		safeUint(t.BaseGas),
+		safeUint(t.GasPrice),
+		common.LeftPadBytes(t.GasToken.Bytes(), 32),
+		common.LeftPadBytes(t.RefundReceiver.Bytes(), 32),
+		safeUint(t.Nonce),
+	)
+	return crypto.Keccak256Hash([]byte{0x19, 0x01}, domainSeparator, structHash)
+}
+
+// safeUint encodes an optional integer as a 32-byte word.
+func safeUint(value *big.Int) []byte {
+	if value == nil {
+		return make([]byte, 32)
+	}
+	return math.U256Bytes(new(big.Int).Set(value))
+}
+
+// safeDecimal formats an optional integer in decimal.
+func safeDecimal(value *big.Int) string {
+	if value == nil {
+		return "0"
+	}
+	return value.String()
+}
+
+// MarshalJSON encodes the transaction in the form accepted by the Safe
+// transaction service, including its safeTxHash.
+func (t *SafeTx) MarshalJSON() ([]byte, error) {
+	if t.ChainID == nil {
+		return nil, errors.New("no chain ID")
+	}
+	return json.Marshal(&struct {
+		Safe                    common.Address `json:"safe"`
+		ChainID                 string         `json:"chainId"`
+		To                      common.Address `json:"to"`
+		Value                   string         `json:"value"`
+		Data                    hexutil.Bytes  `json:"data"`
+		Operation               SafeOperation  `json:"operation"`
+		SafeTxGas               string         `json:"safeTxGas"`
+		BaseGas                 string         `json:"baseGas"`
+		GasPrice                string         `json:"gasPrice"`
+		GasToken                common.Address `json:"gasToken"`
+		RefundReceiver          common.Address `json:"refundReceiver"`
+		Nonce                   string         `json:"nonce"`
+		ContractTransactionHash common.Hash    `json:"contractTransactionHash"`
+	}{
+		Safe:                    t.Safe,
+		ChainID:                 safeDecimal(t.ChainID),
+		To:                      t.To,
+		Value:                   safeDecimal(t.Value),
+		Data:                    t.Data,
+		Operation:               t.Operation,
+		SafeTxGas:               safeDecimal(t.SafeTxGas),
+		BaseGas:                 safeDecimal(t.BaseGas),
+		GasPrice:                safeDecimal(t.GasPrice),
+		GasToken:                t.GasToken,
+		RefundReceiver:          t.RefundReceiver,
+		Nonce:                   safeDecimal(t.Nonce),
+		ContractTransactionHash: t.Hash(),
+	})
+}
+
+// SafeCall is a single call made by a Safe.
+type SafeCall struct {
+	To    common.Address
+	Value *big.Int
+	Data  []byte
+	// Summary is a human-readable description of the call
+	Summary string
+}
+
+// SafeBatch collects management operations to be carried out by a Safe,
+// either individually or as a single MultiSend transaction.
+type SafeBatch struct {
+	Safe    common.Address
+	ChainID *big.Int
+	// MultiSend is the MultiSendCallOnly contract used for batches
+	MultiSend common.Address
+	Calls     []*SafeCall
+}
+
+// NewSafeBatch creates an empty batch for a Safe.
+func NewSafeBatch(safe common.Address, chainID *big.Int) *SafeBatch {
+	return &SafeBatch{
+		Safe:      safe,
+		ChainID:   chainID,
+		MultiSend: DefaultMultiSendCallOnly,
+		Calls:     make([]*SafeCall, 0),
+	}
+}
+
+// Add adds the call made by a state-changing function of the library to the
+// batch.  The function is passed transaction options from the Safe that
+// capture the call rather than sending it, so the library's checks apply to
+// the Safe as the sender; for example:
+//
+//	err := batch.Add(ctx, nil, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+//		return name.SetResolverAddress(resolver, opts)
+//	})
+func (b *SafeBatch) Add(ctx context.Context, value *big.Int, fn func(opts *bind.TransactOpts) (*types.Transaction, error)) error {
+	captured := captureOpts(ctx, b.Safe)
+	captured.Value = value
+	tx, err := fn(captured)
+	if err != nil {
+		return err
+	}
+	if tx.To() == nil {
+		return errors.New("cannot add contract creation")
+	}
+
+	method, args, err := decodeCall(*tx.To(), tx.Data())
+	if err != nil {
+		return err
+	}
+	b.Calls = append(b.Calls, &SafeCall{
+		To:      *tx.To(),
+		Value:   tx.Value(),
+		Data:    tx.Data(),
+		Summary: summariseCall(*tx.To(), tx.Value(), method, args),
+	})
+	return nil
+}
+
+// SafeTx creates the Safe transaction for the batch with a Safe nonce, as
+// obtained from SafeNonce().  A single call is made directly; multiple calls
+// are made through MultiSend.
+func (b *SafeBatch) SafeTx(nonce *big.Int) (*SafeTx, error) {
+	if len(b.Calls) == 0 {
+		return nil, errors.New("no calls in batch")
+	}
+	if b.ChainID == nil {
+		return nil, errors.New("no chain ID")
+	}
+	tx := &SafeTx{
+		Safe:    b.Safe,
+		ChainID: b.ChainID,
+		Nonce:   nonce,
+	}
+	if len(b.Calls) == 1 {
+		tx.To = b.Calls[0].To
+		tx.Value = b.Calls[0].Value
+		tx.Data = b.Calls[0].Data
+		tx.Operation = SafeOperationCall
+		return tx, nil
+	}
+
+	// Each call is packed as operation, to, value, data length and data
+	packed := make([]byte, 0)
+	for _, call := range b.Calls {
+		packed = append(packed, byte(SafeOperationCall))
+		packed = append(packed, call.To.Bytes()...)
+		packed = append(packed, safeUint(call.Value)...)
+		packed = append(packed, math.U256Bytes(big.NewInt(int64(len(call.Data))))...)
+		packed = append(packed, call.Data...)
+	}
+	parsed, err := abi.JSON(strings.NewReader(safeABI))
+	if err != nil {
+		return nil, err
+	}
+	data, err := parsed.Pack("multiSend", packed)
+	if err != nil {
+		return nil, err
+	}
+	tx.To = b.MultiSend
+	tx.Value = big.NewInt(0)
+	tx.Data = data
+	tx.Operation = SafeOperationDelegateCall
+	return tx, nil
+}
+
+// safeBuilderFile is the JSON format of the Safe transaction builder.
+type safeBuilderFile struct {
+	Version      string           `json:"version"`
+	ChainID      string           `json:"chainId"`
+	CreatedAt    int64            `json:"createdAt"`
+	Meta         safeBuilderMeta  `json:"meta"`
+	Transactions []*safeBuilderTx `json:"transactions"`
+}
+
+type safeBuilderMeta struct {
+	Name                   string         `json:"name"`
+	Description            string         `json:"description"`
+	CreatedFromSafeAddress common.Address `json:"createdFromSafeAddress"`
+}
+
+type safeBuilderTx struct {
+	To                   common.Address `json:"to"`
+	Value                string         `json:"value"`
+	Data                 hexutil.Bytes  `json:"data"`
+	ContractMethod       interface{}    `json:"contractMethod"`
+	ContractInputsValues interface{}    `json:"contractInputsValues"`
+}
+
+// BuilderJSON returns the batch in the JSON format of the Safe transaction
+// builder, which can be loaded in to the Safe interface and proposed to the
+// owners.
+func (b *SafeBatch) BuilderJSON() ([]byte, error) {
+	if b.ChainID == nil {
+		return nil, errors.New("no chain ID")
+	}
+	file := &safeBuilderFile{
+		Version:   "1.0",
+		ChainID:   safeDecimal(b.ChainID),
+		CreatedAt: time.Now().UnixMilli(),
+		Meta: safeBuilderMeta{
+			Name:                   "go-1ns",
+			CreatedFromSafeAddress: b.Safe,
+		},
+		Transactions: make([]*safeBuilderTx, len(b.Calls)),
+	}
+	summaries := make([]string, len(b.Calls))
+	for i, call := range b.Calls {
+		summaries[i] = call.Summary
+		file.Transactions[i] = &safeBuilderTx{
+			To:    call.To,
+			Value: safeDecimal(call.Value),
+			Data:  call.Data,
+		}
+	}
+	file.Meta.Description = strings.Join(summaries, "\n")
+	return json.MarshalIndent(file, "", "  ")
+}
+
+// SafeNonce obtains the current nonce of a Safe, which is the nonce of the
+// next transaction that it will execute.
+func SafeNonce(ctx context.Context, backend bind.ContractCaller, safe common.Address) (*big.Int, error) {
+	parsed, err := abi.JSON(strings.NewReader(safeABI))
+	if err != nil {
+		return nil, err
+	}
+	data, err := parsed.Pack("nonce")
+	if err != nil {
+		return nil, err
+	}
+	res, err := backend.CallContract(ctx, ethereum.CallMsg{To: &safe, Data: data}, nil)
+	if err != nil {
+		return nil, err
+	}
+	values, err := parsed.Unpack("nonce", res)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to obtain Safe nonce")
+	}
+	return values[0].(*big.Int), nil
+}
@@ -0,0 +1,175 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var safeTestAddress = common.HexToAddress("0x00000000000000000000000000000000000005af")
+
+// safeTestHash calculates the safeTxHash with the EIP-712 implementation of
+// go-ethereum.
+func safeTestHash(t *testing.T, tx *SafeTx) common.Hash {
+	typedData := apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{Name: "chainId", Type: "uint256"},
+				{Name: "verifyingContract", Type: "address"},
+			},
+			"SafeTx": {
+				{Name: "to", Type: "address"},
+				{Name: "value", Type: "uint256"},
+				{Name: "data", Type: "bytes"},
+				{Name: "operation", Type: "uint8"},
+				{Name: "safeTxGas", Type: "uint256"},
+				{Name: "baseGas", Type: "uint256"},
+				{Name: "gasPrice", Type: "uint256"},
+				{Name: "gasToken", Type: "address"},
+				{Name: "refundReceiver", Type: "address"},
+				{Name: "nonce", Type: "uint256"},
+			},
+		},
+		PrimaryType: "SafeTx",
+		Domain: apitypes.TypedDataDomain{
+			ChainId:           (*math.HexOrDecimal256)(tx.ChainID),
+			VerifyingContract: tx.Safe.Hex(),
+		},
+		Message: apitypes.TypedDataMessage{
+			"to":             tx.To.Hex(),
+			"value":          safeDecimal(tx.Value),
+			"data":           hexutil.Encode(tx.Data),
+			"operation":      big.NewInt(int64(tx.Operation)),
+			"safeTxGas":      "0",
+			"baseGas":        "0",
+			"gasPrice":       "0",
+			"gasToken":       common.Address{}.Hex(),
+			"refundReceiver": common.Address{}.Hex(),
+			"nonce":          safeDecimal(tx.Nonce),
+		},
+	}
+	hash, _, err := apitypes.TypedDataAndHash(typedData)
+	require.Nil(t, err, "Failed to hash typed data")
+	return common.BytesToHash(hash)
+}
+
+func safeTestSetTTL(reg *Registry, name string) func(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return reg.SetTTL(opts, name, time.Hour)
+	}
+}
+
+func TestSafeSingle(t *testing.T) {
+	backend := newStubBackend()
+	reg, err := NewRegistry(backend)
+	require.Nil(t, err, "Failed to create registry")
+
+	batch := NewSafeBatch(safeTestAddress, big.NewInt(1666600000))
+	require.Nil(t, batch.Add(context.Background(), nil, safeTestSetTTL(reg, "test.country")), "Failed to add call")
+	require.Len(t, batch.Calls, 1)
+	assert.Contains(t, batch.Calls[0].Summary, "setTTL(")
+	assert.Empty(t, backend.sent)
+
+	tx, err := batch.SafeTx(big.NewInt(7))
+	require.Nil(t, err, "Failed to create Safe transaction")
+	assert.Equal(t, config.Registry, tx.To)
+	assert.Equal(t, SafeOperationCall, tx.Operation)
+	assert.Equal(t, batch.Calls[0].Data, tx.Data)
+	assert.Equal(t, safeTestHash(t, tx), tx.Hash())
+
+	data, err := json.Marshal(tx)
+	require.Nil(t, err, "Failed to encode Safe transaction")
+	var exported map[string]interface{}
+	require.Nil(t, json.Unmarshal(data, &exported), "Failed to decode Safe transaction")
+	assert.Equal(t, "7", exported["nonce"])
+	assert.Equal(t, tx.Hash().Hex(), exported["contractTransactionHash"])
+
+	_, err = NewSafeBatch(safeTestAddress, big.NewInt(1666600000)).SafeTx(big.NewInt(0))
+	assert.EqualError(t, err, "no calls in batch")
+
+	batch.ChainID = nil
+	_, err = batch.SafeTx(big.NewInt(7))
+	assert.EqualError(t, err, "no chain ID")
+	_, err = batch.BuilderJSON()
+	assert.EqualError(t, err, "no chain ID")
+	tx.ChainID = nil
+	_, err = json.Marshal(tx)
+	assert.ErrorContains(t, err, "no chain ID")
+}
+
+func TestSafeBatch(t *testing.T) {
+	backend := newStubBackend()
+	reg, err := NewRegistry(backend)
+	require.Nil(t, err, "Failed to create registry")
+
+	batch := NewSafeBatch(safeTestAddress, big.NewInt(1666600000))
+	require.Nil(t, batch.Add(context.Background(), nil, safeTestSetTTL(reg, "one.country")), "Failed to add call")
+	require.Nil(t, batch.Add(context.Background(), big.NewInt(5), safeTestSetTTL(reg, "two.country")), "Failed to add call")
+
+	tx, err := batch.SafeTx(big.NewInt(3))
+	require.Nil(t, err, "Failed to create Safe transaction")
+	assert.Equal(t, DefaultMultiSendCallOnly, tx.To)
+	assert.Equal(t, SafeOperationDelegateCall, tx.Operation)
+	assert.Equal(t, safeTestHash(t, tx), tx.Hash())
+
+	// The calls are packed in to multiSend(bytes)
+	assert.Equal(t, "0x8d80ff0a", hexutil.Encode(tx.Data[:4]))
+	packed := tx.Data[4+64:]
+	first := 1 + 20 + 32 + 32 + len(batch.Calls[0].Data)
+	assert.Equal(t, byte(0), packed[0])
+	assert.Equal(t, config.Registry.Bytes(), packed[1:21])
+	assert.Equal(t, batch.Calls[0].Data, packed[85:first])
+	assert.Equal(t, big.NewInt(5), new(big.Int).SetBytes(packed[first+21:first+53]))
+
+	data, err := batch.BuilderJSON()
+	require.Nil(t, err, "Failed to export batch")
+	var exported struct {
+		ChainID      string `json:"chainId"`
+		Transactions []struct {
+			To    common.Address `json:"to"`
+			Value string         `json:"value"`
+			Data  hexutil.Bytes  `json:"data"`
+		} `json:"transactions"`
+	}
+	require.Nil(t, json.Unmarshal(data, &exported), "Failed to decode batch")
+	assert.Equal(t, "1666600000", exported.ChainID)
+	require.Len(t, exported.Transactions, 2)
+	assert.Equal(t, "5", exported.Transactions[1].Value)
+	assert.Equal(t, hexutil.Bytes(batch.Calls[1].Data), exported.Transactions[1].Data)
+}
+
+func TestSafeNonce(t *testing.T) {
+	backend := newStubBackend()
+	backend.handle(safeTestAddress, &bind.MetaData{ABI: safeABI}, "nonce", returns(big.NewInt(12)))
+	nonce, err := SafeNonce(context.Background(), backend, safeTestAddress)
+	require.Nil(t, err, "Failed to obtain nonce")
+	assert.Equal(t, big.NewInt(12), nonce)
+
+	_, err = SafeNonce(context.Background(), backend, tconfig.testAccounts.aliceAddress)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,195 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jw-1ns/go-1ns/contracts/registry"
+	"github.com/pkg/errors"
+)
+
+// Simulation is the outcome of simulating a transaction.
+type Simulation struct {
+	From  common.Address
+	To    common.Address
+	Value *big.Int
+	Data  []byte
+	// Method and Args are the decoded call, if the method is known
+	Method string
+	Args   []interface{}
+	// Summary is a human-readable description of the call
+	Summary string
+	// Result is the decoded return value of the call, if it succeeded
+	Result []interface{}
+	// Gas is the estimated gas of the transaction, if it succeeded
+	Gas uint64
+	// Err is the reason the transaction would fail, decoded as per
+	// DecodeError, or nil if it would succeed
+	Err error
+}
+
+// Succeeded returns true if the transaction would succeed.
+func (s *Simulation) Succeeded() bool {
+	return s.Err == nil
+}
+
+// Simulate simulates the transaction created by a state-changing call
+// without sending it.  The call is passed transaction options that capture
+// the transaction, which is then run against the latest block from the
+// sender in opts, with the value in opts.  For example:
+//
+//	sim, err := onens.Simulate(ctx, client, opts, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+//		return name.SetController(controller, opts)
+//	})
+//
+// An error is returned if the transaction could not be created; a transaction
+// that would fail is reported in the Err field of the simulation.
+func Simulate(ctx context.Context, backend bind.ContractBackend, opts *bind.TransactOpts, fn func(opts *bind.TransactOpts) (*types.Transaction, error)) (*Simulation, error) {
+	if opts == nil {
+		return nil, errors.New("transaction options required")
+	}
+	captured := captureOpts(ctx, opts.From)
+	captured.Value = opts.Value
+	tx, err := fn(captured)
+	if err != nil {
+		return nil, err
+	}
+	if tx.To() == nil {
+		return nil, errors.New("cannot simulate contract creation")
+	}
+
+	sim := &Simulation{
+		From:  opts.From,
+		To:    *tx.To(),
+		Value: tx.Value(),
+		Data:  tx.Data(),
+	}
+	method, args, err := decodeCall(sim.To, sim.Data)
+	if err != nil {
+		return nil, err
+	}
+	if method != nil {
+		sim.Method = method.Name
+		sim.Args = args
+	}
+	sim.Summary = summariseCall(sim.To, sim.Value, method, sim.Args)
+
+	msg := ethereum.CallMsg{
+		From:  sim.From,
+		To:    &sim.To,
+		Value: sim.Value,
+		Data:  sim.Data,
+	}
+	res, err := backend.CallContract(ctx, msg, nil)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		sim.Err = DecodeError(err)
+		return sim, nil
+	}
+	if method != nil && len(method.Outputs) > 0 {
+		if sim.Result, err = method.Outputs.Unpack(res); err != nil {
+			return nil, errors.Wrap(err, "failed to decode result")
+		}
+	}
+	if sim.Gas, err = backend.EstimateGas(ctx, msg); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		sim.Err = DecodeError(err)
+	}
+	return sim, nil
+}
+
+// decodeCall decodes the method and arguments of a call to a 1ns contract;
+// the method is nil if it is not known.
+func decodeCall(to common.Address, data []byte) (*abi.Method, []interface{}, error) {
+	method := knownMethod(to, data)
+	if method == nil {
+		return nil, nil, nil
+	}
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed to decode call")
+	}
+	return method, args, nil
+}
+
+// knownMethod finds the method of a 1ns contract that is called by data.
+func knownMethod(to common.Address, data []byte) *abi.Method {
+	if len(data) < 4 {
+		return nil
+	}
+	metadata := contractMetadata()
+	if to == config.Registry {
+		// Avoid ambiguity with the similar methods of other contracts
+		metadata = []*bind.MetaData{registry.ContractMetaData}
+	}
+	for _, md := range metadata {
+		parsed, err := md.GetAbi()
+		if err != nil {
+			continue
+		}
+		if method, err := parsed.MethodById(data[:4]); err == nil {
+			return method
+		}
+	}
+	return nil
+}
+
+// summariseCall describes a call in human-readable form.
+func summariseCall(to common.Address, value *big.Int, method *abi.Method, args []interface{}) string {
+	var call string
+	if method == nil {
+		call = "unknown method"
+	} else {
+		parts := make([]string, len(args))
+		for i, arg := range args {
+			parts[i] = fmt.Sprintf("%s=%s", method.Inputs[i].Name, formatCallArg(arg))
+		}
+		call = fmt.Sprintf("%s(%s)", method.Name, strings.Join(parts, ", "))
+	}
+	res := fmt.Sprintf("%s on %s", call, to.Hex())
+	if value != nil && value.Sign() > 0 {
+		res = fmt.Sprintf("%s with value %v", res, value)
+	}
+	return res
+}
+
+// formatCallArg formats an argument of a call for display.
+func formatCallArg(arg interface{}) string {
+	switch v := arg.(type) {
+	case common.Address:
+		return v.Hex()
+	case [32]byte:
+		return fmt.Sprintf("%#x", v)
+	case []byte:
+		return fmt.Sprintf("%#x", v)
+	case string:
+		return fmt.Sprintf("%q", v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
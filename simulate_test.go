@@ -0,0 +1,71 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jw-1ns/go-1ns/contracts/namewrapper"
+	"github.com/jw-1ns/go-1ns/contracts/publicresolver"
+	"github.com/jw-1ns/go-1ns/contracts/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimulate(t *testing.T) {
+	alice := tconfig.testAccounts.aliceAddress
+	bob := tconfig.testAccounts.bobAddress
+	backend := newStubRegistry(t, map[string]*stubRegistryRecord{
+		"sim.country": {owner: alice, resolver: stubResolver},
+	})
+	backend.handle(stubResolver, publicresolver.ContractMetaData, "setText", returns())
+	reg, err := NewRegistry(backend)
+	require.Nil(t, err, "Failed to create registry")
+	resolver, err := reg.Resolver("sim.country")
+	require.Nil(t, err, "Failed to obtain resolver")
+
+	sim, err := Simulate(context.Background(), backend, &bind.TransactOpts{From: alice}, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return resolver.SetText(opts, "url", "https://sim.example")
+	})
+	require.Nil(t, err, "Failed to simulate")
+	assert.True(t, sim.Succeeded())
+	assert.Equal(t, "setText", sim.Method)
+	assert.Equal(t, "url", sim.Args[1])
+	assert.Equal(t, uint64(100000), sim.Gas)
+	node, _ := NameHash("sim.country")
+	assert.Equal(t, "setText(node="+formatCallArg(node)+", key=\"url\", value=\"https://sim.example\") on "+stubResolver.Hex(), sim.Summary)
+	assert.Len(t, backend.sent, 0, "Simulation should not send transactions")
+
+	// Reverts are reported with their decoded reason
+	backend.handle(config.Registry, registry.ContractMetaData, "setOwner", func(args []interface{}) ([]interface{}, error) {
+		return nil, errorsTestRevert(t, namewrapper.ContractMetaData, "Unauthorised", args[0], bob)
+	})
+	sim, err = Simulate(context.Background(), backend, &bind.TransactOpts{From: bob}, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return reg.SetOwner(opts, "sim.country", bob)
+	})
+	require.Nil(t, err, "Failed to simulate")
+	assert.False(t, sim.Succeeded())
+	assert.Equal(t, "setOwner", sim.Method)
+	assert.True(t, errors.Is(sim.Err, ErrNotAuthorised))
+
+	_, err = Simulate(context.Background(), backend, &bind.TransactOpts{From: bob}, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return nil, ErrNotAuthorised
+	})
+	assert.Equal(t, ErrNotAuthorised, err)
+}
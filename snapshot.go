@@ -0,0 +1,189 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/pkg/errors"
+)
+
+// Snapshot is a contract backend whose reads are all made at a single
+// block.  Anything created with a snapshot in place of a backend, for
+// example:
+//
+//	snapshot, err := onens.AtLatest(ctx, client)
+//	name, err := onens.NewName(snapshot, "foo.country")
+//	registrant, err := name.Registrant()
+//
+// gives answers that are consistent with each other, even where they are
+// made up of several calls to different contracts.  Calls that request a
+// specific block are passed through unchanged, and logs are only returned up
+// to the block of the snapshot.  Snapshots are for reading;
+// transactions sent through them are unaffected.
+type Snapshot struct {
+	bind.ContractBackend
+	blockNumber *big.Int
+	blockHash   *common.Hash
+}
+
+// hashCaller is a backend that can make calls at a block given by hash.
+type hashCaller interface {
+	CallContractAtHash(ctx context.Context, call ethereum.CallMsg, blockHash common.Hash) ([]byte, error)
+}
+
+// hashCodeReader is a backend that can obtain code at a block given by hash.
+type hashCodeReader interface {
+	CodeAtHash(ctx context.Context, account common.Address, blockHash common.Hash) ([]byte, error)
+}
+
+// rpcClientProvider is a backend that exposes its RPC client, such as
+// ethclient.Client.
+type rpcClientProvider interface {
+	Client() *rpc.Client
+}
+
+// headerByHashReader is a backend that can obtain headers by hash.
+type headerByHashReader interface {
+	HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error)
+}
+
+// At returns a snapshot of the backend at the given block number.
+func At(backend bind.ContractBackend, blockNumber *big.Int) *Snapshot {
+	if snapshot, isSnapshot := backend.(*Snapshot); isSnapshot {
+		backend = snapshot.ContractBackend
+	}
+	return &Snapshot{
+		ContractBackend: backend,
+		blockNumber:     new(big.Int).Set(blockNumber),
+	}
+}
+
+// AtHash returns a snapshot of the backend at the block with the given
+// hash.  Calls are made by block hash, so they fail rather than give
+// answers from another chain if the block is reorganised away.
+func AtHash(ctx context.Context, backend bind.ContractBackend, blockHash common.Hash) (*Snapshot, error) {
+	if snapshot, isSnapshot := backend.(*Snapshot); isSnapshot {
+		backend = snapshot.ContractBackend
+	}
+	if _, isHashCaller := backend.(hashCaller); !isHashCaller {
+		return nil, errors.New("backend does not support calls by block hash")
+	}
+	reader, isReader := backend.(headerByHashReader)
+	if !isReader {
+		return nil, errors.New("backend does not support headers by block hash")
+	}
+	header, err := reader.HeaderByHash(ctx, blockHash)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to obtain block")
+	}
+	return &Snapshot{
+		ContractBackend: backend,
+		blockNumber:     header.Number,
+		blockHash:       &blockHash,
+	}, nil
+}
+
+// AtLatest returns a snapshot of the backend at its current head.
+func AtLatest(ctx context.Context, backend bind.ContractBackend) (*Snapshot, error) {
+	if snapshot, isSnapshot := backend.(*Snapshot); isSnapshot {
+		backend = snapshot.ContractBackend
+	}
+	header, err := backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to obtain latest block")
+	}
+	return At(backend, header.Number), nil
+}
+
+// BlockNumber returns the number of the block at which reads are made.
+func (s *Snapshot) BlockNumber() *big.Int {
+	return new(big.Int).Set(s.blockNumber)
+}
+
+// CallContract makes a call at the block of the snapshot, unless another
+// block is requested.
+func (s *Snapshot) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	if blockNumber != nil {
+		return s.ContractBackend.CallContract(ctx, call, blockNumber)
+	}
+	if s.blockHash != nil {
+		return s.ContractBackend.(hashCaller).CallContractAtHash(ctx, call, *s.blockHash)
+	}
+	return s.ContractBackend.CallContract(ctx, call, s.blockNumber)
+}
+
+// CodeAt obtains code at the block of the snapshot, unless another block is
+// requested.
+func (s *Snapshot) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	if blockNumber != nil {
+		return s.ContractBackend.CodeAt(ctx, contract, blockNumber)
+	}
+	if s.blockHash != nil {
+		return s.codeAtHash(ctx, contract)
+	}
+	return s.ContractBackend.CodeAt(ctx, contract, s.blockNumber)
+}
+
+// codeAtHash obtains code at the block of a snapshot taken by hash.
+func (s *Snapshot) codeAtHash(ctx context.Context, contract common.Address) ([]byte, error) {
+	if reader, isReader := s.ContractBackend.(hashCodeReader); isReader {
+		return reader.CodeAtHash(ctx, contract, *s.blockHash)
+	}
+	provider, isProvider := s.ContractBackend.(rpcClientProvider)
+	if !isProvider {
+		return nil, errors.New("backend does not support code by block hash")
+	}
+	var code hexutil.Bytes
+	if err := provider.Client().CallContext(ctx, &code, "eth_getCode", contract, rpc.BlockNumberOrHashWithHash(*s.blockHash, false)); err != nil {
+		return nil, err
+	}
+	return code, nil
+}
+
+// FilterLogs obtains logs up to the block of the snapshot.  Queries for a
+// single block given by hash are passed through unchanged.  For snapshots
+// taken by hash, logs in the block of the snapshot must be from that block,
+// otherwise it has been reorganised away and an error is returned.
+func (s *Snapshot) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	if query.BlockHash != nil {
+		return s.ContractBackend.FilterLogs(ctx, query)
+	}
+	if query.FromBlock != nil && query.FromBlock.Cmp(s.blockNumber) > 0 {
+		return []types.Log{}, nil
+	}
+	if query.ToBlock == nil || query.ToBlock.Sign() < 0 || query.ToBlock.Cmp(s.blockNumber) > 0 {
+		query.ToBlock = new(big.Int).Set(s.blockNumber)
+	}
+	logs, err := s.ContractBackend.FilterLogs(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if s.blockHash != nil {
+		for i := range logs {
+			if logs[i].BlockNumber == s.blockNumber.Uint64() && logs[i].BlockHash != *s.blockHash {
+				return nil, errors.New("snapshot block is no longer in the chain")
+			}
+		}
+	}
+	return logs, nil
+}
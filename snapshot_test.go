@@ -0,0 +1,132 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jw-1ns/go-1ns/contracts/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotLatest(t *testing.T) {
+	alice := tconfig.testAccounts.aliceAddress
+	backend := newStubRegistry(t, map[string]*stubRegistryRecord{
+		"snapshot.country": {owner: alice, resolver: stubResolver, addr: alice},
+	})
+	snapshot, err := AtLatest(context.Background(), backend)
+	require.Nil(t, err, "Failed to create snapshot")
+	assert.Equal(t, big.NewInt(100), snapshot.BlockNumber())
+
+	// The head moves on, but all reads are made at the pinned block
+	backend.head = 105
+	address, err := Resolve(snapshot, "snapshot.country")
+	require.Nil(t, err, "Failed to resolve name")
+	assert.Equal(t, tconfig.testAccounts.aliceAddress, address)
+	require.NotEmpty(t, backend.callBlocks)
+	for _, block := range backend.callBlocks {
+		assert.Equal(t, big.NewInt(100), block)
+	}
+
+	// Snapshots of snapshots are taken from the underlying backend
+	latest, err := AtLatest(context.Background(), snapshot)
+	require.Nil(t, err, "Failed to create snapshot")
+	assert.Equal(t, big.NewInt(105), latest.BlockNumber())
+	assert.Equal(t, big.NewInt(90), At(latest, big.NewInt(90)).BlockNumber())
+}
+
+func TestSnapshotHash(t *testing.T) {
+	alice := tconfig.testAccounts.aliceAddress
+	backend := newStubRegistry(t, map[string]*stubRegistryRecord{
+		"snapshot.country": {owner: alice, resolver: stubResolver, addr: alice},
+	})
+	hash := common.HexToHash("0x0102030405060708091011121314151617181920212223242526272829303132")
+	snapshot, err := AtHash(context.Background(), backend, hash)
+	require.Nil(t, err, "Failed to create snapshot")
+	assert.Equal(t, big.NewInt(0x32), snapshot.BlockNumber())
+
+	reg, err := NewRegistry(snapshot)
+	require.Nil(t, err, "Failed to create registry")
+	owner, err := reg.Owner("snapshot.country")
+	require.Nil(t, err, "Failed to obtain owner")
+	assert.Equal(t, tconfig.testAccounts.aliceAddress, owner)
+	assert.Equal(t, []interface{}{hash}, backend.callBlocks)
+}
+
+func TestSnapshotLogs(t *testing.T) {
+	backend := newStubBackend()
+	node, err := NameHash("snapshot.country")
+	require.Nil(t, err, "Failed to hash name")
+	for block := uint64(99); block <= 101; block++ {
+		backend.logs = append(backend.logs, indexerTestLog(t, registry.ContractMetaData, config.Registry, block, 0, "Transfer", node, tconfig.testAccounts.aliceAddress))
+	}
+	backend.head = 105
+	snapshot := At(backend, big.NewInt(100))
+
+	// Logs after the block of the snapshot are not returned
+	logs, err := snapshot.FilterLogs(context.Background(), ethereum.FilterQuery{})
+	require.Nil(t, err, "Failed to filter logs")
+	require.Len(t, logs, 2)
+	assert.Equal(t, uint64(100), logs[1].BlockNumber)
+	logs, err = snapshot.FilterLogs(context.Background(), ethereum.FilterQuery{FromBlock: big.NewInt(100), ToBlock: big.NewInt(105)})
+	require.Nil(t, err, "Failed to filter logs")
+	require.Len(t, logs, 1)
+	logs, err = snapshot.FilterLogs(context.Background(), ethereum.FilterQuery{FromBlock: big.NewInt(101)})
+	require.Nil(t, err, "Failed to filter logs")
+	assert.Empty(t, logs)
+
+	// Logs in the block of a snapshot by hash must be from that block
+	hash := common.HexToHash("0x0102030405060708091011121314151617181920212223242526272829303164")
+	byHash, err := AtHash(context.Background(), backend, hash)
+	require.Nil(t, err, "Failed to create snapshot")
+	_, err = byHash.FilterLogs(context.Background(), ethereum.FilterQuery{})
+	assert.EqualError(t, err, "snapshot block is no longer in the chain")
+	backend.logs[1].BlockHash = hash
+	logs, err = byHash.FilterLogs(context.Background(), ethereum.FilterQuery{})
+	require.Nil(t, err, "Failed to filter logs")
+	assert.Len(t, logs, 2)
+}
+
+// snapshotTestCodeBackend is a backend that can obtain code by block hash.
+type snapshotTestCodeBackend struct {
+	*stubBackend
+	hashes []common.Hash
+}
+
+func (b *snapshotTestCodeBackend) CodeAtHash(ctx context.Context, account common.Address, blockHash common.Hash) ([]byte, error) {
+	b.hashes = append(b.hashes, blockHash)
+	return b.CodeAt(ctx, account, nil)
+}
+
+func TestSnapshotCodeByHash(t *testing.T) {
+	hash := common.HexToHash("0x0102030405060708091011121314151617181920212223242526272829303132")
+	snapshot, err := AtHash(context.Background(), newStubRegistry(t, nil), hash)
+	require.Nil(t, err, "Failed to create snapshot")
+	_, err = snapshot.CodeAt(context.Background(), config.Registry, nil)
+	assert.EqualError(t, err, "backend does not support code by block hash")
+
+	backend := &snapshotTestCodeBackend{stubBackend: newStubRegistry(t, nil)}
+	snapshot, err = AtHash(context.Background(), backend, hash)
+	require.Nil(t, err, "Failed to create snapshot")
+	code, err := snapshot.CodeAt(context.Background(), config.Registry, nil)
+	require.Nil(t, err, "Failed to obtain code")
+	assert.NotEmpty(t, code)
+	assert.Equal(t, []common.Hash{hash}, backend.hashes)
+}
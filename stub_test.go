@@ -0,0 +1,381 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/jw-1ns/go-1ns/contracts/publicresolver"
+	"github.com/jw-1ns/go-1ns/contracts/registry"
+	"github.com/stretchr/testify/require"
+)
+
+// stubHandler answers a contract call given its unpacked arguments.
+type stubHandler func(args []interface{}) ([]interface{}, error)
+
+type stubContract struct {
+	abi      *abi.ABI
+	handlers map[string]stubHandler
+}
+
+// stubBackend is a contract backend that answers calls from registered
+// handlers, allowing the library to be tested without a chain.
+type stubBackend struct {
+	mu        sync.Mutex
+	contracts map[common.Address]*stubContract
+	logs      []types.Log
+	head      uint64
+	baseFee   *big.Int
+	nonces    map[common.Address]uint64
+	sent      []*types.Transaction
+	unmined   map[common.Hash]bool
+	dropped   map[common.Hash]bool
+	failed    map[common.Hash]bool
+	receipts  map[common.Hash][]*types.Log
+	calls     int
+	// callBlocks are the blocks requested by calls, by number or hash
+	callBlocks []interface{}
+	// filters are the log queries made, which fail with filterErr if set
+	filters   []ethereum.FilterQuery
+	filterErr error
+}
+
+func newStubBackend() *stubBackend {
+	return &stubBackend{
+		contracts: make(map[common.Address]*stubContract),
+		nonces:    make(map[common.Address]uint64),
+		unmined:   make(map[common.Hash]bool),
+		dropped:   make(map[common.Hash]bool),
+		failed:    make(map[common.Hash]bool),
+		receipts:  make(map[common.Hash][]*types.Log),
+		head:      100,
+	}
+}
+
+// handle registers a handler for a method of the contract at an address.
+func (s *stubBackend) handle(address common.Address, metadata *bind.MetaData, method string, handler stubHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	contract, exists := s.contracts[address]
+	if !exists {
+		parsed, err := metadata.GetAbi()
+		if err != nil {
+			panic(err)
+		}
+		contract = &stubContract{abi: parsed, handlers: make(map[string]stubHandler)}
+		s.contracts[address] = contract
+	}
+	if _, exists := contract.abi.Methods[method]; !exists {
+		panic(fmt.Sprintf("unknown method %s", method))
+	}
+	contract.handlers[method] = handler
+}
+
+// returns is a convenience for handlers that return fixed values.
+func returns(values ...interface{}) stubHandler {
+	return func([]interface{}) ([]interface{}, error) {
+		return values, nil
+	}
+}
+
+func (s *stubBackend) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.contracts[contract]; exists {
+		return []byte{0x01}, nil
+	}
+	return nil, nil
+}
+
+func (s *stubBackend) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.calls++
+	s.callBlocks = append(s.callBlocks, blockNumber)
+	contract, exists := s.contracts[*call.To]
+	s.mu.Unlock()
+	if !exists || len(call.Data) < 4 {
+		return nil, nil
+	}
+	method, err := contract.abi.MethodById(call.Data[:4])
+	if err != nil {
+		return nil, err
+	}
+	handler, exists := contract.handlers[method.Name]
+	if !exists {
+		return nil, errors.New("execution reverted")
+	}
+	args, err := method.Inputs.Unpack(call.Data[4:])
+	if err != nil {
+		return nil, err
+	}
+	res, err := handler(args)
+	if err != nil {
+		return nil, err
+	}
+	return method.Outputs.Pack(res...)
+}
+
+func (s *stubBackend) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	head := new(big.Int).SetUint64(s.head)
+	if number != nil {
+		head = number
+	}
+	return &types.Header{Number: head, BaseFee: s.baseFee, Time: 1700000000 + head.Uint64()}, nil
+}
+
+func (s *stubBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	return &types.Header{Number: big.NewInt(int64(hash[31]))}, nil
+}
+
+// CallContractAtHash makes the call as per CallContract, recording the hash.
+func (s *stubBackend) CallContractAtHash(ctx context.Context, call ethereum.CallMsg, blockHash common.Hash) ([]byte, error) {
+	res, err := s.CallContract(ctx, call, nil)
+	s.mu.Lock()
+	if len(s.callBlocks) > 0 {
+		s.callBlocks[len(s.callBlocks)-1] = blockHash
+	}
+	s.mu.Unlock()
+	return res, err
+}
+
+func (s *stubBackend) PendingCodeAt(ctx context.Context, account common.Address) ([]byte, error) {
+	return s.CodeAt(ctx, account, nil)
+}
+
+func (s *stubBackend) PendingNonceAt(ctx context.Context, account common.Address) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nonces[account], nil
+}
+
+func (s *stubBackend) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(1000000000), nil
+}
+
+func (s *stubBackend) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return big.NewInt(1000000000), nil
+}
+
+func (s *stubBackend) FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error) {
+	return &ethereum.FeeHistory{}, nil
+}
+
+func (s *stubBackend) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	return 100000, nil
+}
+
+func (s *stubBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent = append(s.sent, tx)
+	return nil
+}
+
+func (s *stubBackend) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, tx := range s.sent {
+		if tx.Hash() == txHash && !s.unmined[txHash] && !s.dropped[txHash] {
+			status := types.ReceiptStatusSuccessful
+			if s.failed[txHash] {
+				status = types.ReceiptStatusFailed
+			}
+			return &types.Receipt{
+				Status:      status,
+				TxHash:      txHash,
+				Logs:        s.receipts[txHash],
+				BlockNumber: new(big.Int).SetUint64(s.head),
+			}, nil
+		}
+	}
+	return nil, ethereum.NotFound
+}
+
+func (s *stubBackend) TransactionByHash(ctx context.Context, txHash common.Hash) (*types.Transaction, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, tx := range s.sent {
+		if tx.Hash() == txHash && !s.dropped[txHash] {
+			return tx, s.unmined[txHash], nil
+		}
+	}
+	return nil, false, ethereum.NotFound
+}
+
+// NonceAt returns the same nonce as PendingNonceAt; tests set nonces
+// directly to model transactions being mined.
+func (s *stubBackend) NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error) {
+	return s.PendingNonceAt(ctx, account)
+}
+
+func (s *stubBackend) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.filters = append(s.filters, query)
+	if s.filterErr != nil {
+		return nil, s.filterErr
+	}
+	res := make([]types.Log, 0)
+	for _, log := range s.logs {
+		if stubLogMatches(&log, &query) {
+			res = append(res, log)
+		}
+	}
+	return res, nil
+}
+
+func (s *stubBackend) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		<-quit
+		return nil
+	}), nil
+}
+
+func stubLogMatches(log *types.Log, query *ethereum.FilterQuery) bool {
+	if query.FromBlock != nil && log.BlockNumber < query.FromBlock.Uint64() {
+		return false
+	}
+	if query.ToBlock != nil && log.BlockNumber > query.ToBlock.Uint64() {
+		return false
+	}
+	if len(query.Addresses) > 0 {
+		found := false
+		for _, address := range query.Addresses {
+			if address == log.Address {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for i, topics := range query.Topics {
+		if len(topics) == 0 {
+			continue
+		}
+		if i >= len(log.Topics) {
+			return false
+		}
+		found := false
+		for _, topic := range topics {
+			if topic == log.Topics[i] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// stubTxOpts creates transaction options that build and sign nothing, so
+// that the transactions created by the library can be examined.
+func stubTxOpts(from common.Address) *bind.TransactOpts {
+	return &bind.TransactOpts{
+		From: from,
+		Signer: func(address common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			return tx, nil
+		},
+		GasLimit: 100000,
+		NoSend:   true,
+	}
+}
+
+// stubTxCall decodes the method and arguments of a transaction.
+func stubTxCall(metadata *bind.MetaData, tx *types.Transaction) (string, []interface{}, error) {
+	parsed, err := metadata.GetAbi()
+	if err != nil {
+		return "", nil, err
+	}
+	method, err := parsed.MethodById(tx.Data()[:4])
+	if err != nil {
+		return "", nil, err
+	}
+	args, err := method.Inputs.Unpack(tx.Data()[4:])
+	return method.Name, args, err
+}
+
+// stubResolver is the resolver used by the records of stub registries.
+var stubResolver = common.HexToAddress("0x1000000000000000000000000000000000000005")
+
+// stubRegistryRecord is the registry record of a name in a stub backend,
+// along with its records in stubResolver.
+type stubRegistryRecord struct {
+	owner    common.Address
+	resolver common.Address
+	addr     common.Address
+	name     string
+	text     map[string]string
+}
+
+// newStubRegistry creates a stub backend that answers registry and resolver
+// calls for the given records, keyed by name.
+func newStubRegistry(t testing.TB, records map[string]*stubRegistryRecord) *stubBackend {
+	backend := newStubBackend()
+	handleStubRegistry(t, backend, records)
+	return backend
+}
+
+// handleStubRegistry answers registry and resolver calls for the given
+// records, keyed by name.
+func handleStubRegistry(t testing.TB, backend *stubBackend, records map[string]*stubRegistryRecord) {
+	nodes := make(map[[32]byte]*stubRegistryRecord)
+	for name, record := range records {
+		node, err := NameHash(name)
+		require.Nil(t, err, "Failed to hash name")
+		nodes[node] = record
+	}
+	lookup := func(args []interface{}) *stubRegistryRecord {
+		if record, exists := nodes[args[0].([32]byte)]; exists {
+			return record
+		}
+		return &stubRegistryRecord{}
+	}
+	backend.handle(config.Registry, registry.ContractMetaData, "owner", func(args []interface{}) ([]interface{}, error) {
+		return []interface{}{lookup(args).owner}, nil
+	})
+	backend.handle(config.Registry, registry.ContractMetaData, "resolver", func(args []interface{}) ([]interface{}, error) {
+		return []interface{}{lookup(args).resolver}, nil
+	})
+	backend.handle(config.Registry, registry.ContractMetaData, "ttl", returns(uint64(0)))
+	backend.handle(stubResolver, publicresolver.ContractMetaData, "addr", func(args []interface{}) ([]interface{}, error) {
+		return []interface{}{lookup(args).addr}, nil
+	})
+	backend.handle(stubResolver, publicresolver.ContractMetaData, "name", func(args []interface{}) ([]interface{}, error) {
+		return []interface{}{lookup(args).name}, nil
+	})
+	backend.handle(stubResolver, publicresolver.ContractMetaData, "text", func(args []interface{}) ([]interface{}, error) {
+		return []interface{}{lookup(args).text[args[1].(string)]}, nil
+	})
+}
@@ -0,0 +1,245 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/pkg/errors"
+)
+
+// Subdomain represents a name below a registered name, for example
+// 'foo.bar.country'.  Subdomains are managed by the controller of their
+// parent through the registry, or through the name wrapper if the parent
+// is wrapped.
+type Subdomain struct {
+	backend bind.ContractBackend
+	// Name is the fully-qualified name of the subdomain e.g. foo.bar.country
+	Name string
+	// Parent is the fully-qualified name of the parent e.g. bar.country
+	Parent string
+	// Label is the name part of the subdomain e.g. foo
+	Label string
+	// LogRange is the range of blocks searched for events by Subdomains()
+	LogRange
+	registry *Registry
+}
+
+// NewSubdomain creates a subdomain structure.
+// Note that this does not create the subdomain on-chain.
+func NewSubdomain(backend bind.ContractBackend, name string) (*Subdomain, error) {
+	name, err := NormaliseDomain(name)
+	if err != nil {
+		return nil, err
+	}
+	parent := Domain(name)
+	if parent == "" {
+		return nil, fmt.Errorf("%s has no parent", name)
+	}
+	label, err := DomainPart(name, 1)
+	if err != nil {
+		return nil, err
+	}
+	registry, err := NewRegistry(backend)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Subdomain{
+		backend:  backend,
+		Name:     name,
+		Parent:   parent,
+		Label:    label,
+		registry: registry,
+	}, nil
+}
+
+// Subdomain obtains a subdomain of the name.
+// Note that this does not create the subdomain on-chain.
+func (n *Name) Subdomain(label string) (*Subdomain, error) {
+	return NewSubdomain(n.backend, fmt.Sprintf("%s.%s", label, n.Name))
+}
+
+// Exists returns true if the subdomain has an owner in the registry.
+func (s *Subdomain) Exists() (bool, error) {
+	return s.ExistsCtx(context.Background())
+}
+
+// ExistsCtx is as per Exists, with a context.
+func (s *Subdomain) ExistsCtx(ctx context.Context) (bool, error) {
+	owner, err := s.registry.OwnerCtx(ctx, s.Name)
+	if err != nil {
+		return false, err
+	}
+	return owner != UnknownAddress, nil
+}
+
+// Controller obtains the controller of the subdomain.  If the subdomain is
+// wrapped this is the owner of the wrapped token.
+func (s *Subdomain) Controller() (common.Address, error) {
+	return s.ControllerCtx(context.Background())
+}
+
+// ControllerCtx is as per Controller, with a context.
+func (s *Subdomain) ControllerCtx(ctx context.Context) (common.Address, error) {
+	wrapper, err := s.wrapperOf(ctx, s.Name)
+	if err != nil {
+		return UnknownAddress, err
+	}
+	if wrapper != nil {
+		return wrapper.OwnerCtx(ctx, s.Name)
+	}
+	return s.registry.OwnerCtx(ctx, s.Name)
+}
+
+// IsWrapped returns true if the subdomain is held by the name wrapper.
+func (s *Subdomain) IsWrapped() (bool, error) {
+	return s.IsWrappedCtx(context.Background())
+}
+
+// IsWrappedCtx is as per IsWrapped, with a context.
+func (s *Subdomain) IsWrappedCtx(ctx context.Context) (bool, error) {
+	wrapper, err := s.wrapperOf(ctx, s.Name)
+	if err != nil {
+		return false, err
+	}
+	return wrapper != nil, nil
+}
+
+// ResolverAddress fetches the address of the resolver contract for the
+// subdomain.
+func (s *Subdomain) ResolverAddress() (common.Address, error) {
+	return s.ResolverAddressCtx(context.Background())
+}
+
+// ResolverAddressCtx is as per ResolverAddress, with a context.
+func (s *Subdomain) ResolverAddressCtx(ctx context.Context) (common.Address, error) {
+	return s.registry.ResolverAddressCtx(ctx, s.Name)
+}
+
+// Resolver obtains the resolver for the subdomain, giving access to its
+// records.
+func (s *Subdomain) Resolver() (*Resolver, error) {
+	return s.ResolverCtx(context.Background())
+}
+
+// ResolverCtx is as per Resolver, with a context.
+func (s *Subdomain) ResolverCtx(ctx context.Context) (*Resolver, error) {
+	return s.registry.ResolverCtx(ctx, s.Name)
+}
+
+// TTL fetches the time for which records of the subdomain may be cached.
+func (s *Subdomain) TTL() (time.Duration, error) {
+	return s.TTLCtx(context.Background())
+}
+
+// TTLCtx is as per TTL, with a context.
+func (s *Subdomain) TTLCtx(ctx context.Context) (time.Duration, error) {
+	return s.registry.TTLCtx(ctx, s.Name)
+}
+
+// SetTTL sets the time for which records of the subdomain may be cached.  It
+// must be sent by the controller of the subdomain.
+func (s *Subdomain) SetTTL(opts *bind.TransactOpts, ttl time.Duration) (*types.Transaction, error) {
+	wrapper, err := s.wrapperOf(optsContext(opts), s.Name)
+	if err != nil {
+		return nil, err
+	}
+	if wrapper != nil {
+		node, err := NameHash(s.Name)
+		if err != nil {
+			return nil, err
+		}
+		tx, err := wrapper.Contract.SetTTL(opts, node, uint64(ttl.Seconds()))
+		return tx, DecodeError(err)
+	}
+	return s.registry.SetTTL(opts, s.Name, ttl)
+}
+
+// Create creates the subdomain with its owner, resolver and TTL in a single
+// transaction.  It must be sent by the controller of the parent.
+func (s *Subdomain) Create(opts *bind.TransactOpts, owner common.Address, resolver common.Address, ttl uint64) (*types.Transaction, error) {
+	exists, err := s.ExistsCtx(optsContext(opts))
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, errors.New("that subdomain already exists")
+	}
+	return s.SetRecord(opts, owner, resolver, ttl)
+}
+
+// SetRecord sets the owner, resolver and TTL of the subdomain in a single
+// transaction, creating the subdomain if it does not exist.  It must be sent
+// by the controller of the parent.
+func (s *Subdomain) SetRecord(opts *bind.TransactOpts, owner common.Address, resolver common.Address, ttl uint64) (*types.Transaction, error) {
+	parentNode, err := NameHash(s.Parent)
+	if err != nil {
+		return nil, err
+	}
+	wrapper, err := s.wrapperOf(optsContext(opts), s.Parent)
+	if err != nil {
+		return nil, err
+	}
+	if wrapper != nil {
+		if isEncodedLabel(s.Label) {
+			return nil, errors.New("cannot set the record of a wrapped subdomain with an unknown label")
+		}
+		tx, err := wrapper.Contract.SetSubnodeRecord(opts, parentNode, s.Label, owner, resolver, ttl, 0, 0)
+		return tx, DecodeError(err)
+	}
+
+	labelHash, err := LabelHash(s.Label)
+	if err != nil {
+		return nil, err
+	}
+	return s.registry.Contract.SetSubnodeRecord(opts, parentNode, labelHash, owner, resolver, ttl)
+}
+
+// Delete removes the subdomain by clearing its owner and resolver.  It must
+// be sent by the controller of the parent.
+func (s *Subdomain) Delete(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return s.SetRecord(opts, UnknownAddress, UnknownAddress, 0)
+}
+
+// SetController transfers control of the subdomain.  It must be sent by the
+// current controller of the subdomain.
+func (s *Subdomain) SetController(opts *bind.TransactOpts, controller common.Address) (*types.Transaction, error) {
+	wrapper, err := s.wrapperOf(optsContext(opts), s.Name)
+	if err != nil {
+		return nil, err
+	}
+	if wrapper != nil {
+		node, err := NameHash(s.Name)
+		if err != nil {
+			return nil, err
+		}
+		tx, err := wrapper.Contract.SafeTransferFrom(opts, opts.From, controller, new(big.Int).SetBytes(node[:]), big.NewInt(1), []byte{})
+		return tx, DecodeError(err)
+	}
+	return s.registry.SetOwner(opts, s.Name, controller)
+}
+
+// wrapperOf returns the name wrapper holding a name, or nil if the name is
+// not wrapped.
+func (s *Subdomain) wrapperOf(ctx context.Context, name string) (*NameWrapper, error) {
+	return nameWrapperOf(ctx, s.backend, s.registry, name)
+}
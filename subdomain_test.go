@@ -0,0 +1,189 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jw-1ns/go-1ns/contracts/namewrapper"
+	"github.com/jw-1ns/go-1ns/contracts/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var wrapperTestAddress = common.HexToAddress("0x2000000000000000000000000000000000000003")
+
+// newStubSubdomain creates a subdomain whose names have the given registry
+// owners.  Names owned by the wrapper are wrapped.
+func newStubSubdomain(t *testing.T, name string, owners map[string]common.Address) (*Subdomain, *stubBackend) {
+	backend := newStubBackend()
+	nodeOwners := make(map[[32]byte]common.Address)
+	for name, owner := range owners {
+		node, err := NameHash(name)
+		require.Nil(t, err, "Failed to hash name")
+		nodeOwners[node] = owner
+	}
+	backend.handle(config.Registry, registry.ContractMetaData, "owner", func(args []interface{}) ([]interface{}, error) {
+		return []interface{}{nodeOwners[args[0].([32]byte)]}, nil
+	})
+	backend.handle(wrapperTestAddress, namewrapper.ContractMetaData, "isWrapped", func(args []interface{}) ([]interface{}, error) {
+		return []interface{}{nodeOwners[args[0].([32]byte)] == wrapperTestAddress}, nil
+	})
+	backend.handle(wrapperTestAddress, namewrapper.ContractMetaData, "ownerOf", returns(tconfig.testAccounts.bobAddress))
+
+	subdomain, err := NewSubdomain(backend, name)
+	require.Nil(t, err, "Failed to create subdomain")
+	return subdomain, backend
+}
+
+func TestSubdomainUnwrapped(t *testing.T) {
+	alice := tconfig.testAccounts.aliceAddress
+	bob := tconfig.testAccounts.bobAddress
+	subdomain, _ := newStubSubdomain(t, "Sub.Test.country", map[string]common.Address{
+		"test.country": alice,
+	})
+	assert.Equal(t, "sub.test.country", subdomain.Name)
+	assert.Equal(t, "test.country", subdomain.Parent)
+	assert.Equal(t, "sub", subdomain.Label)
+
+	tx, err := subdomain.Create(stubTxOpts(alice), bob, stubResolver, 300)
+	require.Nil(t, err, "Failed to create subdomain")
+	method, args, err := stubTxCall(registry.ContractMetaData, tx)
+	require.Nil(t, err, "Failed to decode transaction")
+	assert.Equal(t, config.Registry, *tx.To())
+	assert.Equal(t, "setSubnodeRecord", method)
+	parentNode, _ := NameHash("test.country")
+	labelHash, _ := LabelHash("sub")
+	assert.Equal(t, []interface{}{parentNode, labelHash, bob, stubResolver, uint64(300)}, args)
+
+	tx, err = subdomain.Delete(stubTxOpts(alice))
+	require.Nil(t, err, "Failed to delete subdomain")
+	_, args, err = stubTxCall(registry.ContractMetaData, tx)
+	require.Nil(t, err, "Failed to decode transaction")
+	assert.Equal(t, UnknownAddress, args[2])
+	assert.Equal(t, UnknownAddress, args[3])
+}
+
+func TestSubdomainExists(t *testing.T) {
+	alice := tconfig.testAccounts.aliceAddress
+	subdomain, _ := newStubSubdomain(t, "sub.test.country", map[string]common.Address{
+		"test.country":     alice,
+		"sub.test.country": alice,
+	})
+	_, err := subdomain.Create(stubTxOpts(alice), alice, UnknownAddress, 0)
+	assert.EqualError(t, err, "that subdomain already exists")
+
+	tx, err := subdomain.SetController(stubTxOpts(alice), tconfig.testAccounts.bobAddress)
+	require.Nil(t, err, "Failed to set controller")
+	method, _, err := stubTxCall(registry.ContractMetaData, tx)
+	require.Nil(t, err, "Failed to decode transaction")
+	assert.Equal(t, "setOwner", method)
+}
+
+func TestSubdomainWrapped(t *testing.T) {
+	alice := tconfig.testAccounts.aliceAddress
+	bob := tconfig.testAccounts.bobAddress
+	subdomain, _ := newStubSubdomain(t, "sub.test.country", map[string]common.Address{
+		"test.country":     wrapperTestAddress,
+		"sub.test.country": wrapperTestAddress,
+	})
+
+	wrapped, err := subdomain.IsWrapped()
+	require.Nil(t, err, "Failed to obtain wrapped status")
+	assert.True(t, wrapped)
+	controller, err := subdomain.Controller()
+	require.Nil(t, err, "Failed to obtain controller")
+	assert.Equal(t, bob, controller)
+
+	tx, err := subdomain.SetRecord(stubTxOpts(alice), bob, stubResolver, 300)
+	require.Nil(t, err, "Failed to set record")
+	method, args, err := stubTxCall(namewrapper.ContractMetaData, tx)
+	require.Nil(t, err, "Failed to decode transaction")
+	assert.Equal(t, wrapperTestAddress, *tx.To())
+	assert.Equal(t, "setSubnodeRecord", method)
+	assert.Equal(t, "sub", args[1])
+	assert.Equal(t, bob, args[2])
+
+	tx, err = subdomain.SetController(stubTxOpts(bob), alice)
+	require.Nil(t, err, "Failed to set controller")
+	method, args, err = stubTxCall(namewrapper.ContractMetaData, tx)
+	require.Nil(t, err, "Failed to decode transaction")
+	assert.Equal(t, "safeTransferFrom", method)
+	node, _ := NameHash("sub.test.country")
+	assert.Equal(t, new(big.Int).SetBytes(node[:]), args[2])
+}
+
+func TestSubdomainWrapperErrors(t *testing.T) {
+	alice := tconfig.testAccounts.aliceAddress
+	subdomain, backend := newStubSubdomain(t, "sub.test.country", map[string]common.Address{
+		"test.country":     wrapperTestAddress,
+		"sub.test.country": wrapperTestAddress,
+	})
+
+	// An owner that reverts is a contract other than a name wrapper
+	backend.handle(wrapperTestAddress, namewrapper.ContractMetaData, "isWrapped", func([]interface{}) ([]interface{}, error) {
+		return nil, errors.New("execution reverted")
+	})
+	wrapped, err := subdomain.IsWrapped()
+	require.Nil(t, err, "Failed to obtain wrapped status")
+	assert.False(t, wrapped)
+
+	// Other failures are not taken to mean that the name is unwrapped
+	backend.handle(wrapperTestAddress, namewrapper.ContractMetaData, "isWrapped", func([]interface{}) ([]interface{}, error) {
+		return nil, errors.New("connection refused")
+	})
+	_, err = subdomain.IsWrapped()
+	assert.EqualError(t, err, "connection refused")
+	_, err = subdomain.SetController(stubTxOpts(alice), alice)
+	assert.EqualError(t, err, "connection refused")
+
+	// An owner whose isWrapped does not return a boolean is not a name
+	// wrapper
+	other := common.HexToAddress("0x99")
+	subdomain, backend = newStubSubdomain(t, "sub.test.country", map[string]common.Address{
+		"test.country":     other,
+		"sub.test.country": other,
+	})
+	backend.handle(other, &bind.MetaData{
+		ABI: `[{"inputs":[{"name":"node","type":"bytes32"}],"name":"isWrapped","outputs":[{"name":"","type":"uint256"}],"stateMutability":"view","type":"function"}]`,
+	}, "isWrapped", returns(big.NewInt(2)))
+	wrapped, err = subdomain.IsWrapped()
+	require.Nil(t, err, "Failed to obtain wrapped status")
+	assert.False(t, wrapped)
+}
+
+func TestSubdomainCtx(t *testing.T) {
+	alice := tconfig.testAccounts.aliceAddress
+	subdomain, backend := newStubSubdomain(t, "sub.test.country", map[string]common.Address{
+		"test.country": alice,
+	})
+
+	// Checks made before sending share the context of the transaction
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	opts := stubTxOpts(alice)
+	opts.Context = ctx
+	_, err := subdomain.Create(opts, alice, UnknownAddress, 0)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.Empty(t, backend.sent)
+
+	_, err = subdomain.ControllerCtx(ctx)
+	assert.True(t, errors.Is(err, context.Canceled))
+}
@@ -0,0 +1,235 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jw-1ns/go-1ns/contracts/namewrapper"
+	"golang.org/x/sync/errgroup"
+)
+
+// SubdomainNode is a node in a tree of subdomains.
+type SubdomainNode struct {
+	// Name is the fully-qualified name, with unknown labels in their encoded
+	// form
+	Name      string
+	Node      common.Hash
+	LabelHash common.Hash
+	Owner     common.Address
+	Resolver  common.Address
+	TTL       uint64
+	// Exists is true if the node currently has a record in the registry
+	Exists   bool
+	Children []*SubdomainNode
+}
+
+// Subdomains obtains the tree of subdomains below the name, to the given
+// depth.  A depth of 0 or less obtains all subdomains.
+// The tree is rebuilt from registry and name wrapper events within the
+// name's LogRange, with labels obtained from DefaultLabelStore where known.
+func (n *Name) Subdomains(ctx context.Context, depth int) (*SubdomainNode, error) {
+	return subdomainTree(ctx, n.backend, n.registry, n.LogRange, n.Name, depth)
+}
+
+// Subdomains obtains the tree of subdomains below the subdomain, to the
+// given depth.  A depth of 0 or less obtains all subdomains.
+func (s *Subdomain) Subdomains(ctx context.Context, depth int) (*SubdomainNode, error) {
+	return subdomainTree(ctx, s.backend, s.registry, s.LogRange, s.Name, depth)
+}
+
+// subdomainTree builds the tree of subdomains below a name, a level at a
+// time.
+func subdomainTree(ctx context.Context, backend bind.ContractBackend, registry *Registry, logRange LogRange, name string, depth int) (*SubdomainNode, error) {
+	node, err := NameHash(name)
+	if err != nil {
+		return nil, err
+	}
+	root := &SubdomainNode{
+		Name: name,
+		Node: node,
+	}
+	if label, err := DomainPart(name, 1); err == nil {
+		if root.LabelHash, err = LabelHash(label); err != nil {
+			return nil, err
+		}
+	}
+	nodes := []*SubdomainNode{root}
+
+	level := []*SubdomainNode{root}
+	for i := 0; len(level) > 0 && (depth <= 0 || i < depth); i++ {
+		parents := make(map[common.Hash]*SubdomainNode, len(level))
+		topics := make([]common.Hash, 0, len(level))
+		for _, parent := range level {
+			parents[parent.Node] = parent
+			topics = append(topics, parent.Node)
+		}
+		logs := make([]types.Log, 0)
+		for start := 0; start < len(topics); start += labelQueryBatch {
+			end := start + labelQueryBatch
+			if end > len(topics) {
+				end = len(topics)
+			}
+			batch, err := logRange.filterLogs(ctx, backend, ethereum.FilterQuery{
+				Addresses: []common.Address{registry.ContractAddr},
+				Topics:    [][]common.Hash{{registryEventID("NewOwner")}, topics[start:end]},
+			})
+			if err != nil {
+				return nil, err
+			}
+			logs = append(logs, batch...)
+		}
+
+		children := make([]*SubdomainNode, 0)
+		seen := make(map[common.Hash]bool)
+		owners := make(map[common.Hash]common.Address)
+		for _, log := range logs {
+			event, err := registry.Contract.ParseNewOwner(log)
+			if err != nil {
+				continue
+			}
+			parent, exists := parents[event.Node]
+			if !exists {
+				continue
+			}
+			child := subnode(parent.Node, event.Label)
+			// Logs are in chain order, so the last owner is the current one
+			owners[child] = event.Owner
+			if seen[child] {
+				continue
+			}
+			seen[child] = true
+			node := &SubdomainNode{
+				Node:      child,
+				LabelHash: log.Topics[2],
+			}
+			parent.Children = append(parent.Children, node)
+			children = append(children, node)
+		}
+		if err := learnWrappedLabels(ctx, backend, logRange, children, owners); err != nil {
+			return nil, err
+		}
+		for _, parent := range level {
+			for _, child := range parent.Children {
+				child.Name = fmt.Sprintf("%s.%s", DefaultLabelStore.Decode(child.LabelHash), parent.Name)
+			}
+			sort.Slice(parent.Children, func(i, j int) bool {
+				return parent.Children[i].Name < parent.Children[j].Name
+			})
+		}
+		nodes = append(nodes, children...)
+		level = children
+	}
+
+	if err := fillSubdomainNodes(ctx, registry, nodes); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+// learnWrappedLabels learns the labels of nodes from the name wrapper's
+// NameWrapped events, which contain the full name.  A wrapped node is owned
+// in the registry by its name wrapper, so only events from the owners of
+// the nodes are searched.
+func learnWrappedLabels(ctx context.Context, backend bind.ContractBackend, logRange LogRange, nodes []*SubdomainNode, owners map[common.Hash]common.Address) error {
+	unknown := make([]common.Hash, 0)
+	labelHashes := make(map[common.Hash]common.Hash)
+	wrappers := make([]common.Address, 0)
+	seen := make(map[common.Address]bool)
+	for _, node := range nodes {
+		if _, exists := DefaultLabelStore.Label(node.LabelHash); exists {
+			continue
+		}
+		unknown = append(unknown, node.Node)
+		labelHashes[node.Node] = node.LabelHash
+		if owner := owners[node.Node]; owner != UnknownAddress && !seen[owner] {
+			seen[owner] = true
+			wrappers = append(wrappers, owner)
+		}
+	}
+	if len(wrappers) == 0 {
+		return nil
+	}
+	for start := 0; start < len(unknown); start += labelQueryBatch {
+		end := start + labelQueryBatch
+		if end > len(unknown) {
+			end = len(unknown)
+		}
+		logs, err := logRange.filterLogs(ctx, backend, ethereum.FilterQuery{
+			Addresses: wrappers,
+			Topics:    [][]common.Hash{{wrapperEventID("NameWrapped")}, unknown[start:end]},
+		})
+		if err != nil {
+			return err
+		}
+		for _, log := range logs {
+			learnWrappedLabel(log, labelHashes)
+		}
+	}
+	return nil
+}
+
+// learnWrappedLabel learns the label from a NameWrapped event.
+func learnWrappedLabel(log types.Log, labelHashes map[common.Hash]common.Hash) {
+	filterer, err := namewrapper.NewContractFilterer(log.Address, nil)
+	if err != nil {
+		return
+	}
+	event, err := filterer.ParseNameWrapped(log)
+	if err != nil {
+		return
+	}
+	labels := dnsDecodeLabels(event.Name)
+	if len(labels) == 0 {
+		return
+	}
+	// Anyone can emit the event, so confirm the preimage.
+	hash := keccakLabel(labels[0])
+	if hash != labelHashes[event.Node] {
+		return
+	}
+	DefaultLabelStore.add(hash, labels[0])
+}
+
+// fillSubdomainNodes obtains the current registry record for each node.
+func fillSubdomainNodes(ctx context.Context, registry *Registry, nodes []*SubdomainNode) error {
+	g, ctx := errgroup.WithContext(ctx)
+	opts := &bind.CallOpts{Context: ctx}
+	g.SetLimit(defaultRegistrarConcurrency)
+	for _, node := range nodes {
+		node := node
+		g.Go(func() error {
+			var err error
+			if node.Exists, err = registry.Contract.RecordExists(opts, node.Node); err != nil {
+				return err
+			}
+			if node.Owner, err = registry.Contract.Owner(opts, node.Node); err != nil {
+				return err
+			}
+			if node.Resolver, err = registry.Contract.Resolver(opts, node.Node); err != nil {
+				return err
+			}
+			node.TTL, err = registry.Contract.Ttl(opts, node.Node)
+			return err
+		})
+	}
+	return g.Wait()
+}
@@ -0,0 +1,121 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/jw-1ns/go-1ns/contracts/namewrapper"
+	"github.com/jw-1ns/go-1ns/contracts/registry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubdomainTree(t *testing.T) {
+	alice := tconfig.testAccounts.aliceAddress
+	bob := tconfig.testAccounts.bobAddress
+	backend := newStubBackend()
+	registryContract, err := NewRegistry(backend)
+	require.Nil(t, err, "Failed to create registry")
+	name := &Name{
+		backend:  backend,
+		Name:     "tree.country",
+		Domain:   "country",
+		Label:    "tree",
+		registry: registryContract,
+	}
+
+	// Labels are hashed directly so that only some are known
+	DefaultLabelStore.Add("treeknown", "treedeep")
+	rootNode, _ := NameHash("tree.country")
+	knownNode := subnode(rootNode, keccakLabel("treeknown"))
+	wrappedNode := subnode(rootNode, keccakLabel("treewrapped"))
+	deepNode := subnode(knownNode, keccakLabel("treedeep"))
+	backend.logs = append(backend.logs,
+		indexerTestLog(t, registry.ContractMetaData, config.Registry, 1, 0, "NewOwner", rootNode, keccakLabel("treeknown"), alice),
+		indexerTestLog(t, registry.ContractMetaData, config.Registry, 2, 0, "NewOwner", rootNode, keccakLabel("treewrapped"), wrapperTestAddress),
+		indexerTestLog(t, registry.ContractMetaData, config.Registry, 3, 0, "NewOwner", rootNode, keccakLabel("treeunknown"), bob),
+		// Reassignment of an existing subdomain
+		indexerTestLog(t, registry.ContractMetaData, config.Registry, 4, 0, "NewOwner", rootNode, keccakLabel("treeknown"), bob),
+		indexerTestLog(t, registry.ContractMetaData, config.Registry, 5, 0, "NewOwner", knownNode, keccakLabel("treedeep"), alice),
+		// From a contract other than the registry
+		indexerTestLog(t, registry.ContractMetaData, wrapperTestAddress, 6, 0, "NewOwner", rootNode, keccakLabel("treeother"), alice),
+		indexerTestLog(t, namewrapper.ContractMetaData, wrapperTestAddress, 2, 1, "NameWrapped", wrappedNode, []byte("\x0btreewrapped\x04tree\x07country\x00"), alice, uint32(0), uint64(0)),
+		// From a contract that does not own the node
+		indexerTestLog(t, namewrapper.ContractMetaData, common.HexToAddress("0x99"), 3, 1, "NameWrapped", subnode(rootNode, keccakLabel("treeunknown")), []byte("\x0btreeunknown\x04tree\x07country\x00"), alice, uint32(0), uint64(0)),
+	)
+	name.StartBlock = 1
+	name.BlockRange = 50
+
+	owners := map[common.Hash]common.Address{
+		rootNode:    alice,
+		knownNode:   bob,
+		wrappedNode: wrapperTestAddress,
+		deepNode:    alice,
+	}
+	backend.handle(config.Registry, registry.ContractMetaData, "owner", func(args []interface{}) ([]interface{}, error) {
+		return []interface{}{owners[args[0].([32]byte)]}, nil
+	})
+	backend.handle(config.Registry, registry.ContractMetaData, "recordExists", func(args []interface{}) ([]interface{}, error) {
+		return []interface{}{owners[args[0].([32]byte)] != UnknownAddress}, nil
+	})
+	backend.handle(config.Registry, registry.ContractMetaData, "resolver", returns(stubResolver))
+	backend.handle(config.Registry, registry.ContractMetaData, "ttl", returns(uint64(60)))
+
+	tree, err := name.Subdomains(context.Background(), 0)
+	require.Nil(t, err, "Failed to obtain subdomains")
+	assert.Equal(t, "tree.country", tree.Name)
+	assert.Equal(t, alice, tree.Owner)
+	require.Len(t, tree.Children, 3)
+
+	children := make(map[string]*SubdomainNode)
+	for _, child := range tree.Children {
+		children[child.Name] = child
+	}
+	known := children["treeknown.tree.country"]
+	require.NotNil(t, known, "Failed to find known label")
+	assert.Equal(t, bob, known.Owner)
+	assert.Equal(t, stubResolver, known.Resolver)
+	assert.Equal(t, uint64(60), known.TTL)
+	assert.True(t, known.Exists)
+	require.Len(t, known.Children, 1)
+	assert.Equal(t, "treedeep.treeknown.tree.country", known.Children[0].Name)
+
+	require.NotNil(t, children["treewrapped.tree.country"], "Failed to learn wrapped label")
+	unknown := children[EncodeLabelHash(keccakLabel("treeunknown"))+".tree.country"]
+	require.NotNil(t, unknown, "Failed to find unknown label")
+	assert.Equal(t, subnode(rootNode, keccakLabel("treeunknown")), unknown.Node)
+	assert.False(t, unknown.Exists)
+
+	// Logs are requested a block range at a time up to the latest block
+	for _, query := range backend.filters {
+		require.NotNil(t, query.ToBlock)
+		assert.LessOrEqual(t, query.ToBlock.Uint64()-query.FromBlock.Uint64(), uint64(49))
+		assert.GreaterOrEqual(t, query.FromBlock.Uint64(), uint64(1))
+		if len(query.Topics) > 0 && query.Topics[0][0] == wrapperEventID("NameWrapped") {
+			assert.NotContains(t, query.Addresses, common.HexToAddress("0x99"))
+		}
+	}
+
+	// Depth limits the levels obtained
+	tree, err = name.Subdomains(context.Background(), 1)
+	require.Nil(t, err, "Failed to obtain subdomains")
+	require.Len(t, tree.Children, 3)
+	for _, child := range tree.Children {
+		assert.Len(t, child.Children, 0)
+	}
+}
@@ -0,0 +1,575 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jw-1ns/go-1ns/util"
+	"github.com/pkg/errors"
+)
+
+// TxStatus is the status of a transaction sent by a transaction manager.
+type TxStatus int
+
+const (
+	// TxPending is a transaction that has been sent but not mined.
+	TxPending TxStatus = iota
+	// TxMined is a transaction that has been mined.
+	TxMined
+	// TxReplaced is a transaction whose nonce was used by another transaction.
+	TxReplaced
+	// TxDropped is a transaction that is no longer known to the node.
+	TxDropped
+)
+
+// String returns the name of the status.
+func (s TxStatus) String() string {
+	switch s {
+	case TxPending:
+		return "pending"
+	case TxMined:
+		return "mined"
+	case TxReplaced:
+		return "replaced"
+	case TxDropped:
+		return "dropped"
+	default:
+		return "unknown"
+	}
+}
+
+// ManagedTx is a transaction sent by a transaction manager.
+type ManagedTx struct {
+	Hash   common.Hash
+	From   common.Address
+	Nonce  uint64
+	Status TxStatus
+	Sent   time.Time
+}
+
+// TxManagerBackend is the backend used by a transaction manager, such as
+// ethclient.Client.
+type TxManagerBackend interface {
+	bind.ContractBackend
+	ethereum.TransactionReader
+	NonceAt(ctx context.Context, account common.Address, blockNumber *big.Int) (uint64, error)
+}
+
+// TxManager assigns nonces to the transactions of each sender, allowing
+// transactions to be sent concurrently without colliding.  Transactions from
+// the same sender are queued and sent one at a time; transactions from
+// different senders are sent independently.
+//
+// Pending transactions can be replaced with ones that pay higher fees, either
+// explicitly with SpeedUp() or automatically by Bump() and Wait() once
+// BumpAfter has passed without them being mined.
+type TxManager struct {
+	// BumpAfter is the time after which a pending transaction is sped up by
+	// Bump() and Wait(); if 0 transactions are not sped up automatically
+	BumpAfter time.Duration
+	// BumpPercent is the percentage by which the fees of a transaction are
+	// raised when it is sped up or cancelled
+	BumpPercent uint64
+	// MaxFeeCap caps the fees of transactions that are sped up, if set;
+	// otherwise the cap of the fees of the policy is used, if it has one
+	MaxFeeCap *big.Int
+	// Policy is applied to the options of each transaction sent, if set
+	Policy *TxPolicy
+
+	backend      TxManagerBackend
+	pollInterval time.Duration
+	mu           sync.Mutex
+	accounts     map[common.Address]*txAccount
+}
+
+// txAccount is the state of a sender.
+type txAccount struct {
+	mu      sync.Mutex
+	nonce   uint64
+	synced  bool
+	pending map[common.Hash]*managedTx
+}
+
+// managedTx is a pending transaction along with what is required to
+// replace it.
+type managedTx struct {
+	ManagedTx
+	tx     *types.Transaction
+	signer bind.SignerFn
+}
+
+// NewTxManager creates a transaction manager.
+func NewTxManager(backend TxManagerBackend) *TxManager {
+	return &TxManager{
+		BumpPercent:  10,
+		backend:      backend,
+		pollInterval: time.Second,
+		accounts:     make(map[common.Address]*txAccount),
+	}
+}
+
+// account returns the state of a sender, creating it if required.
+func (m *TxManager) account(address common.Address) *txAccount {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	account, exists := m.accounts[address]
+	if !exists {
+		account = &txAccount{pending: make(map[common.Hash]*managedTx)}
+		m.accounts[address] = account
+	}
+	return account
+}
+
+// Send sends a transaction with the next nonce of the sender.  The function
+// is given a copy of the options with the nonce set, and should pass it to
+// a function of the library that sends a transaction, for example:
+//
+//	tx, err := manager.Send(ctx, opts, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+//	    return name.ExtendRegistration(opts)
+//	})
+//
+// If the options already have a nonce it is used as-is, allowing a pending
+// transaction to be replaced.  If the function fails the nonce of the
+// sender is re-synced from the chain before its next transaction.  If the
+// manager has a policy it is applied to the options.
+func (m *TxManager) Send(ctx context.Context, opts *bind.TransactOpts, fn func(*bind.TransactOpts) (*types.Transaction, error)) (*types.Transaction, error) {
+	account := m.account(opts.From)
+	account.mu.Lock()
+	defer account.mu.Unlock()
+
+	if !account.synced {
+		nonce, err := m.backend.PendingNonceAt(ctx, opts.From)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to obtain nonce")
+		}
+		account.nonce = nonce
+		account.synced = true
+	}
+
+	txOpts := *opts
+	if txOpts.Context == nil {
+		txOpts.Context = ctx
+	}
+	if m.Policy != nil {
+		// Fees are obtained for each transaction, as they change over time
+		policyOpts, err := m.Policy.Apply(ctx, &txOpts)
+		if err != nil {
+			return nil, err
+		}
+		txOpts = *policyOpts
+	}
+	if txOpts.Nonce == nil {
+		txOpts.Nonce = new(big.Int).SetUint64(account.nonce)
+	}
+	tx, err := fn(&txOpts)
+	if err != nil {
+		account.synced = false
+		return nil, err
+	}
+	if txOpts.NoSend {
+		return tx, nil
+	}
+
+	account.track(opts.From, tx, opts.Signer)
+	if tx.Nonce() >= account.nonce {
+		account.nonce = tx.Nonce() + 1
+	}
+	return tx, nil
+}
+
+// track adds a transaction that has been sent to those pending.
+func (a *txAccount) track(from common.Address, tx *types.Transaction, signer bind.SignerFn) *managedTx {
+	managed := &managedTx{
+		ManagedTx: ManagedTx{
+			Hash:   tx.Hash(),
+			From:   from,
+			Nonce:  tx.Nonce(),
+			Status: TxPending,
+			Sent:   time.Now(),
+		},
+		tx:     tx,
+		signer: signer,
+	}
+	a.pending[tx.Hash()] = managed
+	return managed
+}
+
+// latest returns the most recently sent pending transaction with a nonce.
+func (a *txAccount) latest(nonce uint64) *managedTx {
+	var res *managedTx
+	for _, tx := range a.pending {
+		if tx.Nonce == nonce && (res == nil || tx.Sent.After(res.Sent)) {
+			res = tx
+		}
+	}
+	return res
+}
+
+// find returns the account and pending transaction with a hash, locking the
+// account.  If the transaction is not pending the account is not locked.
+func (m *TxManager) find(hash common.Hash) (*txAccount, *managedTx) {
+	m.mu.Lock()
+	accounts := make([]*txAccount, 0, len(m.accounts))
+	for _, account := range m.accounts {
+		accounts = append(accounts, account)
+	}
+	m.mu.Unlock()
+
+	for _, account := range accounts {
+		account.mu.Lock()
+		if tx, exists := account.pending[hash]; exists {
+			return account, tx
+		}
+		account.mu.Unlock()
+	}
+	return nil, nil
+}
+
+// SpeedUp replaces a pending transaction with one that pays higher fees.  If
+// the transaction has already been replaced the most recent replacement is
+// used as the basis for the fees.
+func (m *TxManager) SpeedUp(ctx context.Context, hash common.Hash) (*types.Transaction, error) {
+	account, pending := m.find(hash)
+	if pending == nil {
+		return nil, errors.New("transaction is not pending")
+	}
+	defer account.mu.Unlock()
+
+	latest := account.latest(pending.Nonce)
+	return m.replace(ctx, account, latest, util.BumpFees(latest.tx, m.BumpPercent))
+}
+
+// Cancel replaces a pending transaction with one that pays higher fees and
+// sends nothing to the sender, so that the original transaction is not
+// carried out.  Cancellation fails if the original transaction is mined
+// first.
+func (m *TxManager) Cancel(ctx context.Context, hash common.Hash) (*types.Transaction, error) {
+	account, pending := m.find(hash)
+	if pending == nil {
+		return nil, errors.New("transaction is not pending")
+	}
+	defer account.mu.Unlock()
+
+	latest := account.latest(pending.Nonce)
+	return m.replace(ctx, account, latest, util.CancelTx(util.BumpFees(latest.tx, m.BumpPercent), latest.From))
+}
+
+// replace signs and sends a replacement for a pending transaction.  The
+// account must be locked.
+func (m *TxManager) replace(ctx context.Context, account *txAccount, pending *managedTx, replacement *types.Transaction) (*types.Transaction, error) {
+	if maxFeeCap := m.maxFeeCap(); maxFeeCap != nil && replacement.GasFeeCap().Cmp(maxFeeCap) > 0 {
+		return nil, fmt.Errorf("replacement fee of %v exceeds maximum fee of %v", replacement.GasFeeCap(), maxFeeCap)
+	}
+	if pending.signer == nil {
+		return nil, errors.New("no signer available for replacement")
+	}
+	signed, err := pending.signer(pending.From, replacement)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.backend.SendTransaction(ctx, signed); err != nil {
+		return nil, err
+	}
+	account.track(pending.From, signed, pending.signer)
+	return signed, nil
+}
+
+// maxFeeCap returns the cap on the fees of transactions that are sped up,
+// or nil if there is none.
+func (m *TxManager) maxFeeCap() *big.Int {
+	if m.MaxFeeCap != nil {
+		return m.MaxFeeCap
+	}
+	if m.Policy == nil {
+		return nil
+	}
+	switch fees := m.Policy.Fees.(type) {
+	case *util.DynamicFeeStrategy:
+		return fees.MaxFeeCap
+	case *util.LegacyFeeStrategy:
+		return fees.MaxGasPrice
+	default:
+		return nil
+	}
+}
+
+// Bump speeds up pending transactions that have not been mined within
+// BumpAfter of being sent, returning their replacements.  It does nothing if
+// BumpAfter is 0.
+func (m *TxManager) Bump(ctx context.Context) ([]*types.Transaction, error) {
+	res := make([]*types.Transaction, 0)
+	if m.BumpAfter == 0 {
+		return res, nil
+	}
+
+	m.mu.Lock()
+	accounts := make([]*txAccount, 0, len(m.accounts))
+	for _, account := range m.accounts {
+		accounts = append(accounts, account)
+	}
+	m.mu.Unlock()
+
+	for _, account := range accounts {
+		replacements, err := m.bumpAccount(ctx, account, m.BumpAfter)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, replacements...)
+	}
+	return res, nil
+}
+
+// bumpAccount speeds up the pending transactions of an account whose most
+// recent transaction for their nonce was sent longer ago than an interval.
+func (m *TxManager) bumpAccount(ctx context.Context, account *txAccount, interval time.Duration) ([]*types.Transaction, error) {
+	account.mu.Lock()
+	defer account.mu.Unlock()
+
+	res := make([]*types.Transaction, 0)
+	nonces := make(map[uint64]bool)
+	for _, tx := range account.pending {
+		nonces[tx.Nonce] = true
+	}
+	for nonce := range nonces {
+		latest := account.latest(nonce)
+		if time.Since(latest.Sent) < interval {
+			continue
+		}
+		replacement, err := m.replace(ctx, account, latest, util.BumpFees(latest.tx, m.BumpPercent))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, replacement)
+	}
+	return res, nil
+}
+
+// Wait waits for a transaction, or one that replaced it, to be mined,
+// speeding it up each time BumpAfter passes without it being mined.  If a
+// deadline is supplied Wait fails if the deadline passes, and if the
+// manager has a maximum fee the transaction is also sped up each time half
+// of the remaining time to the deadline passes, so that it is sped up more
+// often as the deadline nears.  Transactions are not sped up more often
+// than the manager polls for them.
+func (m *TxManager) Wait(ctx context.Context, hash common.Hash, deadline time.Time) (*types.Receipt, error) {
+	ticker := time.NewTicker(m.pollInterval)
+	defer ticker.Stop()
+	for {
+		receipt, err := m.check(ctx, hash, deadline)
+		if err != nil || receipt != nil {
+			return receipt, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// check checks whether a transaction or one that replaced it has been mined,
+// speeding it up if required.
+func (m *TxManager) check(ctx context.Context, hash common.Hash, deadline time.Time) (*types.Receipt, error) {
+	account, pending := m.find(hash)
+	if pending == nil {
+		// Not sent by the manager, or already known to be mined
+		receipt, err := m.backend.TransactionReceipt(ctx, hash)
+		if err != nil && !errors.Is(err, ethereum.NotFound) {
+			return nil, err
+		}
+		if receipt == nil {
+			return nil, errors.New("transaction is not pending")
+		}
+		return receipt, nil
+	}
+	defer account.mu.Unlock()
+
+	// The nonce is obtained first so that a transaction mined while
+	// receipts are being checked is not thought to have been replaced
+	latest, err := m.backend.NonceAt(ctx, pending.From, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to obtain nonce")
+	}
+	for _, tx := range account.pending {
+		if tx.Nonce != pending.Nonce {
+			continue
+		}
+		receipt, err := m.backend.TransactionReceipt(ctx, tx.Hash)
+		if err != nil && !errors.Is(err, ethereum.NotFound) {
+			return nil, err
+		}
+		if receipt != nil {
+			// Any other transactions with the nonce have been replaced
+			for hash, other := range account.pending {
+				if other.Nonce == pending.Nonce {
+					delete(account.pending, hash)
+				}
+			}
+			return receipt, nil
+		}
+	}
+
+	if pending.Nonce < latest {
+		return nil, errors.New("transaction was replaced by another transaction")
+	}
+
+	interval := m.BumpAfter
+	if !deadline.IsZero() {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return nil, errors.New("transaction was not mined before the deadline")
+		}
+		// Without a maximum fee the fees would rise without limit
+		if m.maxFeeCap() != nil && (interval == 0 || remaining/2 < interval) {
+			interval = remaining / 2
+		}
+	}
+	if interval == 0 {
+		return nil, nil
+	}
+	if interval < m.pollInterval {
+		interval = m.pollInterval
+	}
+	replaced := account.latest(pending.Nonce)
+	if time.Since(replaced.Sent) < interval {
+		return nil, nil
+	}
+	if _, err := m.replace(ctx, account, replaced, util.BumpFees(replaced.tx, m.BumpPercent)); err != nil {
+		// The transaction may have been mined since it was checked
+		if latest, nonceErr := m.backend.NonceAt(ctx, pending.From, nil); nonceErr == nil && pending.Nonce < latest {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return nil, nil
+}
+
+// Pending returns the pending transactions of a sender, in nonce order.
+// Their status is as of the last call to Refresh().
+func (m *TxManager) Pending(from common.Address) []*ManagedTx {
+	account := m.account(from)
+	account.mu.Lock()
+	defer account.mu.Unlock()
+
+	res := make([]*ManagedTx, 0, len(account.pending))
+	for _, tx := range account.pending {
+		managed := tx.ManagedTx
+		res = append(res, &managed)
+	}
+	sortManagedTxs(res)
+	return res
+}
+
+// Reset forces the nonce of a sender to be re-synced from the chain before
+// its next transaction, for example after it has sent transactions
+// elsewhere.
+func (m *TxManager) Reset(from common.Address) {
+	account := m.account(from)
+	account.mu.Lock()
+	defer account.mu.Unlock()
+	account.synced = false
+}
+
+// Refresh checks the pending transactions of all senders, returning those
+// that have been mined, replaced or dropped since the last refresh.
+// Senders with dropped transactions have their nonce re-synced from the
+// chain before their next transaction.
+func (m *TxManager) Refresh(ctx context.Context) ([]*ManagedTx, error) {
+	m.mu.Lock()
+	addresses := make([]common.Address, 0, len(m.accounts))
+	for address := range m.accounts {
+		addresses = append(addresses, address)
+	}
+	m.mu.Unlock()
+
+	res := make([]*ManagedTx, 0)
+	for _, address := range addresses {
+		done, err := m.refresh(ctx, address)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, done...)
+	}
+	sortManagedTxs(res)
+	return res, nil
+}
+
+// refresh checks the pending transactions of a sender.
+func (m *TxManager) refresh(ctx context.Context, address common.Address) ([]*ManagedTx, error) {
+	account := m.account(address)
+	account.mu.Lock()
+	defer account.mu.Unlock()
+	if len(account.pending) == 0 {
+		return nil, nil
+	}
+
+	// Transactions with nonces below the latest nonce have been mined,
+	// either themselves or a transaction that replaced them
+	latest, err := m.backend.NonceAt(ctx, address, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to obtain nonce")
+	}
+
+	res := make([]*ManagedTx, 0)
+	for hash, tx := range account.pending {
+		receipt, err := m.backend.TransactionReceipt(ctx, hash)
+		switch {
+		case err == nil && receipt != nil:
+			tx.Status = TxMined
+		case err != nil && !errors.Is(err, ethereum.NotFound):
+			return nil, err
+		case tx.Nonce < latest:
+			tx.Status = TxReplaced
+		default:
+			_, _, err := m.backend.TransactionByHash(ctx, hash)
+			if err == nil {
+				// Still pending
+				continue
+			}
+			if !errors.Is(err, ethereum.NotFound) {
+				return nil, err
+			}
+			tx.Status = TxDropped
+			account.synced = false
+		}
+		delete(account.pending, hash)
+		managed := tx.ManagedTx
+		res = append(res, &managed)
+	}
+	return res, nil
+}
+
+// sortManagedTxs sorts transactions by sender and nonce.
+func sortManagedTxs(txs []*ManagedTx) {
+	sort.Slice(txs, func(i, j int) bool {
+		if txs[i].From != txs[j].From {
+			return txs[i].From.Hex() < txs[j].From.Hex()
+		}
+		if txs[i].Nonce != txs[j].Nonce {
+			return txs[i].Nonce < txs[j].Nonce
+		}
+		return txs[i].Sent.Before(txs[j].Sent)
+	})
+}
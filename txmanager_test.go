@@ -0,0 +1,265 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jw-1ns/go-1ns/contracts/registrarcontroller"
+	"github.com/jw-1ns/go-1ns/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var txManagerTestFrom = common.HexToAddress("0x00000000000000000000000000000000000000f1")
+
+// txManagerTestOpts creates transaction options that send unsigned
+// transactions to the stub backend.
+func txManagerTestOpts() *bind.TransactOpts {
+	opts := stubTxOpts(txManagerTestFrom)
+	opts.GasPrice = big.NewInt(1)
+	opts.NoSend = false
+	return opts
+}
+
+func txManagerTestSend(t *testing.T, manager *TxManager, registry *Registry) *types.Transaction {
+	tx, err := manager.Send(context.Background(), txManagerTestOpts(), func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return registry.SetTTL(opts, "test.country", time.Hour)
+	})
+	require.Nil(t, err, "Failed to send transaction")
+	return tx
+}
+
+func TestTxManagerConcurrent(t *testing.T) {
+	backend := newStubBackend()
+	backend.nonces[txManagerTestFrom] = 5
+	registry, err := NewRegistry(backend)
+	require.Nil(t, err, "Failed to create registry")
+	manager := NewTxManager(backend)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := manager.Send(context.Background(), txManagerTestOpts(), func(opts *bind.TransactOpts) (*types.Transaction, error) {
+				return registry.SetTTL(opts, "test.country", time.Hour)
+			})
+			assert.Nil(t, err, "Failed to send transaction")
+		}()
+	}
+	wg.Wait()
+
+	require.Len(t, backend.sent, 20)
+	nonces := make(map[uint64]bool)
+	for _, tx := range backend.sent {
+		nonces[tx.Nonce()] = true
+	}
+	for nonce := uint64(5); nonce < 25; nonce++ {
+		assert.True(t, nonces[nonce], "Missing nonce %d", nonce)
+	}
+	pending := manager.Pending(txManagerTestFrom)
+	require.Len(t, pending, 20)
+	assert.Equal(t, uint64(5), pending[0].Nonce)
+	assert.Equal(t, TxPending, pending[0].Status)
+}
+
+func TestTxManagerFailure(t *testing.T) {
+	backend := newStubBackend()
+	registry, err := NewRegistry(backend)
+	require.Nil(t, err, "Failed to create registry")
+	manager := NewTxManager(backend)
+
+	assert.Equal(t, uint64(0), txManagerTestSend(t, manager, registry).Nonce())
+	assert.Equal(t, uint64(1), txManagerTestSend(t, manager, registry).Nonce())
+
+	// Failures re-sync the nonce from the chain
+	backend.nonces[txManagerTestFrom] = 7
+	_, err = manager.Send(context.Background(), txManagerTestOpts(), func(*bind.TransactOpts) (*types.Transaction, error) {
+		return nil, errors.New("failed")
+	})
+	assert.EqualError(t, err, "failed")
+	assert.Equal(t, uint64(7), txManagerTestSend(t, manager, registry).Nonce())
+
+	// An explicit nonce replaces a pending transaction
+	opts := txManagerTestOpts()
+	opts.Nonce = big.NewInt(7)
+	opts.GasPrice = big.NewInt(2)
+	tx, err := manager.Send(context.Background(), opts, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return registry.SetTTL(opts, "test.country", time.Hour)
+	})
+	require.Nil(t, err, "Failed to send transaction")
+	assert.Equal(t, uint64(7), tx.Nonce())
+	assert.Equal(t, uint64(8), txManagerTestSend(t, manager, registry).Nonce())
+}
+
+func TestTxManagerRefresh(t *testing.T) {
+	backend := newStubBackend()
+	registry, err := NewRegistry(backend)
+	require.Nil(t, err, "Failed to create registry")
+	manager := NewTxManager(backend)
+
+	txs := make([]*types.Transaction, 4)
+	for i := range txs {
+		txs[i] = txManagerTestSend(t, manager, registry)
+	}
+	// The first transaction is mined, the second is replaced, the third is
+	// dropped and the fourth remains pending
+	backend.unmined[txs[1].Hash()] = true
+	backend.dropped[txs[2].Hash()] = true
+	backend.unmined[txs[3].Hash()] = true
+	backend.nonces[txManagerTestFrom] = 2
+
+	done, err := manager.Refresh(context.Background())
+	require.Nil(t, err, "Failed to refresh")
+	require.Len(t, done, 3)
+	assert.Equal(t, txs[0].Hash(), done[0].Hash)
+	assert.Equal(t, TxMined, done[0].Status)
+	assert.Equal(t, TxReplaced, done[1].Status)
+	assert.Equal(t, TxDropped, done[2].Status)
+	assert.Equal(t, "dropped", done[2].Status.String())
+
+	pending := manager.Pending(txManagerTestFrom)
+	require.Len(t, pending, 1)
+	assert.Equal(t, txs[3].Hash(), pending[0].Hash)
+
+	// The dropped transaction causes the nonce to be re-synced
+	assert.Equal(t, uint64(2), txManagerTestSend(t, manager, registry).Nonce())
+}
+
+func TestTxManagerSpeedUp(t *testing.T) {
+	backend := newStubBackend()
+	registry, err := NewRegistry(backend)
+	require.Nil(t, err, "Failed to create registry")
+	manager := NewTxManager(backend)
+
+	tx := txManagerTestSend(t, manager, registry)
+	backend.unmined[tx.Hash()] = true
+
+	sped, err := manager.SpeedUp(context.Background(), tx.Hash())
+	require.Nil(t, err, "Failed to speed up transaction")
+	assert.Equal(t, tx.Nonce(), sped.Nonce())
+	assert.Equal(t, big.NewInt(2), sped.GasPrice())
+	assert.Equal(t, tx.Data(), sped.Data())
+
+	// Further speed ups are based on the latest replacement
+	backend.unmined[sped.Hash()] = true
+	sped, err = manager.SpeedUp(context.Background(), tx.Hash())
+	require.Nil(t, err, "Failed to speed up transaction")
+	assert.Equal(t, big.NewInt(3), sped.GasPrice())
+
+	cancelled, err := manager.Cancel(context.Background(), tx.Hash())
+	require.Nil(t, err, "Failed to cancel transaction")
+	assert.Equal(t, tx.Nonce(), cancelled.Nonce())
+	assert.Equal(t, txManagerTestFrom, *cancelled.To())
+	assert.Equal(t, uint64(21000), cancelled.Gas())
+	assert.Empty(t, cancelled.Data())
+	assert.Equal(t, big.NewInt(4), cancelled.GasPrice())
+	assert.Len(t, manager.Pending(txManagerTestFrom), 4)
+
+	manager.MaxFeeCap = big.NewInt(4)
+	_, err = manager.SpeedUp(context.Background(), tx.Hash())
+	assert.EqualError(t, err, "replacement fee of 5 exceeds maximum fee of 4")
+
+	_, err = manager.SpeedUp(context.Background(), common.HexToHash("0x01"))
+	assert.EqualError(t, err, "transaction is not pending")
+}
+
+func TestTxManagerBump(t *testing.T) {
+	backend := newStubBackend()
+	registry, err := NewRegistry(backend)
+	require.Nil(t, err, "Failed to create registry")
+	manager := NewTxManager(backend)
+	manager.pollInterval = time.Millisecond
+
+	tx := txManagerTestSend(t, manager, registry)
+	backend.unmined[tx.Hash()] = true
+
+	// Nothing is bumped without BumpAfter
+	bumped, err := manager.Bump(context.Background())
+	require.Nil(t, err, "Failed to bump transactions")
+	assert.Empty(t, bumped)
+
+	manager.BumpAfter = time.Millisecond
+	time.Sleep(2 * time.Millisecond)
+	bumped, err = manager.Bump(context.Background())
+	require.Nil(t, err, "Failed to bump transactions")
+	require.Len(t, bumped, 1)
+	assert.Equal(t, tx.Nonce(), bumped[0].Nonce())
+	backend.unmined[bumped[0].Hash()] = true
+
+	// Waiting speeds up the transaction until the replacement is mined
+	receipt, err := manager.Wait(context.Background(), tx.Hash(), time.Time{})
+	require.Nil(t, err, "Failed to wait for transaction")
+	assert.NotEqual(t, tx.Hash(), receipt.TxHash)
+	assert.NotEqual(t, bumped[0].Hash(), receipt.TxHash)
+	assert.Empty(t, manager.Pending(txManagerTestFrom))
+
+	// Deadlines fail waits that take too long
+	manager.BumpAfter = 0
+	tx = txManagerTestSend(t, manager, registry)
+	backend.unmined[tx.Hash()] = true
+	_, err = manager.Wait(context.Background(), tx.Hash(), time.Now().Add(-time.Second))
+	assert.EqualError(t, err, "transaction was not mined before the deadline")
+
+	// Deadlines only speed up transactions with a maximum fee
+	sent := len(backend.sent)
+	_, err = manager.Wait(context.Background(), tx.Hash(), time.Now().Add(20*time.Millisecond))
+	assert.EqualError(t, err, "transaction was not mined before the deadline")
+	assert.Len(t, backend.sent, sent)
+	manager.Policy = &TxPolicy{Fees: util.NewLegacyFeeStrategy(backend, big.NewInt(1000000000000))}
+	receipt, err = manager.Wait(context.Background(), tx.Hash(), time.Now().Add(time.Second))
+	require.Nil(t, err, "Failed to wait for transaction")
+	assert.NotEqual(t, tx.Hash(), receipt.TxHash)
+	assert.Len(t, backend.sent, sent+1)
+}
+
+func TestTxManagerReveal(t *testing.T) {
+	name := newStubName(t, 0, true, 0)
+	backend := name.backend.(*stubBackend)
+	commit := time.Now().Add(-2 * time.Minute)
+	backend.handle(controllerTestAddress, registrarcontroller.ContractMetaData, "makeCommitment", returns([32]byte{0x01}))
+	backend.handle(controllerTestAddress, registrarcontroller.ContractMetaData, "commitments", returns(big.NewInt(commit.Unix())))
+	backend.handle(controllerTestAddress, registrarcontroller.ContractMetaData, "minCommitmentAge", returns(big.NewInt(60)))
+	backend.handle(controllerTestAddress, registrarcontroller.ContractMetaData, "maxCommitmentAge", returns(big.NewInt(86400)))
+	backend.handle(controllerTestAddress, registrarcontroller.ContractMetaData, "MIN_REGISTRATION_DURATION", returns(big.NewInt(28*24*60*60)))
+	manager := NewTxManager(backend)
+
+	duration := big.NewInt(365 * 24 * 60 * 60)
+	deadline, err := name.RevealDeadline(txManagerTestFrom, duration, [32]byte{})
+	require.Nil(t, err, "Failed to obtain reveal deadline")
+	assert.Equal(t, commit.Unix()+86400, deadline.Unix())
+
+	opts := txManagerTestOpts()
+	opts.Value = big.NewInt(1000)
+	_, err = name.RegisterStageTwoWithManager(context.Background(), manager, txManagerTestFrom, duration, [32]byte{}, opts)
+	assert.EqualError(t, err, "transaction manager has no maximum fee")
+	manager.MaxFeeCap = big.NewInt(1000000000000)
+	receipt, err := name.RegisterStageTwoWithManager(context.Background(), manager, txManagerTestFrom, duration, [32]byte{}, opts)
+	require.Nil(t, err, "Failed to register")
+	require.Len(t, backend.sent, 1)
+	assert.Equal(t, backend.sent[0].Hash(), receipt.TxHash)
+	method, _, err := stubTxCall(registrarcontroller.ContractMetaData, backend.sent[0])
+	require.Nil(t, err, "Failed to decode transaction")
+	assert.Equal(t, "register", method)
+}
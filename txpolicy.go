@@ -0,0 +1,142 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jw-1ns/go-1ns/util"
+)
+
+// TxPolicy sets the fees and gas limits of transactions.  It can be applied
+// to the options of each transaction with Apply(), or given to a Registry,
+// Name, TxManager or Provisioner to be applied to every transaction they
+// send.
+type TxPolicy struct {
+	// Fees provides the fees of transactions; if nil the fees are left to
+	// the transaction options or the node
+	Fees util.FeeStrategy
+	// GasLimits overrides the estimated gas limit of transactions by the
+	// name of the contract method they call, for example "setText"
+	GasLimits map[string]uint64
+}
+
+// Apply returns a copy of the transaction options that follows the policy;
+// it can be passed to any function of the library that sends a transaction.
+// Fees are obtained when Apply is called, so it should be called for each
+// transaction.  Gas limits are set as transactions are signed, after the
+// gas has been estimated; to avoid estimating the gas of the methods with
+// gas limits create the contract with a backend from Backend().
+func (p *TxPolicy) Apply(ctx context.Context, opts *bind.TransactOpts) (*bind.TransactOpts, error) {
+	res := *opts
+	if res.Context == nil {
+		res.Context = ctx
+	}
+	if p.Fees != nil {
+		fees, err := p.Fees.Fees(ctx)
+		if err != nil {
+			return nil, err
+		}
+		fees.Apply(&res)
+	}
+	if len(p.GasLimits) > 0 && opts.Signer != nil {
+		signer := opts.Signer
+		res.Signer = func(address common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			return signer(address, p.withGasLimit(tx))
+		}
+	}
+	return &res, nil
+}
+
+// Signer returns a signer that applies the policy to each transaction as it
+// is signed, obtaining fees at that time.  It suits transaction options that
+// are used for many transactions, such as those of a contract session.
+func (p *TxPolicy) Signer(ctx context.Context, signer bind.SignerFn) bind.SignerFn {
+	return func(address common.Address, tx *types.Transaction) (*types.Transaction, error) {
+		if p.Fees != nil {
+			fees, err := p.Fees.Fees(ctx)
+			if err != nil {
+				return nil, err
+			}
+			tx = util.WithFees(tx, fees)
+		}
+		return signer(address, p.withGasLimit(tx))
+	}
+}
+
+// apply applies the policy, if there is one, to the options of a
+// transaction.
+func (p *TxPolicy) apply(opts *bind.TransactOpts) (*bind.TransactOpts, error) {
+	if p == nil {
+		return opts, nil
+	}
+	return p.Apply(optsContext(opts), opts)
+}
+
+// withGasLimit returns a copy of a transaction with the gas limit of the
+// policy for its call, if it has one.
+func (p *TxPolicy) withGasLimit(tx *types.Transaction) *types.Transaction {
+	if tx.To() != nil {
+		if gas, exists := p.gasLimit(*tx.To(), tx.Data()); exists {
+			return util.WithGas(tx, gas)
+		}
+	}
+	return tx
+}
+
+// gasLimit returns the gas limit of the policy for a call, if it has one.
+func (p *TxPolicy) gasLimit(to common.Address, data []byte) (uint64, bool) {
+	if len(p.GasLimits) == 0 {
+		return 0, false
+	}
+	method := knownMethod(to, data)
+	if method == nil {
+		return 0, false
+	}
+	gas, exists := p.GasLimits[method.Name]
+	return gas, exists
+}
+
+// Backend returns a backend that provides the gas limits of the policy in
+// place of estimating the gas of calls to the methods with gas limits.
+// Registries, names and resolvers created with it do not estimate the gas
+// of those methods, so can send transactions that would fail estimation.
+func (p *TxPolicy) Backend(backend bind.ContractBackend) bind.ContractBackend {
+	return &txPolicyBackend{
+		ContractBackend: backend,
+		policy:          p,
+	}
+}
+
+// txPolicyBackend is a backend that follows the gas limits of a policy.
+type txPolicyBackend struct {
+	bind.ContractBackend
+	policy *TxPolicy
+}
+
+// EstimateGas returns the gas limit of the policy for the call if it has
+// one, otherwise it estimates the gas.
+func (b *txPolicyBackend) EstimateGas(ctx context.Context, call ethereum.CallMsg) (uint64, error) {
+	if call.To != nil {
+		if gas, exists := b.policy.gasLimit(*call.To, call.Data); exists {
+			return gas, nil
+		}
+	}
+	return b.ContractBackend.EstimateGas(ctx, call)
+}
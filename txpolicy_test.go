@@ -0,0 +1,191 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package onens
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/jw-1ns/go-1ns/contracts/registry"
+	"github.com/jw-1ns/go-1ns/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gwei(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(1000000000))
+}
+
+func TestTxPolicyApply(t *testing.T) {
+	alice := tconfig.testAccounts.aliceAddress
+	backend := newStubBackend()
+	backend.baseFee = gwei(10)
+	handleStubRegistry(t, backend, map[string]*stubRegistryRecord{
+		"policy.country": {owner: alice, resolver: stubResolver},
+	})
+	reg, err := NewRegistry(backend)
+	require.Nil(t, err, "Failed to create registry")
+	resolver, err := reg.Resolver("policy.country")
+	require.Nil(t, err, "Failed to obtain resolver")
+
+	policy := &TxPolicy{
+		Fees:      util.NewDynamicFeeStrategy(backend, gwei(15)),
+		GasLimits: map[string]uint64{"setText": 50000},
+	}
+	opts, err := policy.Apply(context.Background(), stubTxOpts(alice))
+	require.Nil(t, err, "Failed to apply policy")
+	assert.Equal(t, gwei(15), opts.GasFeeCap)
+
+	tx, err := resolver.SetText(opts, "url", "https://policy.example")
+	require.Nil(t, err, "Failed to set text")
+	assert.Equal(t, uint8(types.DynamicFeeTxType), tx.Type())
+	assert.Equal(t, uint64(50000), tx.Gas())
+	assert.Equal(t, gwei(15), tx.GasFeeCap())
+
+	tx, err = resolver.SetAddress(opts, alice)
+	require.Nil(t, err, "Failed to set address")
+	assert.Equal(t, uint64(100000), tx.Gas(), "Gas limit should only be overridden for listed methods")
+}
+
+// txPolicyTestFees provides a higher gas price each time it is asked.
+type txPolicyTestFees struct {
+	price int64
+}
+
+func (f *txPolicyTestFees) Fees(ctx context.Context) (*util.Fees, error) {
+	f.price++
+	return &util.Fees{GasPrice: big.NewInt(f.price)}, nil
+}
+
+func TestTxPolicySend(t *testing.T) {
+	alice := tconfig.testAccounts.aliceAddress
+	backend := newStubRegistry(t, map[string]*stubRegistryRecord{
+		"policy.country": {owner: alice, resolver: stubResolver},
+	})
+	policy := &TxPolicy{
+		Fees:      &txPolicyTestFees{},
+		GasLimits: map[string]uint64{"setText": 50000},
+	}
+	reg, err := NewRegistry(policy.Backend(backend))
+	require.Nil(t, err, "Failed to create registry")
+	resolver, err := reg.Resolver("policy.country")
+	require.Nil(t, err, "Failed to obtain resolver")
+	manager := NewTxManager(backend)
+	manager.Policy = policy
+
+	// Fees are obtained for each transaction, and gas limits are used
+	// rather than estimated
+	opts := stubTxOpts(alice)
+	opts.GasLimit = 0
+	for i := int64(1); i <= 2; i++ {
+		tx, err := manager.Send(context.Background(), opts, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+			return resolver.SetText(opts, "url", "https://policy.example")
+		})
+		require.Nil(t, err, "Failed to set text")
+		assert.Equal(t, big.NewInt(i), tx.GasPrice())
+		assert.Equal(t, uint64(50000), tx.Gas())
+
+		gas, err := policy.Backend(backend).EstimateGas(context.Background(), ethereum.CallMsg{To: tx.To(), Data: tx.Data()})
+		require.Nil(t, err, "Failed to estimate gas")
+		assert.Equal(t, uint64(50000), gas)
+	}
+	tx, err := manager.Send(context.Background(), opts, func(opts *bind.TransactOpts) (*types.Transaction, error) {
+		return resolver.SetAddress(opts, alice)
+	})
+	require.Nil(t, err, "Failed to set address")
+	assert.Equal(t, uint64(100000), tx.Gas(), "Gas should be estimated for unlisted methods")
+}
+
+func TestTxPolicySigner(t *testing.T) {
+	alice := tconfig.testAccounts.aliceAddress
+	backend := newStubRegistry(t, map[string]*stubRegistryRecord{
+		"policy.country": {owner: alice, resolver: stubResolver},
+	})
+	backend.baseFee = gwei(10)
+	reg, err := NewRegistry(backend)
+	require.Nil(t, err, "Failed to create registry")
+	nameHash, err := NameHash("policy.country")
+	require.Nil(t, err, "Failed to hash name")
+
+	// A session reuses its options, so the policy is applied as each
+	// transaction is signed
+	policy := &TxPolicy{
+		Fees:      &txPolicyTestFees{},
+		GasLimits: map[string]uint64{"setTTL": 40000},
+	}
+	opts := stubTxOpts(alice)
+	session := &registry.ContractSession{
+		Contract: reg.Contract,
+		TransactOpts: bind.TransactOpts{
+			From:     opts.From,
+			Signer:   policy.Signer(context.Background(), opts.Signer),
+			GasLimit: opts.GasLimit,
+			NoSend:   true,
+		},
+	}
+	for i := int64(1); i <= 2; i++ {
+		tx, err := session.SetTTL(nameHash, 60)
+		require.Nil(t, err, "Failed to set TTL")
+		assert.Equal(t, uint8(types.LegacyTxType), tx.Type(), "Legacy fees should give a legacy transaction")
+		assert.Equal(t, big.NewInt(i), tx.GasPrice())
+		assert.Equal(t, uint64(40000), tx.Gas())
+	}
+
+	policy.Fees = util.NewDynamicFeeStrategy(backend, gwei(15))
+	tx, err := session.SetResolver(nameHash, stubResolver)
+	require.Nil(t, err, "Failed to set resolver")
+	assert.Equal(t, uint8(types.DynamicFeeTxType), tx.Type())
+	assert.Equal(t, gwei(15), tx.GasFeeCap())
+	assert.Equal(t, uint64(100000), tx.Gas(), "Gas limit should only be overridden for listed methods")
+}
+
+func TestTxPolicyHelpers(t *testing.T) {
+	alice := tconfig.testAccounts.aliceAddress
+	policy := &TxPolicy{
+		Fees:      &txPolicyTestFees{},
+		GasLimits: map[string]uint64{"setTTL": 40000},
+	}
+
+	name := newStubName(t, time.Now().Add(time.Hour).Unix(), false, 0)
+	handleStubRegistry(t, name.backend.(*stubBackend), map[string]*stubRegistryRecord{
+		"status.country": {owner: alice, resolver: stubResolver},
+	})
+	reg, err := NewRegistry(name.backend)
+	require.Nil(t, err, "Failed to create registry")
+	name.registry = reg
+
+	// Without a policy the options are used as given
+	tx, err := reg.SetTTL(stubTxOpts(alice), "status.country", time.Minute)
+	require.Nil(t, err, "Failed to set TTL")
+	assert.Equal(t, uint64(100000), tx.Gas())
+
+	reg.Policy = policy
+	tx, err = reg.SetTTL(stubTxOpts(alice), "status.country", time.Minute)
+	require.Nil(t, err, "Failed to set TTL")
+	assert.Equal(t, big.NewInt(1), tx.GasPrice())
+	assert.Equal(t, uint64(40000), tx.Gas())
+	reg.Policy = nil
+
+	name.Policy = policy
+	tx, err = name.SetTTL(time.Minute, stubTxOpts(alice))
+	require.Nil(t, err, "Failed to set TTL")
+	assert.Equal(t, big.NewInt(2), tx.GasPrice())
+	assert.Equal(t, uint64(40000), tx.Gas())
+}
@@ -0,0 +1,306 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Fees are the fees of a transaction.  Either GasPrice is set, for legacy
+// transactions, or GasFeeCap and GasTipCap are set, for EIP-1559
+// transactions.
+type Fees struct {
+	GasPrice  *big.Int
+	GasFeeCap *big.Int
+	GasTipCap *big.Int
+}
+
+// Apply sets the fees on transaction options.
+func (f *Fees) Apply(opts *bind.TransactOpts) {
+	opts.GasPrice = f.GasPrice
+	opts.GasFeeCap = f.GasFeeCap
+	opts.GasTipCap = f.GasTipCap
+}
+
+// FeeStrategy provides the fees for transactions.
+type FeeStrategy interface {
+	Fees(ctx context.Context) (*Fees, error)
+}
+
+// FeeHistoryReader is implemented by backends that provide eth_feeHistory,
+// such as ethclient.Client.
+type FeeHistoryReader interface {
+	FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error)
+}
+
+// LegacyFeeStrategy provides fees for legacy transactions using the gas
+// price suggested by the node.
+type LegacyFeeStrategy struct {
+	backend bind.ContractTransactor
+	// MaxGasPrice caps the gas price, if set
+	MaxGasPrice *big.Int
+}
+
+// NewLegacyFeeStrategy creates a legacy fee strategy with an optional cap on
+// the gas price.
+func NewLegacyFeeStrategy(backend bind.ContractTransactor, maxGasPrice *big.Int) *LegacyFeeStrategy {
+	return &LegacyFeeStrategy{
+		backend:     backend,
+		MaxGasPrice: maxGasPrice,
+	}
+}
+
+// Fees provides the fees for a legacy transaction.
+func (s *LegacyFeeStrategy) Fees(ctx context.Context) (*Fees, error) {
+	gasPrice, err := s.backend.SuggestGasPrice(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Fees{GasPrice: capFee(gasPrice, s.MaxGasPrice)}, nil
+}
+
+// DynamicFeeStrategy provides fees for EIP-1559 transactions.  The tip is
+// the given percentile of the tips paid in recent blocks, obtained from
+// eth_feeHistory if the backend supports it and suggested by the node
+// otherwise.  The maximum fee allows for the base fee doubling.
+type DynamicFeeStrategy struct {
+	backend bind.ContractTransactor
+	// Blocks is the number of recent blocks from which tips are obtained
+	Blocks uint64
+	// Percentile is the percentile of tips in each block that is used
+	Percentile float64
+	// MaxFeeCap caps the maximum fee, and with it the tip, if set
+	MaxFeeCap *big.Int
+}
+
+// NewDynamicFeeStrategy creates an EIP-1559 fee strategy with an optional cap
+// on the maximum fee.
+func NewDynamicFeeStrategy(backend bind.ContractTransactor, maxFeeCap *big.Int) *DynamicFeeStrategy {
+	return &DynamicFeeStrategy{
+		backend:    backend,
+		Blocks:     10,
+		Percentile: 50,
+		MaxFeeCap:  maxFeeCap,
+	}
+}
+
+// Fees provides the fees for an EIP-1559 transaction.
+func (s *DynamicFeeStrategy) Fees(ctx context.Context) (*Fees, error) {
+	head, err := s.backend.HeaderByNumber(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if head.BaseFee == nil {
+		return nil, errors.New("chain does not support EIP-1559 transactions")
+	}
+	baseFee := head.BaseFee
+
+	var tip *big.Int
+	if reader, isReader := s.backend.(FeeHistoryReader); isReader {
+		history, err := reader.FeeHistory(ctx, s.Blocks, nil, []float64{s.Percentile})
+		if err != nil {
+			return nil, err
+		}
+		tip = medianReward(history)
+		if len(history.BaseFee) > 0 {
+			// The final entry is the base fee of the next block
+			baseFee = history.BaseFee[len(history.BaseFee)-1]
+		}
+	}
+	if tip == nil {
+		if tip, err = s.backend.SuggestGasTipCap(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	feeCap := new(big.Int).Add(new(big.Int).Mul(baseFee, big.NewInt(2)), tip)
+	feeCap = capFee(feeCap, s.MaxFeeCap)
+	return &Fees{
+		GasFeeCap: feeCap,
+		GasTipCap: capFee(tip, feeCap),
+	}, nil
+}
+
+// medianReward returns the median of the rewards in a fee history, or nil if
+// there are none.
+func medianReward(history *ethereum.FeeHistory) *big.Int {
+	rewards := make([]*big.Int, 0, len(history.Reward))
+	for _, reward := range history.Reward {
+		if len(reward) > 0 && reward[0] != nil {
+			rewards = append(rewards, reward[0])
+		}
+	}
+	if len(rewards) == 0 {
+		return nil
+	}
+	sort.Slice(rewards, func(i, j int) bool { return rewards[i].Cmp(rewards[j]) < 0 })
+	return new(big.Int).Set(rewards[len(rewards)/2])
+}
+
+// capFee returns the fee limited to the cap, if there is one.
+func capFee(fee *big.Int, cap *big.Int) *big.Int {
+	if cap != nil && fee.Cmp(cap) > 0 {
+		return new(big.Int).Set(cap)
+	}
+	return fee
+}
+
+// WithGas returns an unsigned copy of a transaction with a different gas
+// limit.
+func WithGas(tx *types.Transaction, gas uint64) *types.Transaction {
+	return rebuild(tx, tx.ChainId(), tx.To(), tx.Value(), tx.Data(), tx.AccessList(), gas, feesOf(tx))
+}
+
+// WithChainID returns an unsigned copy of a transaction for a chain.  Typed
+// transactions created by bind have no chain ID until they are signed, so
+// one must be set for them to be signed elsewhere.
+func WithChainID(tx *types.Transaction, chainID *big.Int) *types.Transaction {
+	return rebuild(tx, chainID, tx.To(), tx.Value(), tx.Data(), tx.AccessList(), tx.Gas(), feesOf(tx))
+}
+
+// WithFees returns an unsigned copy of a transaction with different fees.
+// The copy is an EIP-1559 transaction if the fees have a maximum fee, and a
+// legacy or access list transaction otherwise.
+func WithFees(tx *types.Transaction, fees *Fees) *types.Transaction {
+	var chainID *big.Int
+	if tx.Type() != types.LegacyTxType {
+		chainID = tx.ChainId()
+	}
+	switch {
+	case fees.GasFeeCap != nil:
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:    chainID,
+			Nonce:      tx.Nonce(),
+			GasTipCap:  fees.GasTipCap,
+			GasFeeCap:  fees.GasFeeCap,
+			Gas:        tx.Gas(),
+			To:         tx.To(),
+			Value:      tx.Value(),
+			Data:       tx.Data(),
+			AccessList: tx.AccessList(),
+		})
+	case len(tx.AccessList()) > 0:
+		return types.NewTx(&types.AccessListTx{
+			ChainID:    chainID,
+			Nonce:      tx.Nonce(),
+			GasPrice:   fees.GasPrice,
+			Gas:        tx.Gas(),
+			To:         tx.To(),
+			Value:      tx.Value(),
+			Data:       tx.Data(),
+			AccessList: tx.AccessList(),
+		})
+	default:
+		return types.NewTx(&types.LegacyTx{
+			Nonce:    tx.Nonce(),
+			GasPrice: fees.GasPrice,
+			Gas:      tx.Gas(),
+			To:       tx.To(),
+			Value:    tx.Value(),
+			Data:     tx.Data(),
+		})
+	}
+}
+
+// BumpFees returns an unsigned copy of a transaction with its fees raised by
+// a percentage, allowing it to replace the original transaction.  Nodes
+// generally require fees to be raised by at least 10%.
+func BumpFees(tx *types.Transaction, percent uint64) *types.Transaction {
+	fees := feesOf(tx)
+	if fees.GasPrice != nil {
+		fees.GasPrice = bumpFee(fees.GasPrice, percent)
+	} else {
+		fees.GasFeeCap = bumpFee(fees.GasFeeCap, percent)
+		fees.GasTipCap = bumpFee(fees.GasTipCap, percent)
+	}
+	return rebuild(tx, tx.ChainId(), tx.To(), tx.Value(), tx.Data(), tx.AccessList(), tx.Gas(), fees)
+}
+
+// CancelTx returns an unsigned transaction with the nonce and fees of a
+// transaction that sends nothing to its sender, which cancels the original
+// transaction if it replaces it.  The fees should be bumped before
+// sending.
+func CancelTx(tx *types.Transaction, from common.Address) *types.Transaction {
+	return rebuild(tx, tx.ChainId(), &from, big.NewInt(0), nil, nil, params.TxGas, feesOf(tx))
+}
+
+// feesOf returns the fees of a transaction.
+func feesOf(tx *types.Transaction) *Fees {
+	if tx.Type() == types.DynamicFeeTxType {
+		return &Fees{
+			GasFeeCap: tx.GasFeeCap(),
+			GasTipCap: tx.GasTipCap(),
+		}
+	}
+	return &Fees{GasPrice: tx.GasPrice()}
+}
+
+// bumpFee raises a fee by a percentage, and by at least 1 wei.
+func bumpFee(fee *big.Int, percent uint64) *big.Int {
+	bumped := new(big.Int).Mul(fee, new(big.Int).SetUint64(100+percent))
+	bumped.Div(bumped, big.NewInt(100))
+	if bumped.Cmp(fee) <= 0 {
+		bumped.Add(fee, big.NewInt(1))
+	}
+	return bumped
+}
+
+// rebuild returns an unsigned transaction of the same type and with the same
+// nonce as a transaction, with the other fields given.
+func rebuild(tx *types.Transaction, chainID *big.Int, to *common.Address, value *big.Int, data []byte, accessList types.AccessList, gas uint64, fees *Fees) *types.Transaction {
+	switch tx.Type() {
+	case types.DynamicFeeTxType:
+		return types.NewTx(&types.DynamicFeeTx{
+			ChainID:    chainID,
+			Nonce:      tx.Nonce(),
+			GasTipCap:  fees.GasTipCap,
+			GasFeeCap:  fees.GasFeeCap,
+			Gas:        gas,
+			To:         to,
+			Value:      value,
+			Data:       data,
+			AccessList: accessList,
+		})
+	case types.AccessListTxType:
+		return types.NewTx(&types.AccessListTx{
+			ChainID:    chainID,
+			Nonce:      tx.Nonce(),
+			GasPrice:   fees.GasPrice,
+			Gas:        gas,
+			To:         to,
+			Value:      value,
+			Data:       data,
+			AccessList: accessList,
+		})
+	default:
+		return types.NewTx(&types.LegacyTx{
+			Nonce:    tx.Nonce(),
+			GasPrice: fees.GasPrice,
+			Gas:      gas,
+			To:       to,
+			Value:    value,
+			Data:     data,
+		})
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func gwei(n int64) *big.Int {
+	return new(big.Int).Mul(big.NewInt(n), big.NewInt(1000000000))
+}
+
+// feesTestBackend is a backend that provides fees; its other methods are
+// not implemented.
+type feesTestBackend struct {
+	bind.ContractTransactor
+	baseFee *big.Int
+	history *ethereum.FeeHistory
+}
+
+func (b *feesTestBackend) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	return &types.Header{Number: big.NewInt(100), BaseFee: b.baseFee}, nil
+}
+
+func (b *feesTestBackend) SuggestGasPrice(ctx context.Context) (*big.Int, error) {
+	return gwei(1), nil
+}
+
+func (b *feesTestBackend) SuggestGasTipCap(ctx context.Context) (*big.Int, error) {
+	return gwei(1), nil
+}
+
+func (b *feesTestBackend) FeeHistory(ctx context.Context, blockCount uint64, lastBlock *big.Int, rewardPercentiles []float64) (*ethereum.FeeHistory, error) {
+	if b.history == nil {
+		return &ethereum.FeeHistory{}, nil
+	}
+	return b.history, nil
+}
+
+func TestFeeStrategies(t *testing.T) {
+	ctx := context.Background()
+	backend := &feesTestBackend{}
+
+	// Legacy fees are capped
+	fees, err := NewLegacyFeeStrategy(backend, nil).Fees(ctx)
+	require.Nil(t, err, "Failed to obtain legacy fees")
+	assert.Equal(t, gwei(1), fees.GasPrice)
+	fees, err = NewLegacyFeeStrategy(backend, big.NewInt(500)).Fees(ctx)
+	require.Nil(t, err, "Failed to obtain legacy fees")
+	assert.Equal(t, big.NewInt(500), fees.GasPrice)
+
+	_, err = NewDynamicFeeStrategy(backend, nil).Fees(ctx)
+	assert.EqualError(t, err, "chain does not support EIP-1559 transactions")
+
+	// Without fee history the suggested tip is used
+	backend.baseFee = gwei(10)
+	fees, err = NewDynamicFeeStrategy(backend, nil).Fees(ctx)
+	require.Nil(t, err, "Failed to obtain dynamic fees")
+	assert.Nil(t, fees.GasPrice)
+	assert.Equal(t, gwei(1), fees.GasTipCap)
+	assert.Equal(t, gwei(21), fees.GasFeeCap)
+
+	// With fee history the median tip and next base fee are used
+	backend.history = &ethereum.FeeHistory{
+		Reward:  [][]*big.Int{{gwei(1)}, {gwei(3)}, {gwei(2)}},
+		BaseFee: []*big.Int{gwei(10), gwei(10), gwei(11), gwei(12)},
+	}
+	fees, err = NewDynamicFeeStrategy(backend, nil).Fees(ctx)
+	require.Nil(t, err, "Failed to obtain dynamic fees")
+	assert.Equal(t, gwei(2), fees.GasTipCap)
+	assert.Equal(t, gwei(26), fees.GasFeeCap)
+	fees, err = NewDynamicFeeStrategy(backend, gwei(20)).Fees(ctx)
+	require.Nil(t, err, "Failed to obtain dynamic fees")
+	assert.Equal(t, gwei(2), fees.GasTipCap)
+	assert.Equal(t, gwei(20), fees.GasFeeCap)
+}
+
+func TestFeeRebuilds(t *testing.T) {
+	tx := signerTestTx()
+	from := common.HexToAddress("0x0000000000000000000000000000000000000002")
+
+	// Bumps raise both fees by at least 1 wei
+	bumped := BumpFees(tx, 10)
+	assert.Equal(t, big.NewInt(2), bumped.GasTipCap())
+	assert.Equal(t, big.NewInt(3), bumped.GasFeeCap())
+	assert.Equal(t, tx.Nonce(), bumped.Nonce())
+
+	cancel := CancelTx(tx, from)
+	assert.Equal(t, from, *cancel.To())
+	assert.Equal(t, uint64(21000), cancel.Gas())
+	assert.Equal(t, int64(0), cancel.Value().Int64())
+
+	assert.Equal(t, uint64(50000), WithGas(tx, 50000).Gas())
+
+	// Fees change the type of the transaction to suit them
+	legacy := WithFees(tx, &Fees{GasPrice: gwei(3)})
+	assert.Equal(t, uint8(types.LegacyTxType), legacy.Type())
+	assert.Equal(t, gwei(3), legacy.GasPrice())
+	assert.Equal(t, tx.Value(), legacy.Value())
+	dynamic := WithFees(legacy, &Fees{GasFeeCap: gwei(5), GasTipCap: gwei(1)})
+	assert.Equal(t, uint8(types.DynamicFeeTxType), dynamic.Type())
+	assert.Equal(t, gwei(5), dynamic.GasFeeCap())
+	assert.Equal(t, gwei(1), dynamic.GasTipCap())
+	assert.Equal(t, tx.Nonce(), dynamic.Nonce())
+}
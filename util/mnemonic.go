@@ -0,0 +1,135 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	_ "embed"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/text/unicode/norm"
+)
+
+//go:embed bip39english.txt
+var bip39English string
+
+// bip39Words maps the words of the BIP-39 English word list to their indices.
+var bip39Words = func() map[string]int {
+	words := make(map[string]int)
+	for i, word := range strings.Fields(bip39English) {
+		words[word] = i
+	}
+	return words
+}()
+
+// NewMnemonicSigner creates a signer for the account at an index of the
+// default derivation path m/44'/60'/0'/0/index of a BIP-39 mnemonic, as used
+// by most wallets and development chains.
+func NewMnemonicSigner(mnemonic string, passphrase string, index uint32) (*PrivateKeySigner, error) {
+	path := make(accounts.DerivationPath, len(accounts.DefaultBaseDerivationPath))
+	copy(path, accounts.DefaultBaseDerivationPath)
+	path[len(path)-1] = index
+	key, err := DeriveKey(mnemonic, passphrase, path)
+	if err != nil {
+		return nil, err
+	}
+	return NewPrivateKeySigner(key), nil
+}
+
+// DeriveKey derives the private key at a BIP-32 derivation path from a
+// BIP-39 mnemonic and optional passphrase.  The mnemonic must use the
+// English word list and have a valid checksum.
+func DeriveKey(mnemonic string, passphrase string, path accounts.DerivationPath) (*ecdsa.PrivateKey, error) {
+	words := strings.Fields(mnemonic)
+	if err := checkMnemonic(words); err != nil {
+		return nil, err
+	}
+	seed := pbkdf2.Key([]byte(norm.NFKD.String(strings.Join(words, " "))), []byte(norm.NFKD.String("mnemonic"+passphrase)), 2048, 64, sha512.New)
+
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+	key, chainCode := sum[:32], sum[32:]
+	n := crypto.S256().Params().N
+	for _, index := range path {
+		var data []byte
+		if index >= 0x80000000 {
+			// Hardened children are derived from the private key
+			data = append([]byte{0x00}, key...)
+		} else {
+			parent, err := crypto.ToECDSA(key)
+			if err != nil {
+				return nil, err
+			}
+			data = crypto.CompressPubkey(&parent.PublicKey)
+		}
+		data = binary.BigEndian.AppendUint32(data, index)
+
+		mac := hmac.New(sha512.New, chainCode)
+		mac.Write(data)
+		sum := mac.Sum(nil)
+		child := new(big.Int).SetBytes(sum[:32])
+		if child.Cmp(n) >= 0 {
+			return nil, errors.New("invalid derived key")
+		}
+		child.Add(child, new(big.Int).SetBytes(key))
+		child.Mod(child, n)
+		if child.Sign() == 0 {
+			return nil, errors.New("invalid derived key")
+		}
+		key, chainCode = math.PaddedBigBytes(child, 32), sum[32:]
+	}
+	return crypto.ToECDSA(key)
+}
+
+// checkMnemonic checks the words of a mnemonic against the BIP-39 English
+// word list and checksum.
+func checkMnemonic(words []string) error {
+	switch len(words) {
+	case 12, 15, 18, 21, 24:
+	default:
+		return errors.New("mnemonic must have 12, 15, 18, 21 or 24 words")
+	}
+
+	// Each word encodes 11 bits, of which the last of every 33 are checksum
+	bits := new(big.Int)
+	for _, word := range words {
+		index, exists := bip39Words[word]
+		if !exists {
+			return fmt.Errorf("unknown mnemonic word %q", word)
+		}
+		bits.Lsh(bits, 11)
+		bits.Or(bits, big.NewInt(int64(index)))
+	}
+	checksumBits := uint(len(words) / 3)
+	checksum := new(big.Int).And(bits, big.NewInt(1<<checksumBits-1))
+	entropy := math.PaddedBigBytes(bits.Rsh(bits, checksumBits), len(words)*4/3)
+	hash := sha256.Sum256(entropy)
+	if uint64(hash[0]>>(8-checksumBits)) != checksum.Uint64() {
+		return errors.New("invalid mnemonic checksum")
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mnemonicTestMnemonic is the well-known mnemonic of development chains.
+const mnemonicTestMnemonic = "test test test test test test test test test test test junk"
+
+func TestMnemonicSigner(t *testing.T) {
+	signer, err := NewMnemonicSigner(mnemonicTestMnemonic, "", 0)
+	require.Nil(t, err, "Failed to create signer")
+	assert.Equal(t, common.HexToAddress("0xf39Fd6e51aad88F6F4ce6aB8827279cffFb92266"), signer.Address())
+	signer, err = NewMnemonicSigner(mnemonicTestMnemonic, "", 1)
+	require.Nil(t, err, "Failed to create signer")
+	assert.Equal(t, common.HexToAddress("0x70997970C51812dc3A010C7d01b50e0d17dc79C8"), signer.Address())
+
+	chainID := big.NewInt(1666700000)
+	opts := NewTransactOpts(context.Background(), signer, chainID)
+	signed, err := opts.Signer(signer.Address(), signerTestTx())
+	require.Nil(t, err, "Failed to sign transaction")
+	assert.Equal(t, signer.Address(), signerTestSender(t, signed, chainID))
+	_, err = opts.Signer(common.Address{}, signerTestTx())
+	assert.EqualError(t, err, "not authorized to sign this account")
+
+	_, err = NewMnemonicSigner("test test junk", "", 0)
+	assert.EqualError(t, err, "mnemonic must have 12, 15, 18, 21 or 24 words")
+	_, err = NewMnemonicSigner(strings.Repeat("test ", 12), "", 0)
+	assert.EqualError(t, err, "invalid mnemonic checksum")
+	_, err = NewMnemonicSigner(strings.Replace(mnemonicTestMnemonic, "junk", "junky", 1), "", 0)
+	assert.EqualError(t, err, `unknown mnemonic word "junky"`)
+}
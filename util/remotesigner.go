@@ -0,0 +1,117 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// RemoteSigner signs transactions with an external signer over JSON-RPC,
+// using the account_signTransaction method provided by Clef.
+type RemoteSigner struct {
+	client  *rpc.Client
+	address common.Address
+}
+
+// RemoteTxArgs are the arguments of account_signTransaction.
+type RemoteTxArgs struct {
+	From                 common.Address  `json:"from"`
+	To                   *common.Address `json:"to"`
+	Gas                  hexutil.Uint64  `json:"gas"`
+	GasPrice             *hexutil.Big    `json:"gasPrice,omitempty"`
+	MaxFeePerGas         *hexutil.Big    `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas *hexutil.Big    `json:"maxPriorityFeePerGas,omitempty"`
+	Value                hexutil.Big     `json:"value"`
+	Nonce                hexutil.Uint64  `json:"nonce"`
+	Data                 hexutil.Bytes   `json:"data"`
+	ChainID              *hexutil.Big    `json:"chainId,omitempty"`
+}
+
+// RemoteTxResult is the result of account_signTransaction.
+type RemoteTxResult struct {
+	Raw hexutil.Bytes `json:"raw"`
+}
+
+// NewRemoteSigner creates a signer for an address that uses the external
+// signer at a URL, for example http://localhost:8550 for Clef.
+func NewRemoteSigner(ctx context.Context, url string, address common.Address) (*RemoteSigner, error) {
+	client, err := rpc.DialContext(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return NewRemoteSignerWithClient(client, address), nil
+}
+
+// NewRemoteSignerWithClient creates a signer for an address that uses the
+// external signer connected to an RPC client.
+func NewRemoteSignerWithClient(client *rpc.Client, address common.Address) *RemoteSigner {
+	return &RemoteSigner{
+		client:  client,
+		address: address,
+	}
+}
+
+// Address is the address for which the signer signs.
+func (s *RemoteSigner) Address() common.Address {
+	return s.address
+}
+
+// SignTx signs a transaction for a chain.
+func (s *RemoteSigner) SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	args := &RemoteTxArgs{
+		From:    s.address,
+		To:      tx.To(),
+		Gas:     hexutil.Uint64(tx.Gas()),
+		Value:   hexutil.Big(*tx.Value()),
+		Nonce:   hexutil.Uint64(tx.Nonce()),
+		Data:    tx.Data(),
+		ChainID: (*hexutil.Big)(chainID),
+	}
+	if tx.Type() == types.DynamicFeeTxType {
+		args.MaxFeePerGas = (*hexutil.Big)(tx.GasFeeCap())
+		args.MaxPriorityFeePerGas = (*hexutil.Big)(tx.GasTipCap())
+	} else {
+		args.GasPrice = (*hexutil.Big)(tx.GasPrice())
+	}
+
+	var res RemoteTxResult
+	if err := s.client.CallContext(ctx, &res, "account_signTransaction", args); err != nil {
+		return nil, err
+	}
+	signed := new(types.Transaction)
+	if err := signed.UnmarshalBinary(res.Raw); err != nil {
+		return nil, err
+	}
+	// Ensure that the signer signed what was asked of it
+	signer := types.LatestSignerForChainID(chainID)
+	sender, err := types.Sender(signer, signed)
+	if err != nil {
+		return nil, err
+	}
+	if sender != s.address {
+		return nil, fmt.Errorf("transaction signed by %s rather than %s", sender.Hex(), s.address.Hex())
+	}
+	if signer.Hash(signed) != signer.Hash(WithChainID(tx, chainID)) {
+		return nil, fmt.Errorf("signed transaction does not match the request")
+	}
+	return signed, nil
+}
@@ -0,0 +1,91 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// remoteSignerTestClef is a stub of the account API of Clef.
+type remoteSignerTestClef struct {
+	key     *ecdsa.PrivateKey
+	chainID *big.Int
+	// data, if set, replaces the data of transactions before signing
+	data []byte
+}
+
+func (c *remoteSignerTestClef) SignTransaction(args RemoteTxArgs) (*RemoteTxResult, error) {
+	if c.data != nil {
+		args.Data = c.data
+	}
+	tx := types.NewTx(&types.DynamicFeeTx{
+		ChainID:   c.chainID,
+		Nonce:     uint64(args.Nonce),
+		GasTipCap: args.MaxPriorityFeePerGas.ToInt(),
+		GasFeeCap: args.MaxFeePerGas.ToInt(),
+		Gas:       uint64(args.Gas),
+		To:        args.To,
+		Value:     args.Value.ToInt(),
+		Data:      args.Data,
+	})
+	signed, err := types.SignTx(tx, types.LatestSignerForChainID(c.chainID), c.key)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := signed.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &RemoteTxResult{Raw: raw}, nil
+}
+
+func TestRemoteSigner(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.Nil(t, err, "Failed to generate key")
+	chainID := big.NewInt(1666700000)
+	server := rpc.NewServer()
+	defer server.Stop()
+	clef := &remoteSignerTestClef{key: key, chainID: chainID}
+	require.Nil(t, server.RegisterName("account", clef), "Failed to register stub")
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	address := crypto.PubkeyToAddress(key.PublicKey)
+	signer := NewRemoteSignerWithClient(client, address)
+	signed, err := signer.SignTx(context.Background(), signerTestTx(), chainID)
+	require.Nil(t, err, "Failed to sign transaction")
+	assert.Equal(t, address, signerTestSender(t, signed, chainID))
+	assert.Equal(t, uint64(3), signed.Nonce())
+
+	// Signatures from other accounts are rejected
+	other := NewRemoteSignerWithClient(client, common.HexToAddress("0x0000000000000000000000000000000000000002"))
+	_, err = other.SignTx(context.Background(), signerTestTx(), chainID)
+	assert.EqualError(t, err, "transaction signed by "+address.Hex()+" rather than 0x0000000000000000000000000000000000000002")
+
+	// Transactions altered by the signer are rejected
+	clef.data = []byte{0x01}
+	_, err = signer.SignTx(context.Background(), signerTestTx(), chainID)
+	assert.EqualError(t, err, "signed transaction does not match the request")
+}
@@ -16,12 +16,15 @@
 package util
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"errors"
 	"math/big"
+	"os"
 
 	"github.com/ethereum/go-ethereum/accounts"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -34,7 +37,7 @@ func KeySigner(chainID *big.Int, key *ecdsa.PrivateKey) (signerfn bind.SignerFn)
 		if address != keyAddr {
 			return nil, errors.New("not authorized to sign this account")
 		}
-		return types.SignTx(tx, types.NewEIP155Signer(chainID), key)
+		return types.SignTx(tx, types.LatestSignerForChainID(chainID), key)
 	}
 
 	return
@@ -50,3 +53,62 @@ func AccountSigner(chainID *big.Int, wallet *accounts.Wallet, account *accounts.
 	}
 	return
 }
+
+// Signer signs transactions for a single address.
+type Signer interface {
+	// Address is the address for which the signer signs
+	Address() common.Address
+	// SignTx signs a transaction for a chain
+	SignTx(ctx context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error)
+}
+
+// NewTransactOpts creates transaction options that sign with a signer.
+func NewTransactOpts(ctx context.Context, signer Signer, chainID *big.Int) *bind.TransactOpts {
+	return &bind.TransactOpts{
+		From:    signer.Address(),
+		Context: ctx,
+		Signer: func(address common.Address, tx *types.Transaction) (*types.Transaction, error) {
+			if address != signer.Address() {
+				return nil, errors.New("not authorized to sign this account")
+			}
+			return signer.SignTx(ctx, tx, chainID)
+		},
+	}
+}
+
+// PrivateKeySigner signs transactions with a private key.
+type PrivateKeySigner struct {
+	key     *ecdsa.PrivateKey
+	address common.Address
+}
+
+// NewPrivateKeySigner creates a signer from a private key.
+func NewPrivateKeySigner(key *ecdsa.PrivateKey) *PrivateKeySigner {
+	return &PrivateKeySigner{
+		key:     key,
+		address: crypto.PubkeyToAddress(key.PublicKey),
+	}
+}
+
+// NewKeystoreSigner creates a signer from an encrypted keystore file.
+func NewKeystoreSigner(path string, passphrase string) (*PrivateKeySigner, error) {
+	keyJSON, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := keystore.DecryptKey(keyJSON, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return NewPrivateKeySigner(key.PrivateKey), nil
+}
+
+// Address is the address for which the signer signs.
+func (s *PrivateKeySigner) Address() common.Address {
+	return s.address
+}
+
+// SignTx signs a transaction for a chain.
+func (s *PrivateKeySigner) SignTx(_ context.Context, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return types.SignTx(tx, types.LatestSignerForChainID(chainID), s.key)
+}
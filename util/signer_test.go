@@ -0,0 +1,55 @@
+// Copyright John Whitton https://github.com/john_whitton
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package util
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signerTestTx() *types.Transaction {
+	to := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	return types.NewTx(&types.DynamicFeeTx{
+		Nonce:     3,
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(2),
+		Gas:       21000,
+		To:        &to,
+		Value:     big.NewInt(5),
+	})
+}
+
+func signerTestSender(t *testing.T, tx *types.Transaction, chainID *big.Int) common.Address {
+	sender, err := types.Sender(types.LatestSignerForChainID(chainID), tx)
+	require.Nil(t, err, "Failed to obtain sender")
+	return sender
+}
+
+func TestKeystoreSigner(t *testing.T) {
+	account, err := keystore.StoreKey(t.TempDir(), "secret", keystore.LightScryptN, keystore.LightScryptP)
+	require.Nil(t, err, "Failed to create keystore")
+
+	signer, err := NewKeystoreSigner(account.URL.Path, "secret")
+	require.Nil(t, err, "Failed to create signer")
+	assert.Equal(t, account.Address, signer.Address())
+	_, err = NewKeystoreSigner(account.URL.Path, "wrong")
+	assert.NotNil(t, err, "Decrypted keystore with wrong passphrase")
+}